@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"teachat/pkgs/config"
+
+	"github.com/spf13/cobra"
+)
+
+func newConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+	}
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "show",
+			Short: "Print the configuration file location and its effective content",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				path, err := config.Path()
+				if err != nil {
+					return err
+				}
+				cfg, err := config.Load()
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "# %s\n", path)
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(cfg)
+			},
+		},
+		&cobra.Command{
+			Use:   "validate",
+			Short: "Check the configuration for errors",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				cfg, err := config.Load()
+				if err != nil {
+					return err
+				}
+				if err := cfg.Validate(); err != nil {
+					return fmt.Errorf("invalid configuration:\n%w", err)
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), "configuration is valid")
+				return nil
+			},
+		},
+	)
+	return cmd
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"teachat/pkgs/shell"
+	"teachat/pkgs/types"
+
+	"github.com/spf13/cobra"
+)
+
+func newExplainCommand() *cobra.Command {
+	var modelName types.LLMModel
+	var persona string
+	var headless bool
+	var lines int
+	var timeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "explain [flags] -- command [args...]",
+		Short: "Run a command and ask a model why it failed",
+		Long: `explain runs the command, showing its output, then opens a chat with the
+command, the end of its output, its exit status and the environment it ran
+in, asking why it failed and how to fix it. A single argument is run by the
+shell as it is, so that it can hold pipes and redirections.
+
+With --headless the explanation is printed to stdout instead.`,
+		Example: `  teachat explain -- make test
+  teachat explain --headless -- go build ./...
+  teachat explain 'go vet ./... | head'`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if lines <= 0 {
+				return usageError{errors.New("--lines must be positive")}
+			}
+			cfg, err := loadConfig(persona)
+			if err != nil {
+				return err
+			}
+			model, err := findModel(cfg, modelName)
+			if err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+			command := args[0]
+			if len(args) > 1 {
+				command = shell.Quote(args)
+			}
+			output, done := runExplained(shell.Run(ctx, command, timeout), cmd.ErrOrStderr())
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			transcript := shell.Transcript(command, shell.Tail(output, lines), &done)
+			prompt := shell.ExplainPrompt(transcript, done, shell.CurrentEnvironment(ctx))
+			if headless {
+				fmt.Fprintln(cmd.ErrOrStderr())
+				return runHeadless(ctx, cfg, headlessOptions{model: model.Name, prompt: prompt}, cmd.OutOrStdout())
+			}
+			stop()
+			return runTUI(cfg, string(model.Name), nil, []string{prompt})
+		},
+	}
+	cmd.Flags().StringVarP((*string)(&modelName), "model", "m", "", "model to use, defaults to default_model from the config")
+	cmd.Flags().StringVar(&persona, "persona", "", "persona from the config to use as system prompt")
+	cmd.Flags().BoolVar(&headless, "headless", false, "print the explanation to stdout instead of starting the TUI")
+	cmd.Flags().IntVar(&lines, "lines", 100, "number of lines at the end of the output sent to the model")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "kill the command after this long, 0 waits until it exits")
+	cmd.RegisterFlagCompletionFunc("model", completeModels)
+	cmd.RegisterFlagCompletionFunc("persona", completePersonas)
+	return cmd
+}
+
+// runExplained shows the output of a command on w as it comes, and returns
+// it with how the command ended.
+func runExplained(events <-chan shell.Event, w io.Writer) (string, shell.Event) {
+	var output strings.Builder
+	for ev := range events {
+		if ev.Done {
+			if ev.Err != nil {
+				fmt.Fprintf(w, "teachat: %s\n", ev.Err)
+			}
+			return output.String(), ev
+		}
+		output.WriteString(ev.Output)
+		io.WriteString(w, ev.Output)
+	}
+	return output.String(), shell.Event{Done: true, ExitCode: -1, Err: errors.New("cancelled")}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"teachat/pkgs/config"
+	"teachat/pkgs/git"
+	"teachat/pkgs/llmclients"
+	"teachat/pkgs/llminterface"
+	"teachat/pkgs/tokens"
+	"teachat/pkgs/types"
+
+	"github.com/spf13/cobra"
+)
+
+func newCommitCommand() *cobra.Command {
+	var modelName types.LLMModel
+	var persona string
+	var noEdit, dryRun bool
+	cmd := &cobra.Command{
+		Use:   "commit",
+		Short: "Commit the staged changes with a message written by a model",
+		Long: `commit asks the model for a Conventional Commits message describing the
+changes staged with git add, opens it in the editor of git and commits.
+Diffs too large for the context window are summarized in parts first.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(persona)
+			if err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+			diff, err := git.StagedDiff(ctx, ".")
+			if err != nil {
+				return err
+			}
+			if strings.TrimSpace(diff) == "" {
+				return usageError{errors.New("nothing staged, add the changes to commit with git add")}
+			}
+			model, err := findModel(cfg, modelName)
+			if err != nil {
+				return err
+			}
+			client, chunks, err := diffClient(cfg, model, diff)
+			if err != nil {
+				return err
+			}
+			if len(chunks) > 1 {
+				fmt.Fprintf(cmd.ErrOrStderr(), "The diff is too large for %s, summarizing it in %d parts.\n", model.Name, len(chunks))
+			}
+			message, err := git.CommitMessage(ctx, client, chunks)
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				fmt.Fprintln(cmd.OutOrStdout(), message)
+				return nil
+			}
+			// git and the editor handle the interrupts from now on
+			stop()
+			commit := git.CommitCommand(cmd.Context(), ".", message, !noEdit)
+			commit.Stdin, commit.Stdout, commit.Stderr = os.Stdin, cmd.OutOrStdout(), cmd.ErrOrStderr()
+			if err := commit.Run(); err != nil {
+				return fmt.Errorf("git commit: %w", err)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP((*string)(&modelName), "model", "m", "", "model to use, defaults to default_model from the config")
+	cmd.Flags().StringVar(&persona, "persona", "", "persona from the config to use as system prompt")
+	cmd.Flags().BoolVar(&noEdit, "no-edit", false, "commit without opening the message in the editor")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the message instead of committing")
+	cmd.RegisterFlagCompletionFunc("model", completeModels)
+	cmd.RegisterFlagCompletionFunc("persona", completePersonas)
+	return cmd
+}
+
+func newReviewCommand() *cobra.Command {
+	var modelName types.LLMModel
+	var persona string
+	var tui bool
+	cmd := &cobra.Command{
+		Use:   "review [revisions]",
+		Short: "Review a diff with a model",
+		Long: `review asks the model for a review of the changes of revisions, like
+main..HEAD, or of the changes not committed yet. The review has a summary,
+comments on the lines of every file and a verdict. It is streamed to
+stdout, or to the TUI with --tui to discuss it afterwards. Diffs too large
+for the context window are reviewed in parts.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(persona)
+			if err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+			var revisions string
+			if len(args) > 0 {
+				revisions = args[0]
+			}
+			diff, err := git.Diff(ctx, ".", revisions)
+			if err != nil {
+				return usageError{err}
+			}
+			if strings.TrimSpace(diff) == "" {
+				return usageError{errors.New("no changes to review")}
+			}
+			model, err := findModel(cfg, modelName)
+			if err != nil {
+				return err
+			}
+			_, chunks, err := diffClient(cfg, model, diff)
+			if err != nil {
+				return err
+			}
+			prompts := make([]string, len(chunks))
+			for i, chunk := range chunks {
+				prompts[i] = git.ReviewPrompt(chunk, i+1, len(chunks))
+			}
+			if tui {
+				stop()
+				return runTUI(cfg, string(model.Name), nil, prompts)
+			}
+			stdout := cmd.OutOrStdout()
+			for i, prompt := range prompts {
+				if len(chunks) > 1 {
+					if i > 0 {
+						fmt.Fprintln(stdout)
+					}
+					fmt.Fprintf(stdout, "# Part %d of %d: %s\n\n", i+1, len(chunks), strings.Join(chunks[i].Files, ", "))
+				}
+				if err := runHeadless(ctx, cfg, headlessOptions{model: model.Name, prompt: prompt}, stdout); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP((*string)(&modelName), "model", "m", "", "model to use, defaults to default_model from the config")
+	cmd.Flags().StringVar(&persona, "persona", "", "persona from the config to use as system prompt")
+	cmd.Flags().BoolVar(&tui, "tui", false, "stream the review in the TUI instead of stdout")
+	cmd.RegisterFlagCompletionFunc("model", completeModels)
+	cmd.RegisterFlagCompletionFunc("persona", completePersonas)
+	return cmd
+}
+
+// findModel returns the model named name, or the default model of cfg when
+// name is empty.
+func findModel(cfg config.Config, name types.LLMModel) (types.Model, error) {
+	if name == "" {
+		name = cfg.DefaultModel
+	}
+	if name == "" {
+		return types.Model{}, usageError{errors.New("no model given, use -m or set default_model in the config")}
+	}
+	model, ok := types.FindModel(name)
+	if !ok {
+		return types.Model{}, usageError{fmt.Errorf("model %q is not supported", name)}
+	}
+	return model, nil
+}
+
+// diffClient returns a client of model and diff cut in chunks fitting its
+// context window, next to the system prompt and the reply.
+func diffClient(cfg config.Config, model types.Model, diff string) (llminterface.Client, []git.Chunk, error) {
+	client, err := llmclients.New(model, cfg, "")
+	if err != nil {
+		return nil, nil, usageError{err}
+	}
+	systemPrompt, err := cfg.SystemPrompt("")
+	if err != nil {
+		return nil, nil, usageError{err}
+	}
+	counter := tokens.For(model, client)
+	window := cfg.ContextWindow(model) - cfg.ContextReserve() - counter.Count(systemPrompt)
+	return client, git.Split(diff, git.Budget(window, counter), counter), nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"teachat/pkgs/history"
+	"teachat/pkgs/styles"
+	"teachat/pkgs/types"
+
+	"github.com/spf13/cobra"
+)
+
+func newHistoryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Manage saved conversations",
+	}
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "list",
+			Short: "List saved conversations, most recent first",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				store, err := history.OpenDefault()
+				if err != nil {
+					return err
+				}
+				conversations, err := store.List()
+				if err != nil {
+					return err
+				}
+				w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "ID\tUPDATED\tMODEL\tTITLE")
+				for _, c := range conversations {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.ID, c.UpdatedAt.Format("2006-01-02 15:04"), c.Model.Name, c.Title())
+				}
+				return w.Flush()
+			},
+		},
+		&cobra.Command{
+			Use:               "show ID",
+			Short:             "Print a saved conversation",
+			Args:              cobra.ExactArgs(1),
+			ValidArgsFunction: completeConversations,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				c, err := loadConversation(args[0])
+				if err != nil {
+					return err
+				}
+				fmt.Fprint(cmd.OutOrStdout(), c.Markdown())
+				return nil
+			},
+		},
+		newHistorySearchCommand(),
+		&cobra.Command{
+			Use:               "rm ID...",
+			Short:             "Delete saved conversations",
+			Args:              cobra.MinimumNArgs(1),
+			ValidArgsFunction: completeConversations,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				store, err := history.OpenDefault()
+				if err != nil {
+					return err
+				}
+				for _, id := range args {
+					if err := store.Delete(id); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	)
+	return cmd
+}
+
+func newHistorySearchCommand() *cobra.Command {
+	var model, platform, tag, since, until string
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "search [QUERY...]",
+		Short: "Search the saved conversations, best matches first",
+		Long: `Search the text of the saved conversations. Every word of the query has to
+be found in a conversation, words may also match as prefixes.
+
+Filters can be given as flags or in the query, like "nats config tag:infra
+since:2024-05-01".`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q, err := history.ParseQuery(strings.Join(args, " "))
+			if err != nil {
+				return usageError{err}
+			}
+			if model != "" {
+				q.Model = types.LLMModel(model)
+			}
+			if platform != "" {
+				q.Platform = types.LLMPlatform(platform)
+			}
+			if tag != "" {
+				q.Tag = tag
+			}
+			if since != "" {
+				if q.Since, err = history.ParseDate(since); err != nil {
+					return usageError{err}
+				}
+			}
+			if until != "" {
+				if q.Until, err = history.ParseDate(until); err != nil {
+					return usageError{err}
+				}
+				q.Until = q.Until.AddDate(0, 0, 1)
+			}
+			store, err := history.OpenDefault()
+			if err != nil {
+				return err
+			}
+			idx, err := store.Index()
+			if err != nil {
+				return err
+			}
+			results := idx.Search(q)
+			if limit > 0 && len(results) > limit {
+				results = results[:limit]
+			}
+			out := cmd.OutOrStdout()
+			for i, r := range results {
+				if i > 0 {
+					fmt.Fprintln(out)
+				}
+				c := r.Conversation
+				fmt.Fprintf(out, "%s  %s  %s  %s\n", c.ID, c.UpdatedAt.Format("2006-01-02 15:04"), c.Model.Name, c.Title())
+				fmt.Fprintf(out, "    %s\n", highlightHits(r.Snippet, r.Hits))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&model, "model", "m", "", "only conversations with this model")
+	cmd.Flags().StringVar(&platform, "platform", "", "only conversations on this platform")
+	cmd.Flags().StringVar(&tag, "tag", "", "only conversations with this tag")
+	cmd.Flags().StringVar(&since, "since", "", "only conversations updated on or after this date, YYYY-MM-DD")
+	cmd.Flags().StringVar(&until, "until", "", "only conversations updated on or before this date, YYYY-MM-DD")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "maximum number of results, 0 for all")
+	cmd.RegisterFlagCompletionFunc("model", completeModels)
+	return cmd
+}
+
+// highlightHits styles the hits of a search snippet, only when stdout is a
+// terminal since lipgloss detects the color profile.
+func highlightHits(snippet string, hits [][2]int) string {
+	var sb strings.Builder
+	last := 0
+	for _, h := range hits {
+		sb.WriteString(snippet[last:h[0]])
+		sb.WriteString(styles.MatchStyle.Render(snippet[h[0]:h[1]]))
+		last = h[1]
+	}
+	sb.WriteString(snippet[last:])
+	return sb.String()
+}
+
+func newExportCommand() *cobra.Command {
+	var format string
+	cmd := &cobra.Command{
+		Use:               "export ID",
+		Short:             "Export a saved conversation to stdout",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeConversations,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := loadConversation(args[0])
+			if err != nil {
+				return err
+			}
+			switch format {
+			case "md", "markdown":
+				fmt.Fprint(cmd.OutOrStdout(), c.Markdown())
+				return nil
+			case "json":
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(c)
+			default:
+				return usageError{fmt.Errorf("unknown format %q, expected md or json", format)}
+			}
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "md", "output format: md or json")
+	cmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"md", "json"}, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+func loadConversation(id string) (history.Conversation, error) {
+	store, err := history.OpenDefault()
+	if err != nil {
+		return history.Conversation{}, err
+	}
+	c, err := store.Load(id)
+	if err != nil {
+		return c, usageError{err}
+	}
+	return c, nil
+}
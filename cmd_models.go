@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"teachat/pkgs/llmclients"
+	"teachat/pkgs/types"
+
+	"github.com/spf13/cobra"
+)
+
+func newModelsCommand() *cobra.Command {
+	var platform string
+	cmd := &cobra.Command{
+		Use:   "models",
+		Short: "List the supported models",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if platform != "" {
+				if _, ok := llmclients.PlatformInitialization[types.LLMPlatform(platform)]; !ok {
+					return usageError{fmt.Errorf("platform %q is not supported", platform)}
+				}
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "MODEL\tPLATFORM")
+			for _, m := range types.SupportedModels {
+				if platform != "" && m.Platform != types.LLMPlatform(platform) {
+					continue
+				}
+				fmt.Fprintf(w, "%s\t%s\n", m.Name, m.Platform)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&platform, "platform", "", "only list models of this platform")
+	cmd.RegisterFlagCompletionFunc("platform", func(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		var platforms []string
+		for p := range llmclients.PlatformInitialization {
+			platforms = append(platforms, string(p))
+		}
+		return platforms, cobra.ShellCompDirectiveNoFileComp
+	})
+	return cmd
+}
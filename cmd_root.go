@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+
+	"teachat/pkgs/cassette"
+	"teachat/pkgs/config"
+	"teachat/pkgs/history"
+	"teachat/pkgs/llmclients"
+	"teachat/pkgs/logging"
+	"teachat/pkgs/mcp"
+	"teachat/pkgs/types"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+)
+
+// logStderrAnnotation marks commands that log to stderr instead of the log
+// file, like long running servers.
+const logStderrAnnotation = "log-stderr"
+
+func newRootCommand() *cobra.Command {
+	var opts headlessOptions
+	var question string
+	var debug bool
+	var logCloser io.Closer
+	var record, replay string
+	var replaySpeed float64
+	cmd := &cobra.Command{
+		Use:   "teachat [prompt]",
+		Short: "Chat with LLMs from the terminal",
+		Long: `teachat is a terminal UI to chat with OpenAI and Ollama models.
+
+Without a prompt or piped input the TUI is started. Otherwise the prompt is
+sent to the model and the answer is streamed to stdout.`,
+		Args:          cobra.ArbitraryArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return usageError{err}
+			}
+			_, stderr := cmd.Annotations[logStderrAnnotation]
+			logCloser, err = logging.Setup(cfg.Log, logging.Options{Debug: debug, Stderr: stderr})
+			if err != nil {
+				return usageError{err}
+			}
+			slog.Debug("starting", "command", cmd.CommandPath(), "args", args)
+			return setupCassette(record, replay, replaySpeed)
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			if logCloser != nil {
+				logCloser.Close()
+			}
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(opts.persona)
+			if err != nil {
+				return err
+			}
+			question = strings.TrimSpace(question + " " + strings.Join(args, " "))
+			piped := stdinIsPiped()
+			if question == "" && !piped {
+				return runTUI(cfg, string(opts.model), nil, nil)
+			}
+			var stdin io.Reader
+			if piped {
+				stdin = os.Stdin
+			}
+			opts.prompt, err = buildPrompt(question, stdin)
+			if err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+			return runHeadless(ctx, cfg, opts, cmd.OutOrStdout())
+		},
+	}
+	cmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return usageError{err}
+	})
+	cmd.PersistentFlags().BoolVar(&debug, "debug", false, "log at debug level")
+	cmd.PersistentFlags().StringVar(&record, "record", "", "record the provider HTTP traffic to this cassette file")
+	cmd.PersistentFlags().StringVar(&replay, "replay", "", "answer provider requests from this cassette file instead of the network")
+	cmd.PersistentFlags().Float64Var(&replaySpeed, "replay-speed", 1, "replay timing factor: 1 keeps the recorded timing, 0 disables delays")
+	flags := cmd.Flags()
+	flags.StringVarP((*string)(&opts.model), "model", "m", "", "model to use, defaults to default_model from the config")
+	flags.StringVarP(&question, "prompt", "p", "", "prompt to send; the answer is printed to stdout instead of starting the TUI")
+	flags.StringVar(&opts.persona, "persona", "", "persona from the config to use as system prompt")
+	flags.BoolVar(&opts.json, "json", false, "print the answer and usage metadata as JSON (headless mode only)")
+	cmd.RegisterFlagCompletionFunc("model", completeModels)
+	cmd.RegisterFlagCompletionFunc("persona", completePersonas)
+
+	cmd.AddCommand(
+		newChatCommand(),
+		newModelsCommand(),
+		newHistoryCommand(),
+		newExportCommand(),
+		newConfigCommand(),
+		newServeCommand(),
+		newCommitCommand(),
+		newReviewCommand(),
+		newExplainCommand(),
+	)
+	return cmd
+}
+
+func newChatCommand() *cobra.Command {
+	var modelName, persona, resume string
+	cmd := &cobra.Command{
+		Use:   "chat",
+		Short: "Start the TUI, optionally with a model, persona or saved conversation",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(persona)
+			if err != nil {
+				return err
+			}
+			var conversation *history.Conversation
+			if resume != "" {
+				store, err := history.OpenDefault()
+				if err != nil {
+					return err
+				}
+				c, err := store.Load(resume)
+				if err != nil {
+					return usageError{err}
+				}
+				conversation = &c
+				if modelName == "" {
+					modelName = string(c.Model.Name)
+				}
+			}
+			return runTUI(cfg, modelName, conversation, nil)
+		},
+	}
+	cmd.Flags().StringVarP(&modelName, "model", "m", "", "model to chat with, skips the model selection page")
+	cmd.Flags().StringVar(&persona, "persona", "", "persona from the config to use as system prompt")
+	cmd.Flags().StringVar(&resume, "resume", "", "ID of a saved conversation to continue")
+	cmd.RegisterFlagCompletionFunc("model", completeModels)
+	cmd.RegisterFlagCompletionFunc("persona", completePersonas)
+	cmd.RegisterFlagCompletionFunc("resume", completeConversations)
+	return cmd
+}
+
+// setupCassette routes the provider traffic through a cassette recorder or
+// replayer when requested.
+func setupCassette(record, replay string, speed float64) error {
+	var mode cassette.Mode
+	var path string
+	switch {
+	case record != "" && replay != "":
+		return usageError{errors.New("--record and --replay can't be used together")}
+	case record != "":
+		mode, path = cassette.ModeRecord, record
+	case replay != "":
+		mode, path = cassette.ModeReplay, replay
+	default:
+		return nil
+	}
+	httpClient, err := cassette.NewHTTPClient(mode, path, speed)
+	if err != nil {
+		return usageError{err}
+	}
+	slog.Info("using cassette", "mode", mode, "path", path)
+	llmclients.HTTPClient = httpClient
+	return nil
+}
+
+// loadConfig loads the configuration and makes persona, when given, the
+// default persona.
+func loadConfig(persona string) (config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return cfg, usageError{err}
+	}
+	if persona != "" {
+		if _, err := cfg.SystemPrompt(persona); err != nil {
+			return cfg, usageError{err}
+		}
+		cfg.Persona = persona
+	}
+	return cfg, nil
+}
+
+// runTUI starts the Bubble Tea program. When modelName is set the model
+// selection page is skipped and prompts, if any, are sent in turn.
+func runTUI(cfg config.Config, modelName string, resume *history.Conversation, prompts []string) error {
+	var opts tuiOptions
+	if modelName != "" {
+		model, ok := types.FindModel(types.LLMModel(modelName))
+		if !ok {
+			return usageError{fmt.Errorf("model %q is not supported", modelName)}
+		}
+		opts.model = &model
+	}
+	opts.resume = resume
+	opts.prompts = prompts
+	store, err := history.OpenDefault()
+	if err != nil {
+		return err
+	}
+	opts.mcp = mcp.NewManager(cfg.MCPServers)
+	opts.mcp.Start()
+	defer opts.mcp.Close()
+	initialModel := initialModel(cfg, store, opts)
+	_, err = tea.NewProgram(&initialModel).Run()
+	return err
+}
+
+func completeModels(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	var names []string
+	for _, m := range types.SupportedModels {
+		names = append(names, fmt.Sprintf("%s\t%s", m.Name, m.Platform))
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completePersonas(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var names []string
+	for name := range cfg.Personas {
+		names = append(names, name)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeConversations(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	store, err := history.OpenDefault()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	conversations, err := store.List()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var ids []string
+	for _, c := range conversations {
+		ids = append(ids, fmt.Sprintf("%s\t%s", c.ID, c.Title()))
+	}
+	return ids, cobra.ShellCompDirectiveNoFileComp
+}
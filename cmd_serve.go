@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"teachat/pkgs/server"
+
+	"github.com/spf13/cobra"
+)
+
+func newServeCommand() *cobra.Command {
+	var addr string
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the configured providers through an OpenAI compatible API",
+		Long: `serve exposes /v1/chat/completions and /v1/models, routing every request to
+the provider of the requested model. Model names can be aliased with
+serve.aliases in the config.`,
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{logStderrAnnotation: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig("")
+			if err != nil {
+				return err
+			}
+			if addr == "" {
+				addr = cfg.Serve.Addr
+			}
+			if addr == "" {
+				addr = server.DefaultAddr
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return server.New(cfg, slog.Default()).ListenAndServe(ctx, addr)
+		},
+	}
+	cmd.Flags().StringVar(&addr, "addr", "", "address to listen on, defaults to serve.addr from the config or "+server.DefaultAddr)
+	return cmd
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"teachat/pkgs/config"
+	"teachat/pkgs/history"
+	"teachat/pkgs/mcp/mcptest"
+	"teachat/pkgs/mock"
+	"teachat/pkgs/pages"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+var update = flag.Bool("update", false, "regenerate the golden files in testdata")
+
+// cmdTimeout bounds how long a command may run before the harness drops it.
+// Commands that block longer are timers like the cursor blink.
+const cmdTimeout = 20 * time.Millisecond
+
+func TestMain(m *testing.M) {
+	// the test binary is the fake MCP server when started by the tests
+	mcptest.Main()
+	lipgloss.SetColorProfile(termenv.Ascii)
+	mock.Register()
+	// keep settings saved from the TUI and the audit log away from the user
+	// files
+	dir, err := os.MkdirTemp("", "teachat-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("TEACHAT_CONFIG", filepath.Join(dir, "config.json"))
+	os.Setenv("XDG_STATE_HOME", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// harness drives the root model the way Bubble Tea would: every message goes
+// through Update and the returned commands are run until they settle, feeding
+// their messages back.
+type harness struct {
+	t     *testing.T
+	model *model
+}
+
+func newHarness(t *testing.T, opts tuiOptions) *harness {
+	t.Helper()
+	return newHarnessWithStore(t, opts, history.NewStore(t.TempDir()))
+}
+
+// newHarnessWithStore starts the TUI with the saved conversations of store.
+func newHarnessWithStore(t *testing.T, opts tuiOptions, store *history.Store) *harness {
+	t.Helper()
+	m := initialModel(config.Config{}, store, opts)
+	h := &harness{t: t, model: &m}
+	h.send(tea.WindowSizeMsg{Width: 80, Height: 24})
+	h.run(h.model.Init())
+	return h
+}
+
+// send delivers msg and everything its commands produce.
+func (h *harness) send(msgs ...tea.Msg) {
+	h.t.Helper()
+	for _, msg := range msgs {
+		_, cmd := h.model.Update(msg)
+		h.run(cmd)
+	}
+}
+
+func (h *harness) run(cmd tea.Cmd) {
+	h.t.Helper()
+	if cmd == nil {
+		return
+	}
+	msg, ok := runWithTimeout(cmd)
+	if !ok || msg == nil {
+		return
+	}
+	if cmds, ok := batch(msg); ok {
+		for _, cmd := range cmds {
+			h.run(cmd)
+		}
+		return
+	}
+	h.send(msg)
+}
+
+// batch unpacks tea.Batch and tea.Sequence messages. The latter is not
+// exported, so it is recognized by its shape.
+func batch(msg tea.Msg) ([]tea.Cmd, bool) {
+	v := reflect.ValueOf(msg)
+	if v.Kind() != reflect.Slice || v.Type().Elem() != reflect.TypeOf(tea.Cmd(nil)) {
+		return nil, false
+	}
+	cmds := make([]tea.Cmd, v.Len())
+	for i := range cmds {
+		cmds[i] = v.Index(i).Interface().(tea.Cmd)
+	}
+	return cmds, true
+}
+
+func runWithTimeout(cmd tea.Cmd) (tea.Msg, bool) {
+	result := make(chan tea.Msg, 1)
+	go func() { result <- cmd() }()
+	select {
+	case msg := <-result:
+		return msg, true
+	case <-time.After(cmdTimeout):
+		return nil, false
+	}
+}
+
+func (h *harness) keys(keys ...string) {
+	h.t.Helper()
+	for _, k := range keys {
+		h.send(keyMsg(k))
+	}
+}
+
+func (h *harness) typeText(text string) {
+	h.t.Helper()
+	for _, r := range text {
+		h.send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+}
+
+func (h *harness) currentPage() pages.PageName {
+	return h.model.pageStack.Peek().GetPageName()
+}
+
+func (h *harness) assertPage(want pages.PageName, depth int) {
+	h.t.Helper()
+	if got := h.currentPage(); got != want {
+		h.t.Errorf("expected page %s, got %s", want, got)
+	}
+	if got := len(h.model.pageStack); got != depth {
+		h.t.Errorf("expected %d pages on the stack, got %d", depth, got)
+	}
+}
+
+// assertGolden compares the current view with testdata/<name>.golden.
+func (h *harness) assertGolden(name string) {
+	h.t.Helper()
+	got := normalize(h.model.View())
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			h.t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			h.t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		h.t.Fatalf("reading golden file, run with -update to create it: %s", err)
+	}
+	if got != string(want) {
+		h.t.Errorf("view does not match %s, run with -update to regenerate it\n--- got ---\n%s\n--- want ---\n%s", path, got, want)
+	}
+}
+
+// ansiSequence matches the styling escape codes left by renderers that don't
+// follow the lipgloss color profile, like glamour.
+var ansiSequence = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// normalize strips styling and trailing spaces, which are irrelevant to the
+// layout and easily mangled by editors.
+func normalize(view string) string {
+	view = ansiSequence.ReplaceAllString(view, "")
+	lines := strings.Split(view, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+var namedKeys = map[string]tea.KeyType{
+	"enter":      tea.KeyEnter,
+	"tab":        tea.KeyTab,
+	"up":         tea.KeyUp,
+	"down":       tea.KeyDown,
+	"left":       tea.KeyLeft,
+	"right":      tea.KeyRight,
+	"esc":        tea.KeyEsc,
+	"ctrl+b":     tea.KeyCtrlB,
+	"ctrl+h":     tea.KeyCtrlH,
+	"ctrl+r":     tea.KeyCtrlR,
+	"ctrl+left":  tea.KeyCtrlLeft,
+	"ctrl+right": tea.KeyCtrlRight,
+}
+
+func keyMsg(k string) tea.KeyMsg {
+	if k, ok := strings.CutPrefix(k, "alt+"); ok {
+		msg := keyMsg(k)
+		msg.Alt = true
+		return msg
+	}
+	if t, ok := namedKeys[k]; ok {
+		return tea.KeyMsg{Type: t}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"teachat/pkgs/config"
+	"teachat/pkgs/llmclients"
+	"teachat/pkgs/types"
+)
+
+const (
+	exitError = 1
+	exitUsage = 2
+)
+
+// usageError marks errors caused by invalid input rather than by the provider.
+type usageError struct {
+	error
+}
+
+// exitCode is the status to exit with after err, exitUsage for invalid input
+// and exitError otherwise.
+func exitCode(err error) int {
+	var uerr usageError
+	if errors.As(err, &uerr) {
+		return exitUsage
+	}
+	return exitError
+}
+
+type headlessOptions struct {
+	model   types.LLMModel
+	persona string
+	prompt  string
+	json    bool
+}
+
+type headlessResult struct {
+	Model      types.LLMModel    `json:"model"`
+	Platform   types.LLMPlatform `json:"platform"`
+	Response   string            `json:"response"`
+	Usage      *types.Usage      `json:"usage,omitempty"`
+	DurationMs int64             `json:"duration_ms"`
+}
+
+// stdinIsPiped reports whether stdin is a pipe or a file instead of a terminal.
+func stdinIsPiped() bool {
+	stat, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice == 0
+}
+
+// buildPrompt joins the question given on the command line with the content
+// piped through stdin, if any.
+func buildPrompt(question string, stdin io.Reader) (string, error) {
+	question = strings.TrimSpace(question)
+	if stdin == nil {
+		return question, nil
+	}
+	input, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", err
+	}
+	if len(input) == 0 {
+		return question, nil
+	}
+	if question == "" {
+		return string(input), nil
+	}
+	return question + "\n\n" + string(input), nil
+}
+
+// runHeadless sends a single prompt and streams the answer to stdout without
+// starting the TUI.
+func runHeadless(ctx context.Context, cfg config.Config, opts headlessOptions, stdout io.Writer) error {
+	model, err := findModel(cfg, opts.model)
+	if err != nil {
+		return err
+	}
+	if opts.prompt == "" {
+		return usageError{errors.New("empty prompt")}
+	}
+	client, err := llmclients.New(model, cfg, opts.persona)
+	if err != nil {
+		return usageError{err}
+	}
+
+	start := time.Now()
+	events, err := client.Stream(ctx, opts.prompt)
+	if err != nil {
+		return err
+	}
+
+	result := headlessResult{Model: model.Name, Platform: model.Platform}
+	for ev := range events {
+		switch ev.Type {
+		case types.TextDelta:
+			result.Response += ev.Text
+			if !opts.json {
+				fmt.Fprint(stdout, ev.Text)
+			}
+		case types.UsageEvent:
+			result.Usage = ev.Usage
+		case types.ErrorEvent:
+			return ev.Err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+
+	if opts.json {
+		return json.NewEncoder(stdout).Encode(result)
+	}
+	if !strings.HasSuffix(result.Response, "\n") {
+		fmt.Fprintln(stdout)
+	}
+	return nil
+}
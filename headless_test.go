@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"teachat/pkgs/config"
+	"teachat/pkgs/llmclients"
+	"teachat/pkgs/llminterface"
+	"teachat/pkgs/mock"
+	"teachat/pkgs/types"
+)
+
+// failing fails like a provider, when the request is sent or in the
+// stream.
+type failing struct {
+	*mock.Client
+}
+
+func (failing) Stream(ctx context.Context, prompt string) (<-chan types.StreamEvent, error) {
+	if prompt == "refused" {
+		return nil, errors.New("401 Unauthorized")
+	}
+	events := make(chan types.StreamEvent, 1)
+	events <- types.StreamEvent{Type: types.ErrorEvent, Err: errors.New("connection reset")}
+	close(events)
+	return events, nil
+}
+
+var failingModel = types.Model{Name: "failing", Platform: "failing"}
+
+// registerFailing makes failingModel available during the test.
+func registerFailing(t *testing.T) {
+	models := types.SupportedModels
+	types.SupportedModels = append(slices.Clip(models), failingModel)
+	llmclients.PlatformInitialization[failingModel.Platform] = func(stream bool, httpClient *http.Client) (llminterface.Client, error) {
+		client, _ := mock.New(stream, httpClient)
+		return failing{client.(*mock.Client)}, nil
+	}
+	t.Cleanup(func() {
+		types.SupportedModels = models
+		delete(llmclients.PlatformInitialization, failingModel.Platform)
+	})
+}
+
+func TestBuildPrompt(t *testing.T) {
+	for _, tt := range []struct {
+		name, question string
+		stdin          io.Reader
+		want           string
+	}{
+		{"question", " why? ", nil, "why?"},
+		{"stdin", "", strings.NewReader("some input\n"), "some input\n"},
+		{"both", "summarize", strings.NewReader("some input\n"), "summarize\n\nsome input\n"},
+		{"empty stdin", "why?", strings.NewReader(""), "why?"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildPrompt(tt.question, tt.stdin)
+			if err != nil || got != tt.want {
+				t.Errorf("expected %q, got %q, %v", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestRunHeadless(t *testing.T) {
+	registerFailing(t)
+	for _, tt := range []struct {
+		name string
+		cfg  config.Config
+		opts headlessOptions
+		// want is the output, or the exit code when it isn't 0
+		want string
+		code int
+	}{
+		{name: "text", opts: headlessOptions{model: mock.Name, prompt: "hi"}, want: "You said: hi\n"},
+		{name: "default model", cfg: config.Config{DefaultModel: mock.Name}, opts: headlessOptions{prompt: "hi"}, want: "You said: hi\n"},
+		{name: "no model", opts: headlessOptions{prompt: "hi"}, code: exitUsage},
+		{name: "unknown model", opts: headlessOptions{model: "gpt-9", prompt: "hi"}, code: exitUsage},
+		{name: "empty prompt", opts: headlessOptions{model: mock.Name}, code: exitUsage},
+		{name: "unknown persona", opts: headlessOptions{model: mock.Name, persona: "pirate", prompt: "hi"}, code: exitUsage},
+		{name: "request error", opts: headlessOptions{model: failingModel.Name, prompt: "refused"}, code: exitError},
+		{name: "stream error", opts: headlessOptions{model: failingModel.Name, prompt: "hi"}, code: exitError},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := runHeadless(context.Background(), tt.cfg, tt.opts, &stdout)
+			if tt.code != 0 {
+				if err == nil || exitCode(err) != tt.code {
+					t.Errorf("expected exit code %d, got %v", tt.code, err)
+				}
+				return
+			}
+			if err != nil || stdout.String() != tt.want {
+				t.Errorf("expected %q, got %q, %v", tt.want, stdout.String(), err)
+			}
+		})
+	}
+}
+
+func TestRunHeadlessJSON(t *testing.T) {
+	var stdout bytes.Buffer
+	opts := headlessOptions{model: mock.Name, prompt: "hello there", json: true}
+	if err := runHeadless(context.Background(), config.Config{}, opts, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	var result headlessResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("expected JSON, got %q: %s", stdout.String(), err)
+	}
+	if result.Model != mock.Name || result.Platform != mock.Platform || result.Response != "You said: hello there" {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if result.Usage == nil || result.Usage.PromptTokens != 2 || result.Usage.CompletionTokens != 4 {
+		t.Errorf("expected the usage of the reply, got %+v", result.Usage)
+	}
+}
@@ -3,40 +3,78 @@ package main
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
 
+	"teachat/pkgs/config"
+	"teachat/pkgs/history"
+	"teachat/pkgs/mcp"
 	"teachat/pkgs/pages"
 	"teachat/pkgs/styles"
 	"teachat/pkgs/teamsg"
+	"teachat/pkgs/types"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 type model struct {
-	ctx       context.Context
-	cancel    context.CancelFunc
-	pages     map[pages.PageName]pages.PageInterface
-	pageStack pages.Stack
-	height    int
-	width     int
+	ctx           context.Context
+	cancel        context.CancelFunc
+	pages         map[pages.PageName]pages.PageInterface
+	pageStack     pages.Stack
+	height        int
+	width         int
+	selectedModel *types.Model
+	resume        *history.Conversation
+	mcp           *mcp.Manager
+	prompts       []string
 }
 
-func initialModel() model {
+// tuiOptions preselect what would otherwise be chosen interactively.
+type tuiOptions struct {
+	model  *types.Model
+	resume *history.Conversation
+	// mcp runs the MCP servers, none by default.
+	mcp *mcp.Manager
+	// prompts are sent one after the other once the chat is open.
+	prompts []string
+}
+
+func initialModel(cfg config.Config, store *history.Store, opts tuiOptions) model {
 	ctx, cancel := context.WithCancel(context.Background())
 	helpPage := pages.NewHelpPage()
-	chatPage := pages.NewChatPage()
+	chatPage := pages.NewChatPage(cfg, store)
 	modelSelectionPage := pages.NewModelSelectionPage()
+	treePage := pages.NewTreePage()
+	historySearchPage := pages.NewHistorySearchPage(store)
+	approvalPage := pages.NewApprovalPage()
+	if opts.mcp == nil {
+		opts.mcp = mcp.NewManager(nil)
+	}
+	mcpPage := pages.NewMCPPage(opts.mcp)
+	commandPage := pages.NewCommandPage(cfg.Shell.SendOutput)
+	editsPage := pages.NewEditsPage()
 	pagesMap := map[pages.PageName]pages.PageInterface{
 		pages.ModelSelectionPage: modelSelectionPage,
 		pages.ChatPage:           chatPage,
 		pages.HelpPage:           helpPage,
+		pages.TreePage:           treePage,
+		pages.HistorySearchPage:  historySearchPage,
+		pages.ApprovalPage:       approvalPage,
+		pages.MCPPage:            mcpPage,
+		pages.CommandPage:        commandPage,
+		pages.EditsPage:          editsPage,
 	}
 	pageStack := pages.Stack{}
 	m := model{
-		ctx:       ctx,
-		cancel:    cancel,
-		pages:     pagesMap,
-		pageStack: pageStack,
+		ctx:           ctx,
+		cancel:        cancel,
+		pages:         pagesMap,
+		pageStack:     pageStack,
+		selectedModel: opts.model,
+		resume:        opts.resume,
+		mcp:           opts.mcp,
+		prompts:       opts.prompts,
 	}
 	m.addPage(pages.ModelSelectionPage)
 	return m
@@ -44,7 +82,21 @@ func initialModel() model {
 
 func (m *model) Init() tea.Cmd {
 	os.Remove("msgdebug.log")
-	return func() tea.Msg { return teamsg.GetSupportedModelsMsg(true) }
+	cmds := []tea.Cmd{func() tea.Msg { return teamsg.GetSupportedModelsMsg(true) }, m.mcpStatus}
+	if m.selectedModel != nil {
+		selectedModel := *m.selectedModel
+		cmds = append(cmds, func() tea.Msg { return teamsg.ModelSelectedMsg(selectedModel) })
+	}
+	if m.resume != nil {
+		conversation := *m.resume
+		cmds = append(cmds, func() tea.Msg { return teamsg.ConversationLoadedMsg(conversation) })
+	}
+	if len(m.prompts) > 0 && m.selectedModel != nil {
+		prompts := m.prompts
+		cmds = append(cmds, func() tea.Msg { return teamsg.QueuedPromptsMsg(prompts) })
+	}
+	// waiting for the MCP servers must not hold the sequence
+	return tea.Batch(tea.Sequence(cmds...), m.waitMCP)
 }
 
 func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -60,8 +112,23 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			return m, nil
 		case "ctrl+b":
+			switch m.pageStack.Peek().GetPageName() {
+			case pages.ApprovalPage, pages.CommandPage:
+				// leaving the dialog denies the call or cancels the command
+				return m, m.updatePages(msg)
+			}
 			m.removeCurrentPage()
 			return m, nil
+		case "ctrl+o":
+			if m.pageStack.Peek().GetPageName() != pages.MCPPage {
+				m.addPage(pages.MCPPage)
+			}
+			return m, nil
+		case "ctrl+f":
+			if m.pageStack.Peek().GetPageName() != pages.HistorySearchPage {
+				m.addPage(pages.HistorySearchPage)
+			}
+			return m, func() tea.Msg { return teamsg.OpenHistorySearchMsg{} }
 		}
 	case tea.WindowSizeMsg:
 		m.height = msg.Height
@@ -72,9 +139,56 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, nil
 	case teamsg.ModelSelectedMsg:
-		m.addPage(pages.ChatPage)
+		if m.pageStack.Peek().GetPageName() != pages.ChatPage {
+			m.addPage(pages.ChatPage)
+		}
+	case teamsg.ConversationTreeMsg:
+		if m.pageStack.Peek().GetPageName() != pages.TreePage {
+			m.addPage(pages.TreePage)
+		}
+	case teamsg.BranchSelectedMsg:
+		m.removeCurrentPage()
+	case teamsg.MCPServersMsg:
+		return m, tea.Batch(m.updatePages(msg), m.waitMCP)
+	case teamsg.MCPPromptMsg, teamsg.AttachMsg:
+		if m.pageStack.Peek().GetPageName() == pages.MCPPage {
+			m.removeCurrentPage()
+		}
+	case teamsg.ToolApprovalMsg:
+		if m.pageStack.Peek().GetPageName() != pages.ApprovalPage {
+			m.addPage(pages.ApprovalPage)
+		}
+	case teamsg.ToolApprovedMsg:
+		if m.pageStack.Peek().GetPageName() == pages.ApprovalPage {
+			m.removeCurrentPage()
+		}
+	case teamsg.EditsMsg:
+		if m.pageStack.Peek().GetPageName() != pages.EditsPage {
+			m.addPage(pages.EditsPage)
+		}
+	case teamsg.CommandProposedMsg:
+		if m.pageStack.Peek().GetPageName() != pages.CommandPage {
+			m.addPage(pages.CommandPage)
+		}
+	case teamsg.RunCommandMsg, teamsg.CommandCancelledMsg:
+		if m.pageStack.Peek().GetPageName() == pages.CommandPage {
+			m.removeCurrentPage()
+		}
+	case teamsg.SearchResultSelectedMsg:
+		// the conversation replaces the chat, with the model it used
+		m.removeCurrentPage()
+		show := teamsg.ShowMessageMsg{Index: msg.Message, Terms: msg.Terms}
+		return m, tea.Sequence(
+			func() tea.Msg { return teamsg.ModelSelectedMsg(msg.Conversation.Model) },
+			func() tea.Msg { return teamsg.ConversationLoadedMsg(msg.Conversation) },
+			func() tea.Msg { return show },
+		)
 	}
-	// update all pages
+	return m, m.updatePages(msg)
+}
+
+// updatePages delivers msg to all pages.
+func (m *model) updatePages(msg tea.Msg) tea.Cmd {
 	updatedPages := make(map[pages.PageName]pages.PageInterface)
 	var cmds []tea.Cmd
 	for _, p := range m.pages {
@@ -83,7 +197,18 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		cmds = append(cmds, cmd)
 	}
 	m.pages = updatedPages
-	return m, tea.Batch(cmds...)
+	return tea.Batch(cmds...)
+}
+
+// mcpStatus reports the status of the MCP servers.
+func (m *model) mcpStatus() tea.Msg {
+	return teamsg.MCPServersMsg{Statuses: m.mcp.Statuses(), Tools: m.mcp.Tools()}
+}
+
+// waitMCP reports the status of the MCP servers once it changes.
+func (m *model) waitMCP() tea.Msg {
+	<-m.mcp.Changed()
+	return m.mcpStatus()
 }
 
 func (m *model) View() string {
@@ -109,8 +234,9 @@ func (m *model) removeCurrentPage() {
 }
 
 func main() {
-	initialModel := initialModel()
-	if _, err := tea.NewProgram(&initialModel).Run(); err != nil {
-		fmt.Println("Error running program:", err)
+	if err := newRootCommand().Execute(); err != nil {
+		slog.Error("command failed", "error", err)
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
 	}
 }
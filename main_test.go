@@ -0,0 +1,457 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"teachat/pkgs/config"
+	"teachat/pkgs/history"
+	"teachat/pkgs/mcp"
+	"teachat/pkgs/mcp/mcptest"
+	"teachat/pkgs/mock"
+	"teachat/pkgs/pages"
+	"teachat/pkgs/teamsg"
+	"teachat/pkgs/types"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestModelSelection(t *testing.T) {
+	h := newHarness(t, tuiOptions{})
+	h.assertPage(pages.ModelSelectionPage, 1)
+	h.assertGolden("modelselection")
+
+	h.keys("down", "down")
+	h.assertGolden("modelselection_moved")
+}
+
+func TestSelectModelOpensChat(t *testing.T) {
+	h := newHarness(t, tuiOptions{})
+	h.keys("down", "down", "down", "down", "enter")
+	h.assertPage(pages.ChatPage, 2)
+	h.assertGolden("chat_empty")
+}
+
+func TestChatStreamsReply(t *testing.T) {
+	h := newHarness(t, tuiOptions{model: &mock.Model})
+	h.assertPage(pages.ChatPage, 2)
+	h.typeText("hello there")
+	h.assertGolden("chat_typing")
+
+	h.keys("enter")
+	h.assertGolden("chat_reply")
+}
+
+func TestPageStack(t *testing.T) {
+	h := newHarness(t, tuiOptions{model: &mock.Model})
+	h.typeText("hello")
+	h.keys("enter")
+
+	h.keys("ctrl+h")
+	h.assertPage(pages.HelpPage, 3)
+	h.assertGolden("help")
+
+	// help is not pushed twice
+	h.keys("ctrl+h")
+	h.assertPage(pages.HelpPage, 3)
+
+	h.keys("ctrl+b")
+	h.assertPage(pages.ChatPage, 2)
+	h.assertGolden("chat_back_from_help")
+
+	h.keys("ctrl+b")
+	h.assertPage(pages.ModelSelectionPage, 1)
+	h.assertGolden("modelselection_back_from_chat")
+}
+
+// TestHelp keeps the whole help in a golden file, to be updated with the
+// key bindings.
+func TestHelp(t *testing.T) {
+	h := newHarness(t, tuiOptions{model: &mock.Model})
+	h.send(tea.WindowSizeMsg{Width: 100, Height: 120})
+	h.keys("ctrl+h")
+	h.assertPage(pages.HelpPage, 3)
+	h.assertGolden("help_full")
+}
+
+func TestChatLayout(t *testing.T) {
+	h := newHarness(t, tuiOptions{model: &mock.Model})
+	h.typeText("hello")
+	h.keys("enter")
+
+	h.keys("alt+l")
+	h.assertGolden("chat_vertical")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Layout.Mode != "vertical" {
+		t.Errorf("expected the layout to be saved, got %+v", cfg.Layout)
+	}
+
+	h.keys("alt+l", "alt+down", "alt+down")
+	h.assertGolden("chat_prompt_bottom")
+
+	h.keys("tab", "alt+z")
+	h.assertGolden("chat_maximized")
+}
+
+func TestChatLayoutStacksWhenNarrow(t *testing.T) {
+	h := newHarness(t, tuiOptions{model: &mock.Model})
+	h.send(tea.WindowSizeMsg{Width: 50, Height: 24})
+	h.typeText("hello")
+	h.keys("enter")
+	h.assertGolden("chat_narrow")
+}
+
+func TestRegenerateReply(t *testing.T) {
+	h := newHarness(t, tuiOptions{model: &mock.Model})
+	h.typeText("hello")
+	h.keys("enter", "ctrl+r")
+	h.assertGolden("chat_regenerated")
+
+	h.keys("ctrl+left")
+	h.assertGolden("chat_first_alternative")
+}
+
+func TestPromptWhileRegenerating(t *testing.T) {
+	store := history.NewStore(t.TempDir())
+	h := newHarnessWithStore(t, tuiOptions{model: &mock.Model}, store)
+	h.typeText("a")
+	h.keys("enter")
+	// the new reply is still being received when the next prompt is sent
+	h.model.Update(keyMsg("ctrl+r"))
+	h.typeText("b")
+	h.keys("enter")
+
+	conversations, err := store.List()
+	if err != nil || len(conversations) != 1 {
+		t.Fatalf("expected a saved conversation, got %d, %v", len(conversations), err)
+	}
+	var got []string
+	for _, m := range conversations[0].Messages {
+		got = append(got, fmt.Sprintf("%s %q", m.Role, m.Content))
+	}
+	want := []string{`user "a"`, `assistant "You said: a"`, `user "b"`, `assistant "You said: b"`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestEditForksConversation(t *testing.T) {
+	h := newHarness(t, tuiOptions{model: &mock.Model})
+	h.typeText("hello")
+	h.keys("enter")
+	h.typeText("second")
+	h.keys("enter")
+
+	// select the second prompt and edit it
+	h.keys("tab", "[", "[")
+	h.assertGolden("chat_message_selected")
+	h.keys("e")
+	h.typeText(" again")
+	h.keys("enter")
+	h.assertGolden("chat_edited")
+
+	h.keys("ctrl+t")
+	h.assertPage(pages.TreePage, 3)
+	h.assertGolden("tree")
+
+	// back to the reply of the original prompt
+	h.keys("up", "up", "enter")
+	h.assertPage(pages.ChatPage, 2)
+	h.assertGolden("chat_branch_switched")
+}
+
+func TestMessageActions(t *testing.T) {
+	h := newHarness(t, tuiOptions{model: &mock.Model})
+	h.typeText("hello")
+	h.keys("enter")
+
+	// exclude the prompt and fold the reply
+	h.keys("tab", "g", "d", "p", "G", "c")
+	h.assertGolden("chat_message_actions")
+
+	h.keys("q")
+	h.assertGolden("chat_quoted")
+}
+
+func TestSearchConversation(t *testing.T) {
+	h := newHarness(t, tuiOptions{model: &mock.Model})
+	h.typeText("hello")
+	h.keys("enter", "tab", "/")
+	h.typeText("hello")
+	h.keys("enter", "n")
+	h.assertGolden("chat_search")
+}
+
+func TestHistorySearch(t *testing.T) {
+	store := history.NewStore(t.TempDir())
+	updated := time.Date(2024, 5, 3, 10, 0, 0, 0, time.UTC)
+	for _, c := range []history.Conversation{
+		{ID: "nats", Model: mock.Model, UpdatedAt: updated, Tags: []string{"infra"}, Messages: []types.Message{
+			{Role: types.UserRole, Content: "How do I run a message broker?"},
+			{Role: types.AssistantRole, Content: "Start nats-server with a config file listing the cluster routes."},
+		}},
+		{ID: "cooking", Model: mock.Model, UpdatedAt: updated.Add(time.Hour), Messages: []types.Message{
+			{Role: types.UserRole, Content: "A recipe for pancakes"},
+			{Role: types.AssistantRole, Content: "Mix flour, eggs and milk."},
+		}},
+	} {
+		if err := store.Save(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := newHarnessWithStore(t, tuiOptions{}, store)
+	h.keys("ctrl+f")
+	h.assertPage(pages.HistorySearchPage, 2)
+	h.typeText("nats config")
+	h.assertGolden("history_search")
+
+	h.keys("enter")
+	h.assertPage(pages.ChatPage, 2)
+	h.assertGolden("chat_search_result")
+}
+
+func TestEditTitle(t *testing.T) {
+	store := history.NewStore(t.TempDir())
+	h := newHarnessWithStore(t, tuiOptions{model: &mock.Model}, store)
+	h.typeText("hello")
+	h.keys("enter", "ctrl+e")
+	h.assertGolden("chat_edit_title")
+
+	h.typeText(" there #greeting")
+	h.keys("enter")
+	conversations, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversations) != 1 {
+		t.Fatalf("expected a saved conversation, got %d", len(conversations))
+	}
+	if c := conversations[0]; c.Title() != "hello there" || len(c.Tags) != 1 || c.Tags[0] != "greeting" {
+		t.Errorf("expected the edited title and tags to be saved, got %q %q", c.Title(), c.Tags)
+	}
+}
+
+func TestToolCall(t *testing.T) {
+	h := newHarness(t, tuiOptions{model: &mock.Model})
+	h.typeText(`call grep {"pattern": "^module", "path": "go.mod"}`)
+	h.keys("enter")
+	h.assertGolden("chat_tool_call")
+}
+
+func TestToolApproval(t *testing.T) {
+	h := newHarness(t, tuiOptions{model: &mock.Model})
+	call := `call list_dir {"path": "/nonexistent"}`
+	h.typeText(call)
+	h.keys("enter")
+	h.assertPage(pages.ApprovalPage, 3)
+	h.assertGolden("tool_approval")
+
+	h.keys("s")
+	h.assertPage(pages.ChatPage, 2)
+	h.assertGolden("chat_tool_approved")
+
+	// allowed for the session
+	h.typeText(call)
+	h.keys("enter")
+	h.assertPage(pages.ChatPage, 2)
+}
+
+// fakeMCP starts the fake MCP server, through a shell so that the command
+// shown doesn't depend on the location of the test binary.
+func fakeMCP(t *testing.T) *mcp.Manager {
+	t.Helper()
+	m := mcp.NewManager(map[string]config.MCPServer{"fake": {
+		Command: "sh",
+		Args:    []string{"-c", `exec "$FAKE_MCP_BIN"`},
+		Env:     map[string]string{mcptest.EnvVar: "1", "FAKE_MCP_BIN": os.Args[0]},
+	}})
+	t.Cleanup(m.Close)
+	m.Start()
+	timeout := time.After(5 * time.Second)
+	for {
+		s := m.Statuses()[0]
+		if s.State == mcp.Running && len(s.Stderr) > 0 {
+			return m
+		}
+		select {
+		case <-m.Changed():
+		case <-timeout:
+			t.Fatalf("the fake MCP server didn't start: %+v", s)
+		}
+	}
+}
+
+func TestMCP(t *testing.T) {
+	manager := fakeMCP(t)
+	h := newHarness(t, tuiOptions{model: &mock.Model, mcp: manager})
+	h.send(h.model.mcpStatus())
+	h.keys("ctrl+o")
+	h.assertPage(pages.MCPPage, 3)
+	h.assertGolden("mcp_servers")
+
+	// attach the resource
+	h.keys("down", "down", "enter")
+	h.assertPage(pages.ChatPage, 2)
+	h.typeText("summarize")
+	h.keys("enter")
+	h.assertGolden("chat_mcp_resource")
+
+	// the tools of the server are offered to the model
+	h.typeText(`call fake__echo {"text": "hi"}`)
+	h.keys("enter")
+	if view := normalize(h.model.View()); !strings.Contains(view, "fake__echo said: hi") {
+		t.Errorf("expected the tool of the server to answer, got\n%s", view)
+	}
+
+	// fill the prompt template
+	h.keys("ctrl+o", "up", "enter")
+	h.typeText("name=Ada")
+	h.keys("enter")
+	h.assertPage(pages.ChatPage, 2)
+	// the prompt pane is narrow
+	if view := normalize(h.model.View()); !strings.Contains(view, "Say hello to") || !strings.Contains(view, "Ada.") {
+		t.Errorf("expected the prompt in the chat prompt, got\n%s", view)
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	h := newHarness(t, tuiOptions{model: &mock.Model})
+	h.typeText("!hello world")
+	h.keys("enter")
+	h.assertPage(pages.CommandPage, 3)
+	h.assertGolden("command_proposed")
+
+	// the output is only shown
+	h.keys("enter")
+	h.assertPage(pages.ChatPage, 2)
+	h.assertGolden("chat_command_output")
+
+	// the output is sent to the model, after editing the command
+	h.typeText("!again")
+	h.keys("enter", "tab")
+	h.typeText(" and more")
+	h.keys("enter")
+	if view := normalize(h.model.View()); !strings.Contains(view, "You said: $ echo again and more") {
+		t.Errorf("expected the output to be sent to the model, got\n%s", view)
+	}
+
+	// cancelled
+	h.typeText("!nothing")
+	h.keys("enter", "esc")
+	h.assertPage(pages.ChatPage, 2)
+	if view := normalize(h.model.View()); strings.Contains(view, "$ echo nothing") {
+		t.Errorf("expected the command not to run, got\n%s", view)
+	}
+}
+
+func TestApplyEdits(t *testing.T) {
+	conversation := history.New(mock.Model, "")
+	conversation.Append(types.Message{Role: types.UserRole, Content: "Fix the greeting"})
+	conversation.Append(types.Message{Role: types.AssistantRole, Content: "Here:\n\n```diff\n" +
+		"--- a/greet.txt\n+++ b/greet.txt\n@@ -1,2 +1,2 @@\n-hello\n+hi\n world\n" +
+		"--- /dev/null\n+++ b/notes.txt\n@@ -0,0 +1 @@\n+remember\n```"})
+	h := newHarness(t, tuiOptions{model: &mock.Model, resume: &conversation})
+	if view := normalize(h.model.View()); !strings.Contains(view, "AI: (edits)") {
+		t.Errorf("expected the reply to be noted as having edits, got\n%s", view)
+	}
+	h.keys("tab", "G", "a")
+	h.assertPage(pages.EditsPage, 3)
+	// greet.txt doesn't exist here
+	h.assertGolden("edits")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "greet.txt"), []byte("hello\nworld\n"), 0o644)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	h.keys("ctrl+b", "a")
+	h.assertPage(pages.EditsPage, 3)
+	h.keys("enter")
+	if view := normalize(h.model.View()); !strings.Contains(view, "applied 2 hunks to 2 files") {
+		t.Errorf("expected the edits to be applied, got\n%s", view)
+	}
+	if bts, _ := os.ReadFile("greet.txt"); string(bts) != "hi\nworld\n" {
+		t.Errorf("unexpected greet.txt %q", bts)
+	}
+
+	h.keys("u")
+	if bts, _ := os.ReadFile("greet.txt"); string(bts) != "hello\nworld\n" {
+		t.Errorf("expected greet.txt back, got %q", bts)
+	}
+	if _, err := os.Stat("notes.txt"); !os.IsNotExist(err) {
+		t.Errorf("expected notes.txt to be removed, got %v", err)
+	}
+}
+
+func TestQueuedPrompts(t *testing.T) {
+	h := newHarness(t, tuiOptions{model: &mock.Model, prompts: []string{"first part\nof a diff", "second part"}})
+	h.assertPage(pages.ChatPage, 2)
+	view := normalize(h.model.View())
+	for _, want := range []string{"You said: first part", "You said: second part"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("expected %q, got\n%s", want, view)
+		}
+	}
+	// the prompts are folded
+	if !strings.Contains(view, "first part (2 lines)") {
+		t.Errorf("expected the prompt to be folded, got\n%s", view)
+	}
+}
+
+// TestReplyBehindAnotherPage opens a page while a reply is streamed, the
+// reply goes on behind it.
+func TestReplyBehindAnotherPage(t *testing.T) {
+	for _, open := range []string{"ctrl+t", "ctrl+f", "ctrl+o", "ctrl+h"} {
+		t.Run(open, func(t *testing.T) {
+			h := newHarness(t, tuiOptions{model: &mock.Model})
+			_, stream := h.model.Update(teamsg.ChatPromptMsg("hello"))
+			h.keys(open)
+			h.run(stream)
+			h.keys("ctrl+b")
+			h.assertPage(pages.ChatPage, 2)
+			if view := normalize(h.model.View()); !strings.Contains(view, "You said: hello") {
+				t.Errorf("expected the reply to be received, got\n%s", view)
+			}
+		})
+	}
+}
+
+// TestToolsBehindAnotherPage opens a page while a tool or a shell command
+// runs, its result is still sent to the model.
+func TestToolsBehindAnotherPage(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	h := newHarness(t, tuiOptions{model: &mock.Model})
+	_, run := h.model.Update(teamsg.ChatPromptMsg(`call grep {"pattern": "^module", "path": "go.mod"}`))
+	h.keys("ctrl+h")
+	h.run(run)
+	h.keys("ctrl+b")
+	if view := normalize(h.model.View()); !strings.Contains(view, "grep said: go.mod:1:module teachat") {
+		t.Errorf("expected the tool result to be sent to the model, got\n%s", view)
+	}
+
+	h.typeText("!hello world")
+	h.keys("enter", "tab")
+	h.assertPage(pages.CommandPage, 3)
+	_, run = h.model.Update(teamsg.RunCommandMsg{Command: "echo hello world", SendOutput: true})
+	h.assertPage(pages.ChatPage, 2)
+	h.keys("ctrl+h")
+	h.run(run)
+	h.keys("ctrl+b")
+	if view := normalize(h.model.View()); !strings.Contains(view, "You said: $ echo hello world") {
+		t.Errorf("expected the output to be sent to the model, got\n%s", view)
+	}
+}
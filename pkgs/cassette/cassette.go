@@ -0,0 +1,121 @@
+// Package cassette records the HTTP traffic between teachat and the providers
+// and replays it later, with the original or an accelerated timing. Response
+// bodies are kept as the raw chunks read from the wire (NDJSON for Ollama,
+// SSE for OpenAI) so that streaming behaviour can be reproduced offline.
+package cassette
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Cassette is the content of a cassette file.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+type Response struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Chunks  []Chunk     `json:"chunks"`
+}
+
+// Chunk is a piece of the response body as it was read, Offset is the time
+// elapsed since the request was sent.
+type Chunk struct {
+	OffsetMicros int64  `json:"offset_us"`
+	Data         string `json:"data"`
+}
+
+func (c Chunk) Offset() time.Duration {
+	return time.Duration(c.OffsetMicros) * time.Microsecond
+}
+
+// Load reads a cassette file.
+func Load(path string) (*Cassette, error) {
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(bts, &c); err != nil {
+		return nil, fmt.Errorf("parsing cassette %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to path, creating parent directories as needed.
+func (c *Cassette) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	bts, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, bts, 0o600)
+}
+
+// Mode selects how NewHTTPClient wraps the transport.
+type Mode string
+
+const (
+	ModeRecord Mode = "record"
+	ModeReplay Mode = "replay"
+)
+
+// NewHTTPClient returns an http.Client recording to or replaying from the
+// cassette at path. speed only applies to replays, see NewReplayer.
+func NewHTTPClient(mode Mode, path string, speed float64) (*http.Client, error) {
+	switch mode {
+	case ModeRecord:
+		return &http.Client{Transport: NewRecorder(path, http.DefaultTransport)}, nil
+	case ModeReplay:
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Client{Transport: NewReplayer(c, speed)}, nil
+	}
+	return nil, fmt.Errorf("unknown cassette mode %q", mode)
+}
+
+var errNoInteraction = errors.New("no recorded interaction")
+
+// redactedHeaders are never written to a cassette.
+var redactedHeaders = []string{"Authorization", "Api-Key", "Openai-Organization", "Cookie", "Set-Cookie"}
+
+func cleanHeaders(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range redactedHeaders {
+		h.Del(name)
+	}
+	return h
+}
+
+// requestKey identifies a request by method and path, ignoring the host so
+// that cassettes can be replayed against any provider address.
+func requestKey(method, rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return method + " " + u.Path
+	}
+	return method + " " + rawURL
+}
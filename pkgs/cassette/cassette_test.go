@@ -0,0 +1,77 @@
+package cassette
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "{\"n\":%d}\n", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recording := &http.Client{Transport: NewRecorder(path, http.DefaultTransport)}
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/chat", strings.NewReader(`{"model":"llama3"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := recording.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Interactions) != 1 {
+		t.Fatalf("expected 1 interaction, got %d", len(c.Interactions))
+	}
+	interaction := c.Interactions[0]
+	if interaction.Request.Body != `{"model":"llama3"}` {
+		t.Errorf("unexpected request body %q", interaction.Request.Body)
+	}
+	if interaction.Request.Headers.Get("Authorization") != "" {
+		t.Errorf("expected the Authorization header to be redacted")
+	}
+	if chunks := interaction.Response.Chunks; len(chunks) < 3 || chunks[len(chunks)-1].Offset() < 40*time.Millisecond {
+		t.Errorf("expected the chunks to be recorded with their timing, got %+v", chunks)
+	}
+
+	for _, speed := range []float64{0, 1} {
+		replaying := &http.Client{Transport: NewReplayer(c, speed)}
+		start := time.Now()
+		// the host is ignored when matching
+		resp, err := replaying.Post("http://localhost:1/api/chat", "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replayed, _ := io.ReadAll(resp.Body)
+		elapsed := time.Since(start)
+		if string(replayed) != string(recorded) {
+			t.Errorf("speed %v: expected %q, got %q", speed, recorded, replayed)
+		}
+		if speed == 1 && elapsed < 40*time.Millisecond {
+			t.Errorf("expected the original timing to be kept, took %s", elapsed)
+		}
+		if speed == 0 && elapsed > 20*time.Millisecond {
+			t.Errorf("expected an instant replay, took %s", elapsed)
+		}
+		if _, err := replaying.Post("http://localhost:1/api/chat", "application/json", nil); err == nil {
+			t.Errorf("expected an error once the interactions are used up")
+		}
+	}
+}
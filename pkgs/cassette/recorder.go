@@ -0,0 +1,99 @@
+package cassette
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Recorder is an http.RoundTripper saving every interaction to a cassette
+// file once its response body has been fully read or closed.
+type Recorder struct {
+	mu       sync.Mutex
+	path     string
+	next     http.RoundTripper
+	cassette Cassette
+}
+
+func NewRecorder(path string, next http.RoundTripper) *Recorder {
+	return &Recorder{path: path, next: next}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		recorder:   r,
+		start:      start,
+		interaction: Interaction{
+			Request: Request{
+				Method:  req.Method,
+				URL:     req.URL.String(),
+				Headers: cleanHeaders(req.Header),
+				Body:    string(body),
+			},
+			Response: Response{
+				Status:  resp.StatusCode,
+				Headers: cleanHeaders(resp.Header),
+			},
+		},
+	}
+	return resp, nil
+}
+
+func (r *Recorder) add(interaction Interaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	if err := r.cassette.Save(r.path); err != nil {
+		slog.Error("saving cassette", "path", r.path, "error", err)
+	}
+}
+
+// recordingBody keeps every chunk read by the client along with its timing.
+type recordingBody struct {
+	io.ReadCloser
+	recorder    *Recorder
+	start       time.Time
+	interaction Interaction
+	once        sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.interaction.Response.Chunks = append(b.interaction.Response.Chunks, Chunk{
+			OffsetMicros: time.Since(b.start).Microseconds(),
+			Data:         string(p[:n]),
+		})
+	}
+	if err == io.EOF {
+		b.commit()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.commit()
+	return b.ReadCloser.Close()
+}
+
+func (b *recordingBody) commit() {
+	b.once.Do(func() { b.recorder.add(b.interaction) })
+}
@@ -0,0 +1,113 @@
+package cassette
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Replayer is an http.RoundTripper answering requests from a cassette.
+// Interactions are matched by method and URL, in the order they were
+// recorded.
+type Replayer struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+	speed    float64
+}
+
+// NewReplayer replays c. A speed of 1 keeps the recorded timing, 10 plays ten
+// times faster and 0 returns the chunks without any delay.
+func NewReplayer(c *Cassette, speed float64) *Replayer {
+	return &Replayer{cassette: c, used: make([]bool, len(c.Interactions)), speed: speed}
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	interaction, err := r.next(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+		StatusCode: interaction.Response.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     interaction.Response.Headers.Clone(),
+		Body: &replayBody{
+			ctx:    req.Context(),
+			chunks: interaction.Response.Chunks,
+			start:  time.Now(),
+			speed:  r.speed,
+		},
+		ContentLength: -1,
+		Request:       req,
+	}, nil
+}
+
+func (r *Replayer) next(req *http.Request) (Interaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := requestKey(req.Method, req.URL.String())
+	for i, interaction := range r.cassette.Interactions {
+		if !r.used[i] && requestKey(interaction.Request.Method, interaction.Request.URL) == key {
+			r.used[i] = true
+			return interaction, nil
+		}
+	}
+	return Interaction{}, fmt.Errorf("%w for %s", errNoInteraction, key)
+}
+
+// replayBody hands out the recorded chunks, waiting until each one is due.
+type replayBody struct {
+	ctx     context.Context
+	chunks  []Chunk
+	pending string
+	start   time.Time
+	speed   float64
+}
+
+func (b *replayBody) Read(p []byte) (int, error) {
+	if b.pending == "" {
+		if len(b.chunks) == 0 {
+			return 0, io.EOF
+		}
+		chunk := b.chunks[0]
+		b.chunks = b.chunks[1:]
+		if err := b.wait(chunk.Offset()); err != nil {
+			return 0, err
+		}
+		b.pending = chunk.Data
+	}
+	n := copy(p, b.pending)
+	b.pending = b.pending[n:]
+	return n, nil
+}
+
+func (b *replayBody) wait(offset time.Duration) error {
+	if b.speed <= 0 {
+		return b.ctx.Err()
+	}
+	delay := time.Duration(float64(offset)/b.speed) - time.Since(b.start)
+	if delay <= 0 {
+		return b.ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-b.ctx.Done():
+		return b.ctx.Err()
+	}
+}
+
+func (b *replayBody) Close() error {
+	return nil
+}
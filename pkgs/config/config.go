@@ -0,0 +1,412 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"teachat/pkgs/types"
+	"time"
+)
+
+// Config is the user configuration shared by the TUI and the headless mode.
+// It is read from $TEACHAT_CONFIG or, by default, from
+// $XDG_CONFIG_HOME/teachat/config.json.
+type Config struct {
+	// DefaultModel is used when no model is given on the command line.
+	DefaultModel types.LLMModel `json:"default_model,omitempty"`
+
+	// UtilityModel answers the requests made in the background, like naming
+	// conversations. A cheap or local model is a good fit. Defaults to the
+	// model of the chat.
+	UtilityModel types.LLMModel `json:"utility_model,omitempty"`
+
+	// Persona is the name of the persona used when none is given on the
+	// command line.
+	Persona string `json:"persona,omitempty"`
+
+	// Personas maps a persona name to the system prompt sent to the model.
+	Personas map[string]string `json:"personas,omitempty"`
+
+	// Parameters are the sampling parameters sent with every request.
+	Parameters types.Parameters `json:"parameters,omitempty"`
+
+	// Serve configures the OpenAI compatible server started by `teachat serve`.
+	Serve Serve `json:"serve,omitempty"`
+
+	// Log configures the application log.
+	Log Log `json:"log,omitempty"`
+
+	// Context configures how conversations are fitted in the context window
+	// of the models.
+	Context Context `json:"context,omitempty"`
+
+	// Layout is the arrangement of the chat page panes. It is saved when
+	// changed from the TUI.
+	Layout Layout `json:"layout,omitempty"`
+
+	// Tools configures the tools offered to the models able to call them.
+	Tools Tools `json:"tools,omitempty"`
+
+	// MCPServers maps a name to a Model Context Protocol server whose tools,
+	// prompts and resources are offered in the chat.
+	MCPServers map[string]MCPServer `json:"mcp_servers,omitempty"`
+
+	// Shell configures the commands proposed by the models and run once
+	// confirmed.
+	Shell Shell `json:"shell,omitempty"`
+}
+
+type Shell struct {
+	// TimeoutSeconds is how long a command may run before it is killed.
+	// Defaults to 60.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+
+	// SendOutput sends the output of the commands to the model by default,
+	// for it to go on from there.
+	SendOutput bool `json:"send_output,omitempty"`
+}
+
+const defaultShellTimeout = 60 * time.Second
+
+// ShellTimeout returns how long a command may run.
+func (c Config) ShellTimeout() time.Duration {
+	if c.Shell.TimeoutSeconds > 0 {
+		return time.Duration(c.Shell.TimeoutSeconds) * time.Second
+	}
+	return defaultShellTimeout
+}
+
+// MCPServer is started with Command, talking over its standard input and
+// output, or reached at URL with the streamable HTTP transport.
+type MCPServer struct {
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	// Headers are sent with every HTTP request, like an authorization.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Disabled servers are not started.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+type Tools struct {
+	// Disabled lists the tools not offered to the models, "all" turns tool
+	// calling off.
+	Disabled []string `json:"disabled,omitempty"`
+
+	// MaxRounds is the number of times in a row the model may call tools
+	// before its reply is stopped. Defaults to 8.
+	MaxRounds int `json:"max_rounds,omitempty"`
+
+	// Permissions maps a tool name to allow, ask or deny, "*" giving the
+	// rule of the tools not listed. By default the read-only tools are
+	// allowed and the others asked.
+	Permissions map[string]string `json:"permissions,omitempty"`
+
+	// Paths lists the files and directories the tools may access without
+	// asking. Defaults to the working directory.
+	Paths []string `json:"paths,omitempty"`
+
+	// Commands lists the commands the tools may run without asking, like
+	// "ls" or "git status", matched on the leading words.
+	Commands []string `json:"commands,omitempty"`
+
+	// Audit is the file recording the tool calls and the decisions made
+	// about them. Defaults to $XDG_STATE_HOME/teachat/audit.log.
+	Audit string `json:"audit,omitempty"`
+}
+
+const defaultToolRounds = 8
+
+// ToolEnabled reports whether the tool with the given name is offered.
+func (c Config) ToolEnabled(name string) bool {
+	for _, disabled := range c.Tools.Disabled {
+		if disabled == name || disabled == "all" {
+			return false
+		}
+	}
+	return true
+}
+
+// ToolRounds returns the number of tool calls answered in a row.
+func (c Config) ToolRounds() int {
+	if c.Tools.MaxRounds == 0 {
+		return defaultToolRounds
+	}
+	return c.Tools.MaxRounds
+}
+
+type Layout struct {
+	// Mode is horizontal, vertical or prompt-bottom. Defaults to horizontal.
+	Mode string `json:"mode,omitempty"`
+
+	// Ratio is the share of the space given to the conversation, between 0
+	// and 1. Defaults to 0.75.
+	Ratio float64 `json:"ratio,omitempty"`
+
+	// StackBelow is the width under which a horizontal layout is stacked
+	// with the prompt at the bottom. Defaults to 60 columns.
+	StackBelow int `json:"stack_below,omitempty"`
+}
+
+type Context struct {
+	// Strategy is drop-oldest, keep-pinned or summary, which replaces the
+	// oldest turns with a summary written by the utility model. Defaults to
+	// keep-pinned.
+	Strategy string `json:"strategy,omitempty"`
+
+	// Windows overrides the context window of models, in tokens.
+	Windows map[types.LLMModel]int `json:"windows,omitempty"`
+
+	// Reserve is the number of tokens kept for the reply. Defaults to
+	// parameters.max_tokens, or 1024.
+	Reserve int `json:"reserve,omitempty"`
+
+	// WarnAt is the share of the context window from which a warning is
+	// shown. Defaults to 0.8.
+	WarnAt float64 `json:"warn_at,omitempty"`
+}
+
+const (
+	// DefaultContextWindow is assumed for the models without a known
+	// context window.
+	DefaultContextWindow = 4096
+	defaultStrategy      = "keep-pinned"
+	defaultReserve       = 1024
+	defaultWarnAt        = 0.8
+)
+
+// ContextWindow returns the number of tokens model accepts.
+func (c Config) ContextWindow(model types.Model) int {
+	if n := c.Context.Windows[model.Name]; n > 0 {
+		return n
+	}
+	if model.ContextWindow > 0 {
+		return model.ContextWindow
+	}
+	return DefaultContextWindow
+}
+
+// ContextStrategy returns the configured strategy or the default one.
+func (c Config) ContextStrategy() string {
+	if c.Context.Strategy == "" {
+		return defaultStrategy
+	}
+	return c.Context.Strategy
+}
+
+// ContextReserve returns the number of tokens kept for the reply.
+func (c Config) ContextReserve() int {
+	switch {
+	case c.Context.Reserve > 0:
+		return c.Context.Reserve
+	case c.Parameters.MaxTokens > 0:
+		return c.Parameters.MaxTokens
+	}
+	return defaultReserve
+}
+
+// ContextWarnAt returns the share of the context window from which a
+// warning is shown.
+func (c Config) ContextWarnAt() float64 {
+	if c.Context.WarnAt == 0 {
+		return defaultWarnAt
+	}
+	return c.Context.WarnAt
+}
+
+type Log struct {
+	// Level is one of debug, info, warn or error. Defaults to info.
+	Level string `json:"level,omitempty"`
+
+	// Path of the log file, defaults to $XDG_STATE_HOME/teachat/teachat.log.
+	Path string `json:"path,omitempty"`
+
+	// Format is text or json. Defaults to text.
+	Format string `json:"format,omitempty"`
+
+	// MaxSizeMB is the size at which the log file is rotated. Defaults to 10.
+	MaxSizeMB int `json:"max_size_mb,omitempty"`
+
+	// MaxBackups is the number of rotated files kept. Defaults to 3.
+	MaxBackups int `json:"max_backups,omitempty"`
+
+	// RedactContent replaces prompts and replies with their size in the log.
+	RedactContent bool `json:"redact_content,omitempty"`
+}
+
+type Serve struct {
+	// Addr is the address the server listens on.
+	Addr string `json:"addr,omitempty"`
+
+	// Aliases maps a model name accepted by the server to a supported model,
+	// e.g. "gpt-4o": "llama3" to answer gpt-4o requests with a local model.
+	Aliases map[string]types.LLMModel `json:"aliases,omitempty"`
+}
+
+// Path returns the location of the configuration file.
+func Path() (string, error) {
+	if path := os.Getenv("TEACHAT_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "teachat", "config.json"), nil
+}
+
+// Load reads the configuration file. A missing file is not an error, the
+// zero Config is returned instead.
+func Load() (Config, error) {
+	var cfg Config
+	path, err := Path()
+	if err != nil {
+		return cfg, err
+	}
+	bts, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(bts, &cfg); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Update applies fn to the configuration file and writes it back. Only the
+// file content is changed, settings given on the command line are not saved.
+func Update(fn func(*Config)) error {
+	cfg, err := Load()
+	if err != nil {
+		return err
+	}
+	fn(&cfg)
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	bts, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(bts, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Validate reports every problem found in the configuration.
+func (c Config) Validate() error {
+	var errs []error
+	if c.DefaultModel != "" {
+		if _, ok := types.FindModel(c.DefaultModel); !ok {
+			errs = append(errs, fmt.Errorf("default_model: model %q is not supported", c.DefaultModel))
+		}
+	}
+	if c.UtilityModel != "" {
+		if _, ok := types.FindModel(c.UtilityModel); !ok {
+			errs = append(errs, fmt.Errorf("utility_model: model %q is not supported", c.UtilityModel))
+		}
+	}
+	if c.Persona != "" {
+		if _, ok := c.Personas[c.Persona]; !ok {
+			errs = append(errs, fmt.Errorf("persona: persona %q not found in personas", c.Persona))
+		}
+	}
+	if t := c.Parameters.Temperature; t != nil && (*t < 0 || *t > 2) {
+		errs = append(errs, fmt.Errorf("parameters.temperature: %v is outside [0, 2]", *t))
+	}
+	if p := c.Parameters.TopP; p != nil && (*p < 0 || *p > 1) {
+		errs = append(errs, fmt.Errorf("parameters.top_p: %v is outside [0, 1]", *p))
+	}
+	for alias, model := range c.Serve.Aliases {
+		if _, ok := types.FindModel(model); !ok {
+			errs = append(errs, fmt.Errorf("serve.aliases.%s: model %q is not supported", alias, model))
+		}
+	}
+	switch c.Log.Level {
+	case "", "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level: unknown level %q", c.Log.Level))
+	}
+	switch c.Log.Format {
+	case "", "text", "json":
+	default:
+		errs = append(errs, fmt.Errorf("log.format: unknown format %q", c.Log.Format))
+	}
+	switch c.Context.Strategy {
+	case "", "drop-oldest", "keep-pinned", "summary":
+	default:
+		errs = append(errs, fmt.Errorf("context.strategy: unknown strategy %q", c.Context.Strategy))
+	}
+	for model, n := range c.Context.Windows {
+		if n <= 0 {
+			errs = append(errs, fmt.Errorf("context.windows.%s: %d is not positive", model, n))
+		}
+	}
+	if c.Context.Reserve < 0 {
+		errs = append(errs, fmt.Errorf("context.reserve: %d is negative", c.Context.Reserve))
+	}
+	if w := c.Context.WarnAt; w < 0 || w > 1 {
+		errs = append(errs, fmt.Errorf("context.warn_at: %v is outside [0, 1]", w))
+	}
+	switch c.Layout.Mode {
+	case "", "horizontal", "vertical", "prompt-bottom":
+	default:
+		errs = append(errs, fmt.Errorf("layout.mode: unknown mode %q", c.Layout.Mode))
+	}
+	if r := c.Layout.Ratio; r < 0 || r >= 1 {
+		errs = append(errs, fmt.Errorf("layout.ratio: %v is outside (0, 1)", r))
+	}
+	if c.Layout.StackBelow < 0 {
+		errs = append(errs, fmt.Errorf("layout.stack_below: %d is negative", c.Layout.StackBelow))
+	}
+	if c.Parameters.MaxTokens < 0 {
+		errs = append(errs, fmt.Errorf("parameters.max_tokens: %d is negative", c.Parameters.MaxTokens))
+	}
+	if c.Tools.MaxRounds < 0 {
+		errs = append(errs, fmt.Errorf("tools.max_rounds: %d is negative", c.Tools.MaxRounds))
+	}
+	for name, server := range c.MCPServers {
+		if (server.Command == "") == (server.URL == "") {
+			errs = append(errs, fmt.Errorf("mcp_servers.%s: exactly one of command and url is required", name))
+		}
+	}
+	if c.Shell.TimeoutSeconds < 0 {
+		errs = append(errs, fmt.Errorf("shell.timeout_seconds: %d is negative", c.Shell.TimeoutSeconds))
+	}
+	for tool, rule := range c.Tools.Permissions {
+		switch rule {
+		case "allow", "ask", "deny":
+		default:
+			errs = append(errs, fmt.Errorf("tools.permissions.%s: unknown rule %q", tool, rule))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SystemPrompt returns the system prompt of the given persona, falling back
+// to the configured default persona when name is empty.
+func (c Config) SystemPrompt(name string) (string, error) {
+	if name == "" {
+		name = c.Persona
+	}
+	if name == "" {
+		return "", nil
+	}
+	prompt, ok := c.Personas[name]
+	if !ok {
+		return "", fmt.Errorf("persona %q not found", name)
+	}
+	return prompt, nil
+}
@@ -0,0 +1,134 @@
+package git
+
+import (
+	"strings"
+	"teachat/pkgs/tokens"
+)
+
+// Chunk is a part of a diff small enough to be sent to a model.
+type Chunk struct {
+	// Files are the paths of the files changed in the chunk.
+	Files []string
+	Diff  string
+}
+
+// fileDiff is the diff of a file.
+type fileDiff struct {
+	path string
+	text string
+}
+
+// Split cuts diff in chunks of at most budget tokens, as counted by
+// counter. Files are kept together when they fit, larger ones are cut
+// between hunks, their header repeated in every chunk. A single line larger
+// than the budget is left whole.
+func Split(diff string, budget int, counter tokens.Counter) []Chunk {
+	var chunks []Chunk
+	var current Chunk
+	used := 0
+	for _, f := range splitFiles(diff) {
+		for _, part := range fit(f.text, budget, counter) {
+			n := counter.Count(part)
+			if used+n > budget && current.Diff != "" {
+				chunks = append(chunks, current)
+				current, used = Chunk{}, 0
+			}
+			if len(current.Files) == 0 || current.Files[len(current.Files)-1] != f.path {
+				current.Files = append(current.Files, f.path)
+			}
+			current.Diff += part
+			used += n
+		}
+	}
+	if current.Diff != "" {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+// splitFiles cuts a git diff before every file.
+func splitFiles(diff string) []fileDiff {
+	var files []fileDiff
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if strings.HasPrefix(line, "diff --git ") || len(files) == 0 {
+			files = append(files, fileDiff{path: diffPath(line)})
+		}
+		files[len(files)-1].text += line
+	}
+	if len(files) == 1 && strings.TrimSpace(files[0].text) == "" {
+		return nil
+	}
+	return files
+}
+
+// diffPath reads the path of the new file on the diff --git line.
+func diffPath(line string) string {
+	line = strings.TrimSpace(strings.TrimPrefix(line, "diff --git "))
+	if i := strings.LastIndex(line, " b/"); i >= 0 {
+		return line[i+3:]
+	}
+	return line
+}
+
+// fit cuts the diff of a file in parts of at most budget tokens, between
+// hunks or, for hunks too large, between lines.
+func fit(text string, budget int, counter tokens.Counter) []string {
+	if counter.Count(text) <= budget {
+		return []string{text}
+	}
+	lines := strings.SplitAfter(text, "\n")
+	header := 0
+	for header < len(lines) && !strings.HasPrefix(lines[header], "@@") {
+		header++
+	}
+	head := strings.Join(lines[:header], "")
+	var hunks []string
+	for _, line := range lines[header:] {
+		if strings.HasPrefix(line, "@@") || len(hunks) == 0 {
+			hunks = append(hunks, "")
+		}
+		hunks[len(hunks)-1] += line
+	}
+	var parts []string
+	for _, hunk := range hunks {
+		pieces := []string{hunk}
+		if counter.Count(head+hunk) > budget {
+			hunkLines := strings.SplitAfter(hunk, "\n")
+			// the lines go after the header of the file and of the hunk
+			pieces = pack(head+hunkLines[0], hunkLines[1:], budget, counter)
+			parts = append(parts, pieces...)
+			continue
+		}
+		parts = append(parts, pieces...)
+	}
+	return pack(head, parts, budget, counter)
+}
+
+// pack joins pieces after head while they fit in budget. Pieces already
+// starting with head are left as they are.
+func pack(head string, pieces []string, budget int, counter tokens.Counter) []string {
+	var packed []string
+	current := ""
+	for _, piece := range pieces {
+		if strings.HasPrefix(piece, head) && head != "" {
+			if current != "" {
+				packed = append(packed, current)
+				current = ""
+			}
+			packed = append(packed, piece)
+			continue
+		}
+		if current != "" && counter.Count(current+piece) > budget {
+			packed = append(packed, current)
+			current = ""
+		}
+		if current == "" {
+			current = head
+		}
+		current += piece
+	}
+	if current != "" {
+		packed = append(packed, current)
+	}
+	return packed
+}
@@ -0,0 +1,57 @@
+// Package git reads diffs from git for the models to write commit messages
+// and reviews. Large diffs are split in chunks fitting the context window.
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// run runs git with args in dir and returns its output.
+func run(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// diffArgs leave out colors and external diff tools, the output is read by
+// the models.
+var diffArgs = []string{"diff", "--no-color", "--no-ext-diff"}
+
+// StagedDiff returns the changes staged for the next commit.
+func StagedDiff(ctx context.Context, dir string) (string, error) {
+	return run(ctx, dir, append(diffArgs, "--staged")...)
+}
+
+// Diff returns the changes of revisions, like main..HEAD, or the changes
+// not committed yet when revisions is empty.
+func Diff(ctx context.Context, dir, revisions string) (string, error) {
+	if revisions == "" {
+		revisions = "HEAD"
+	}
+	return run(ctx, dir, append(diffArgs, revisions, "--")...)
+}
+
+// CommitCommand is the command committing the staged changes with message.
+// When edit is set git opens the editor of the user on the message first,
+// the standard streams of the command must then be the terminal.
+func CommitCommand(ctx context.Context, dir, message string, edit bool) *exec.Cmd {
+	args := []string{"commit", "--message", message}
+	if edit {
+		args = append(args, "--edit")
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	return cmd
+}
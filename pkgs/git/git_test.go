@@ -0,0 +1,111 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"teachat/pkgs/mock"
+	"teachat/pkgs/tokens"
+	"testing"
+)
+
+func fileDiffText(path string, hunks ...string) string {
+	text := "diff --git a/" + path + " b/" + path + "\n--- a/" + path + "\n+++ b/" + path + "\n"
+	for i, h := range hunks {
+		text += "@@ -" + string(rune('1'+i)) + " +" + string(rune('1'+i)) + " @@\n" + h
+	}
+	return text
+}
+
+func TestSplit(t *testing.T) {
+	small := fileDiffText("a.go", "-old\n+new\n")
+	large := fileDiffText("b.go", strings.Repeat("+line of b\n", 40), strings.Repeat("+more of b\n", 20))
+	diff := small + large + fileDiffText("c.go", "+c\n")
+	counter := tokens.Heuristic{}
+
+	if chunks := Split(diff, 10_000, counter); len(chunks) != 1 || chunks[0].Diff != diff {
+		t.Fatalf("expected the diff in a single chunk, got %+v", chunks)
+	}
+	budget := 80
+	chunks := Split(diff, budget, counter)
+	if len(chunks) < 3 {
+		t.Fatalf("expected the large file to be split, got %d chunks", len(chunks))
+	}
+	var joined []string
+	for _, c := range chunks {
+		if n := counter.Count(c.Diff); n > budget {
+			t.Errorf("chunk of %d tokens over the budget:\n%s", n, c.Diff)
+		}
+		if !strings.HasPrefix(c.Diff, "diff --git ") {
+			t.Errorf("expected the chunk to start with a file header:\n%s", c.Diff)
+		}
+		joined = append(joined, c.Files...)
+	}
+	if !reflect.DeepEqual(chunks[0].Files, []string{"a.go", "b.go"}) && !reflect.DeepEqual(chunks[0].Files, []string{"a.go"}) {
+		t.Errorf("unexpected files in the first chunk %q", chunks[0].Files)
+	}
+	if joined[len(joined)-1] != "c.go" {
+		t.Errorf("expected the last file in the last chunk, got %q", joined)
+	}
+	// every line of the diff is in a chunk
+	var all string
+	for _, c := range chunks {
+		all += c.Diff
+	}
+	for _, line := range strings.Split(diff, "\n") {
+		if !strings.Contains(all, line) {
+			t.Errorf("line %q lost", line)
+		}
+	}
+	if Split("", budget, counter) != nil {
+		t.Error("expected no chunk for an empty diff")
+	}
+}
+
+func TestCommitMessage(t *testing.T) {
+	client := &mock.Client{Reply: "```text\nfeat: greet in French\n\nBonjour.\n```"}
+	chunks := []Chunk{{Files: []string{"a.go"}, Diff: "+a\n"}, {Files: []string{"b.go"}, Diff: "+b\n"}}
+	message, err := CommitMessage(context.Background(), client, chunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message != "feat: greet in French\n\nBonjour." {
+		t.Errorf("unexpected message %q", message)
+	}
+	if _, err := CommitMessage(context.Background(), client, nil); err == nil {
+		t.Error("expected an error without changes")
+	}
+}
+
+func TestStagedDiff(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	ctx := context.Background()
+	if _, err := run(ctx, dir, "init", "--quiet"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if diff, err := StagedDiff(ctx, dir); err != nil || diff != "" {
+		t.Fatalf("expected nothing staged, got %q, %v", diff, err)
+	}
+	if _, err := run(ctx, dir, "add", "hello.txt"); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := StagedDiff(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunks := Split(diff, 1000, tokens.Heuristic{}); len(chunks) != 1 || !reflect.DeepEqual(chunks[0].Files, []string{"hello.txt"}) {
+		t.Errorf("unexpected chunks %+v of\n%s", chunks, diff)
+	}
+	if _, err := Diff(ctx, dir, "no-such-revision"); err == nil || !strings.Contains(err.Error(), "git diff") {
+		t.Errorf("expected the git error, got %v", err)
+	}
+}
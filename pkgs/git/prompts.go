@@ -0,0 +1,106 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"teachat/pkgs/llminterface"
+	"teachat/pkgs/tokens"
+)
+
+const commitPrompt = `Write a commit message in the Conventional Commits format for the changes
+below: a subject line like "feat(parser): support comments" of at most 72
+characters, a blank line, then a short body telling what changed and why,
+wrapped at 72 columns. Reply with the message only, without code block.`
+
+const partPrompt = `Summarize the changes of this part of a diff in a few bullet points, naming
+the files and what changed in them. They will be used to write the commit
+message of the whole diff.`
+
+const reviewPrompt = `Review the diff below like an experienced reviewer would. Reply in Markdown
+with this structure:
+
+## Summary
+What the changes do, in two or three sentences.
+
+## path/of/a/file
+- L<line>: a comment on that line of the new file, for every bug, risk or
+  improvement worth raising. Leave out the files with nothing to say.
+
+## Verdict
+Whether the changes can be merged as they are, or what must be done first.`
+
+// minBudget keeps chunks of a useful size when the context window is
+// small.
+const minBudget = 512
+
+// Budget returns the number of tokens left for the diff in a prompt, once
+// the instructions are counted, when window tokens are available.
+func Budget(window int, counter tokens.Counter) int {
+	instructions := max(counter.Count(commitPrompt), counter.Count(partPrompt), counter.Count(reviewPrompt))
+	// the part headers and separators
+	return max(window-instructions-64, minBudget)
+}
+
+// ReviewPrompt asks for the review of chunk, the part-th of parts.
+func ReviewPrompt(chunk Chunk, part, parts int) string {
+	prompt := reviewPrompt
+	if parts > 1 {
+		prompt += fmt.Sprintf("\n\nThis is part %d of %d of the diff, the other parts are reviewed separately.", part, parts)
+	}
+	return prompt + "\n\n```diff\n" + chunk.Diff + "```"
+}
+
+// CommitMessage asks client for the commit message of the changes in
+// chunks. When there are several, each one is summarized first and the
+// message written from the summaries.
+func CommitMessage(ctx context.Context, client llminterface.Client, chunks []Chunk) (string, error) {
+	if len(chunks) == 0 {
+		return "", errors.New("no changes")
+	}
+	changes := "```diff\n" + chunks[0].Diff + "```"
+	if len(chunks) > 1 {
+		var sb strings.Builder
+		sb.WriteString("Summaries of the parts of the diff:\n")
+		for i, chunk := range chunks {
+			summary, err := ask(ctx, client, partPrompt+"\n\n```diff\n"+chunk.Diff+"```")
+			if err != nil {
+				return "", fmt.Errorf("summarizing part %d of %d: %w", i+1, len(chunks), err)
+			}
+			fmt.Fprintf(&sb, "\nPart %d, %s:\n%s\n", i+1, strings.Join(chunk.Files, ", "), summary)
+		}
+		changes = sb.String()
+	}
+	message, err := ask(ctx, client, commitPrompt+"\n\n"+changes)
+	if err != nil {
+		return "", err
+	}
+	message = cleanMessage(message)
+	if message == "" {
+		return "", errors.New("the model returned an empty commit message")
+	}
+	return message, nil
+}
+
+// ask sends prompt on its own and returns the reply.
+func ask(ctx context.Context, client llminterface.Client, prompt string) (string, error) {
+	client.SetMessages(nil)
+	events, err := client.Stream(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	reply, _, err := llminterface.Collect(ctx, events)
+	return strings.TrimSpace(reply), err
+}
+
+// cleanMessage removes the code block models put messages in anyway.
+func cleanMessage(message string) string {
+	message = strings.TrimSpace(message)
+	if strings.HasPrefix(message, "```") && strings.HasSuffix(message, "```") {
+		message = strings.TrimSuffix(message, "```")
+		// the fence line may name a language
+		_, message, _ = strings.Cut(message, "\n")
+	}
+	return strings.TrimSpace(message)
+}
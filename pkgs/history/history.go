@@ -0,0 +1,237 @@
+package history
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"teachat/pkgs/types"
+	"teachat/pkgs/utils"
+	"time"
+)
+
+// ErrNotFound is returned when a conversation does not exist in the store.
+var ErrNotFound = errors.New("conversation not found")
+
+// Conversation is a chat session as saved on disk.
+type Conversation struct {
+	ID        string          `json:"id"`
+	Model     types.Model     `json:"model"`
+	Persona   string          `json:"persona,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Messages  []types.Message `json:"messages"`
+
+	// Name is the title given by the model or the user, Title falls back
+	// to the first prompt without it.
+	Name string   `json:"title,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+
+	// Summary stands for the oldest messages when they no longer fit in
+	// the context window of the model.
+	Summary *Summary `json:"summary,omitempty"`
+
+	// Nodes is the whole conversation tree, Messages being the path
+	// leading to Leaf. Older files only have Messages.
+	Nodes []Node `json:"nodes,omitempty"`
+	Leaf  int    `json:"leaf,omitempty"`
+}
+
+// Summary is a summary of the messages up to the node Through, pinned ones
+// excepted.
+type Summary struct {
+	Text    string `json:"text"`
+	Through int    `json:"through"`
+}
+
+// New starts an empty conversation with model.
+func New(model types.Model, persona string) Conversation {
+	now := time.Now()
+	return Conversation{
+		ID:        newID(now),
+		Model:     model,
+		Persona:   persona,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// newID names a conversation started at now. The random suffix tells apart
+// the conversations started at once, by scripts running headless.
+func newID(now time.Time) string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return now.Format("20060102-150405.000") + "-" + hex.EncodeToString(suffix)
+}
+
+// Title is a one line description of the conversation, its name or else its
+// first user message.
+func (c Conversation) Title() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	for _, m := range c.Messages {
+		if m.Role == types.UserRole {
+			title, _, _ := strings.Cut(strings.TrimSpace(m.Content), "\n")
+			if runes := []rune(title); len(runes) > 60 {
+				title = string(runes[:57]) + "..."
+			}
+			return title
+		}
+	}
+	return "(empty)"
+}
+
+// HasTag reports whether the conversation is tagged with tag, ignoring case.
+func (c Conversation) HasTag(tag string) bool {
+	for _, t := range c.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Markdown renders the conversation as a markdown document.
+func (c Conversation) Markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", c.Title())
+	fmt.Fprintf(&sb, "- ID: %s\n", c.ID)
+	fmt.Fprintf(&sb, "- Model: %s (%s)\n", c.Model.Name, c.Model.Platform)
+	if c.Persona != "" {
+		fmt.Fprintf(&sb, "- Persona: %s\n", c.Persona)
+	}
+	fmt.Fprintf(&sb, "- Created: %s\n", c.CreatedAt.Format(time.RFC3339))
+	if len(c.Tags) > 0 {
+		fmt.Fprintf(&sb, "- Tags: %s\n", strings.Join(c.Tags, ", "))
+	}
+	for _, m := range c.Messages {
+		sb.WriteString("\n")
+		sb.WriteString(MessageMarkdown(m))
+	}
+	return sb.String()
+}
+
+// MessageMarkdown renders a single message as a markdown section.
+func MessageMarkdown(m types.Message) string {
+	var heading string
+	switch m.Role {
+	case types.UserRole:
+		heading = "You"
+	case types.AssistantRole:
+		heading = "AI"
+	case types.ToolRole:
+		return fmt.Sprintf("## Tool %s\n\n```\n%s\n```\n", m.Name, strings.TrimSpace(m.Content))
+	default:
+		heading = string(m.Role)
+	}
+	text := strings.TrimSpace(m.Content)
+	for _, call := range m.ToolCalls {
+		text = strings.TrimSpace(fmt.Sprintf("%s\n\nCalls `%s` with `%s`", text, call.Name, call.Arguments))
+	}
+	return fmt.Sprintf("## %s\n\n%s\n", heading, text)
+}
+
+// Store keeps conversations as JSON files in a directory.
+type Store struct {
+	dir string
+}
+
+// DefaultDir returns $XDG_DATA_HOME/teachat/history.
+func DefaultDir() (string, error) {
+	dir, err := utils.XDGDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history"), nil
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// OpenDefault opens the store in DefaultDir.
+func OpenDefault() (*Store, error) {
+	dir, err := DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(dir), nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id)+".json")
+}
+
+// Save writes the conversation, replacing any previous version.
+func (s *Store) Save(c Conversation) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	bts, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path(c.ID) + ".tmp"
+	if err := os.WriteFile(tmp, bts, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(c.ID))
+}
+
+// Load reads the conversation with the given ID.
+func (s *Store) Load(id string) (Conversation, error) {
+	var c Conversation
+	bts, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return c, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(bts, &c); err != nil {
+		return c, fmt.Errorf("parsing conversation %s: %w", id, err)
+	}
+	return c, nil
+}
+
+// List returns all saved conversations, most recently updated first.
+func (s *Store) List() ([]Conversation, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var conversations []Conversation
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if e.IsDir() || !ok {
+			continue
+		}
+		c, err := s.Load(id)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, c)
+	}
+	sort.Slice(conversations, func(i, j int) bool {
+		return conversations[i].UpdatedAt.After(conversations[j].UpdatedAt)
+	})
+	return conversations, nil
+}
+
+// Delete removes the conversation with the given ID.
+func (s *Store) Delete(id string) error {
+	err := os.Remove(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return err
+}
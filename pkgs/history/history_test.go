@@ -0,0 +1,126 @@
+package history
+
+import (
+	"strings"
+	"testing"
+
+	"teachat/pkgs/types"
+)
+
+func user(content string) types.Message {
+	return types.Message{Role: types.UserRole, Content: content}
+}
+
+func assistant(content string) types.Message {
+	return types.Message{Role: types.AssistantRole, Content: content}
+}
+
+func contents(messages []types.Message) []string {
+	var out []string
+	for _, m := range messages {
+		out = append(out, m.Content)
+	}
+	return out
+}
+
+func assertPath(t *testing.T, c Conversation, want ...string) {
+	t.Helper()
+	got := contents(c.Messages)
+	if len(got) != len(want) {
+		t.Fatalf("expected path %q, got %q", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected path %q, got %q", want, got)
+		}
+	}
+}
+
+func TestFork(t *testing.T) {
+	c := New(types.Model{Name: types.Llama3, Platform: types.Ollama}, "")
+	c.Append(user("hi"))
+	c.Append(assistant("hello"))
+	c.Append(user("how are you?"))
+	c.Append(assistant("fine"))
+
+	// edit the second prompt
+	c.Fork(2, user("what time is it?"))
+	c.Append(assistant("noon"))
+	assertPath(t, c, "hi", "hello", "what time is it?", "noon")
+	if pos, count := c.Siblings(2); pos != 1 || count != 2 {
+		t.Errorf("expected the edit to be the second of two branches, got %d/%d", pos+1, count)
+	}
+
+	// regenerate the last reply
+	c.Fork(3, assistant("twelve"))
+	assertPath(t, c, "hi", "hello", "what time is it?", "twelve")
+
+	// back to the first branch, which keeps its replies
+	if !c.SelectSibling(2, -1) {
+		t.Fatal("expected the previous branch to be selected")
+	}
+	assertPath(t, c, "hi", "hello", "how are you?", "fine")
+	if c.SelectSibling(2, -1) {
+		t.Error("expected no branch before the first one")
+	}
+
+	store := NewStore(t.TempDir())
+	if err := store.Save(c); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.Load(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Nodes) != 7 {
+		t.Errorf("expected the whole tree to be saved, got %d nodes", len(loaded.Nodes))
+	}
+	loaded.SetLeaf(6)
+	assertPath(t, loaded, "hi", "hello", "what time is it?", "noon")
+}
+
+func TestTitle(t *testing.T) {
+	for _, tt := range []struct {
+		name, prompt, want string
+	}{
+		{"short", "  hi\nthere", "hi"},
+		{"long", strings.Repeat("a", 61), strings.Repeat("a", 57) + "..."},
+		{"non-ASCII", strings.Repeat("é", 61), strings.Repeat("é", 57) + "..."},
+		{"non-ASCII fitting", strings.Repeat("日本", 30), strings.Repeat("日本", 30)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Conversation{Messages: []types.Message{user(tt.prompt)}}
+			if got := c.Title(); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTreeFromMessages(t *testing.T) {
+	// conversations saved before branching only have messages
+	c := Conversation{Messages: []types.Message{user("hi"), assistant("hello")}}
+	c.Fork(1, assistant("hey"))
+	assertPath(t, c, "hi", "hey")
+	if len(c.Children(1)) != 2 {
+		t.Errorf("expected two replies to the first message, got %v", c.Children(1))
+	}
+}
+
+func TestConversationsStartedAtOnce(t *testing.T) {
+	store := NewStore(t.TempDir())
+	for i := 0; i < 10; i++ {
+		c := New(types.Model{Name: types.Llama3, Platform: types.Ollama}, "")
+		c.Append(types.Message{Role: types.UserRole, Content: "hello"})
+		if err := store.Save(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conversations, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversations) != 10 {
+		t.Errorf("expected every conversation to be kept, got %d", len(conversations))
+	}
+}
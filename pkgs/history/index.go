@@ -0,0 +1,351 @@
+package history
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"teachat/pkgs/types"
+	"time"
+	"unicode"
+)
+
+// Query selects saved conversations. Text is matched against the messages
+// and titles, every term has to be found in the conversation. The other
+// fields are filters, left empty they match everything.
+type Query struct {
+	Text     string
+	Model    types.LLMModel
+	Platform types.LLMPlatform
+	Tag      string
+	// Since and Until bound the last update of the conversation.
+	Since time.Time
+	Until time.Time
+}
+
+// ParseQuery reads a query typed on a single line, where filters are given
+// as model:, platform:, tag:, since: and until: terms, dates being written
+// 2006-01-02. Anything else is searched text.
+func ParseQuery(s string) (Query, error) {
+	var q Query
+	var text []string
+	for _, field := range strings.Fields(s) {
+		name, value, ok := strings.Cut(field, ":")
+		if !ok || value == "" {
+			text = append(text, field)
+			continue
+		}
+		var err error
+		switch name {
+		case "model":
+			q.Model = types.LLMModel(value)
+		case "platform":
+			q.Platform = types.LLMPlatform(value)
+		case "tag":
+			q.Tag = value
+		case "since":
+			q.Since, err = ParseDate(value)
+		case "until":
+			q.Until, err = ParseDate(value)
+			// until includes the whole day
+			q.Until = q.Until.AddDate(0, 0, 1)
+		default:
+			text = append(text, field)
+		}
+		if err != nil {
+			return q, err
+		}
+	}
+	q.Text = strings.Join(text, " ")
+	return q, nil
+}
+
+// Terms returns the words of the searched text as they are matched.
+func (q Query) Terms() []string {
+	return tokenize(q.Text)
+}
+
+// ParseDate reads a date written 2006-01-02 in the local time zone.
+func ParseDate(s string) (time.Time, error) {
+	t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// matches reports whether c passes the filters of the query.
+func (q Query) matches(c *Conversation) bool {
+	switch {
+	case q.Model != "" && c.Model.Name != q.Model:
+		return false
+	case q.Platform != "" && c.Model.Platform != q.Platform:
+		return false
+	case !q.Since.IsZero() && c.UpdatedAt.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !c.UpdatedAt.Before(q.Until):
+		return false
+	case q.Tag != "" && !c.HasTag(q.Tag):
+		return false
+	}
+	return true
+}
+
+// Result is a conversation matching a query, with the message matching
+// best. Hits are the ranges of the query terms in Snippet.
+type Result struct {
+	Conversation Conversation
+	Message      int
+	Score        float64
+	Snippet      string
+	Hits         [][2]int
+}
+
+// posting tells how often a term is used in a message.
+type posting struct {
+	conversation int
+	message      int
+	count        int
+}
+
+// Index is an inverted index over the messages of conversations, each
+// message being scored on its own with BM25.
+type Index struct {
+	conversations []Conversation
+	postings      map[string][]posting
+	// lengths are the number of terms of every message, total their sum
+	// and messages their number.
+	lengths  [][]int
+	total    int
+	messages int
+}
+
+// titleMessage is the message index under which titles are indexed.
+const titleMessage = -1
+
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// titleBoost weighs matches in the title against matches in messages.
+	titleBoost = 2
+	// prefixWeight weighs terms only starting with a query term.
+	prefixWeight = 0.5
+	snippetRunes = 160
+)
+
+// NewIndex indexes conversations.
+func NewIndex(conversations []Conversation) *Index {
+	idx := &Index{postings: make(map[string][]posting)}
+	for _, c := range conversations {
+		idx.add(c)
+	}
+	return idx
+}
+
+// Index indexes every conversation of the store.
+func (s *Store) Index() (*Index, error) {
+	conversations, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	return NewIndex(conversations), nil
+}
+
+func (idx *Index) add(c Conversation) {
+	ci := len(idx.conversations)
+	idx.conversations = append(idx.conversations, c)
+	lengths := make([]int, len(c.Messages))
+	for mi, m := range c.Messages {
+		lengths[mi] = idx.addText(ci, mi, m.Content)
+	}
+	idx.lengths = append(idx.lengths, lengths)
+	idx.messages += len(lengths)
+	idx.addText(ci, titleMessage, c.Title()+" "+strings.Join(c.Tags, " "))
+}
+
+func (idx *Index) addText(conversation, message int, text string) int {
+	counts := make(map[string]int)
+	terms := tokenize(text)
+	for _, term := range terms {
+		counts[term]++
+	}
+	for term, count := range counts {
+		idx.postings[term] = append(idx.postings[term], posting{conversation, message, count})
+	}
+	if message != titleMessage {
+		idx.total += len(terms)
+	}
+	return len(terms)
+}
+
+// Len returns the number of indexed conversations.
+func (idx *Index) Len() int {
+	return len(idx.conversations)
+}
+
+// Search returns the conversations matching q, best first. Without text the
+// filtered conversations are returned by last update.
+func (idx *Index) Search(q Query) []Result {
+	terms := q.Terms()
+	if len(terms) == 0 {
+		var results []Result
+		for _, c := range idx.conversations {
+			if q.matches(&c) {
+				results = append(results, Result{Conversation: c, Message: titleMessage, Snippet: c.Title()})
+			}
+		}
+		sortResults(results)
+		return results
+	}
+
+	// scores[conversation][message] sums the scores of the terms, found
+	// counts the terms found in each conversation
+	scores := make(map[int]map[int]float64)
+	found := make(map[int]int)
+	for _, term := range terms {
+		seen := make(map[int]bool)
+		for indexed, weight := range idx.expand(term) {
+			for _, p := range idx.postings[indexed] {
+				if !q.matches(&idx.conversations[p.conversation]) {
+					continue
+				}
+				if scores[p.conversation] == nil {
+					scores[p.conversation] = make(map[int]float64)
+				}
+				scores[p.conversation][p.message] += weight * idx.score(p, len(idx.postings[indexed]))
+				seen[p.conversation] = true
+			}
+		}
+		for ci := range seen {
+			found[ci]++
+		}
+	}
+
+	var results []Result
+	for ci, messages := range scores {
+		if found[ci] < len(terms) {
+			continue
+		}
+		r := Result{Conversation: idx.conversations[ci], Message: titleMessage}
+		best := math.Inf(-1)
+		for mi, score := range messages {
+			r.Score += score
+			if mi != titleMessage && (score > best || score == best && mi < r.Message) {
+				best = score
+				r.Message = mi
+			}
+		}
+		text := r.Conversation.Title()
+		if r.Message != titleMessage {
+			text = r.Conversation.Messages[r.Message].Content
+		}
+		r.Snippet, r.Hits = snippet(text, terms)
+		results = append(results, r)
+	}
+	sortResults(results)
+	return results
+}
+
+// expand returns the indexed terms matching term, either exactly or by
+// prefix, with their weight.
+func (idx *Index) expand(term string) map[string]float64 {
+	expanded := map[string]float64{}
+	if _, ok := idx.postings[term]; ok {
+		expanded[term] = 1
+	}
+	for indexed := range idx.postings {
+		if indexed != term && strings.HasPrefix(indexed, term) {
+			expanded[indexed] = prefixWeight
+		}
+	}
+	return expanded
+}
+
+// score is the BM25 score of a posting, df being the number of postings of
+// the term.
+func (idx *Index) score(p posting, df int) float64 {
+	n := idx.messages
+	idf := math.Log(1 + (float64(n)-float64(df)+0.5)/(float64(df)+0.5))
+	if p.message == titleMessage {
+		return titleBoost * idf
+	}
+	avg := float64(idx.total) / float64(max(n, 1))
+	length := float64(idx.lengths[p.conversation][p.message])
+	tf := float64(p.count)
+	return idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*length/max(avg, 1)))
+}
+
+func sortResults(results []Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Conversation.UpdatedAt.After(results[j].Conversation.UpdatedAt)
+	})
+}
+
+// tokenize splits text into lowercase words.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// snippet cuts the part of text around the first term found, on a single
+// line, and returns the ranges of the terms in it.
+func snippet(text string, terms []string) (string, [][2]int) {
+	text = strings.Join(strings.Fields(text), " ")
+	lower := strings.ToLower(text)
+	first := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, term); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	runes := []rune(text)
+	start := 0
+	if first > 0 {
+		// keep some context before the hit
+		start = max(len([]rune(text[:first]))-snippetRunes/4, 0)
+	}
+	end := min(start+snippetRunes, len(runes))
+	cut := string(runes[start:end])
+	if start > 0 {
+		cut = "…" + cut
+	}
+	if end < len(runes) {
+		cut += "…"
+	}
+	// ToLower may change the length of some runes, in which case the hits
+	// are simply not highlighted
+	var hits [][2]int
+	lowerCut := strings.ToLower(cut)
+	if len(lowerCut) != len(cut) {
+		return cut, nil
+	}
+	for _, term := range terms {
+		for offset := 0; ; {
+			i := strings.Index(lowerCut[offset:], term)
+			if i < 0 {
+				break
+			}
+			hits = append(hits, [2]int{offset + i, offset + i + len(term)})
+			offset += i + len(term)
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i][0] < hits[j][0] })
+	return cut, mergeHits(hits)
+}
+
+// mergeHits joins overlapping ranges of sorted hits.
+func mergeHits(hits [][2]int) [][2]int {
+	var merged [][2]int
+	for _, h := range hits {
+		if n := len(merged); n > 0 && h[0] <= merged[n-1][1] {
+			merged[n-1][1] = max(merged[n-1][1], h[1])
+			continue
+		}
+		merged = append(merged, h)
+	}
+	return merged
+}
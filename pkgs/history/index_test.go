@@ -0,0 +1,90 @@
+package history
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"teachat/pkgs/types"
+)
+
+func conversation(id string, model types.Model, updated time.Time, messages ...types.Message) Conversation {
+	return Conversation{ID: id, Model: model, UpdatedAt: updated, Messages: messages}
+}
+
+func searchIndex() *Index {
+	llama := types.Model{Name: types.Llama3, Platform: types.Ollama}
+	gpt := types.Model{Name: types.GPT4o, Platform: types.OpenAI}
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 12, 0, 0, 0, time.Local) }
+	nats := conversation("nats", llama, day(3),
+		user("How do I set up a NATS server?"),
+		assistant("Write a config file with the listen port and the cluster routes, then start nats-server -c nats.conf."),
+	)
+	nats.Tags = []string{"infra"}
+	return NewIndex([]Conversation{
+		nats,
+		conversation("go", gpt, day(10),
+			user("Explain goroutines"),
+			assistant("Goroutines are lightweight threads, they are often used with NATS clients too."),
+		),
+		conversation("cooking", gpt, day(20), user("A recipe for pancakes"), assistant("Mix flour, eggs and milk.")),
+	})
+}
+
+func ids(results []Result) []string {
+	var out []string
+	for _, r := range results {
+		out = append(out, r.Conversation.ID)
+	}
+	return out
+}
+
+func TestSearch(t *testing.T) {
+	idx := searchIndex()
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"nats config", []string{"nats"}},
+		{"nats", []string{"nats", "go"}},
+		{"NATS platform:openai", []string{"go"}},
+		{"nats model:llama3", []string{"nats"}},
+		{"tag:infra", []string{"nats"}},
+		{"since:2024-05-04", []string{"cooking", "go"}},
+		{"until:2024-05-10", []string{"go", "nats"}},
+		{"goroutine", []string{"go"}},
+		{"kubernetes", nil},
+	} {
+		q, err := ParseQuery(tc.query)
+		if err != nil {
+			t.Fatalf("parsing %q: %v", tc.query, err)
+		}
+		if got := ids(idx.Search(q)); strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%q: expected %v, got %v", tc.query, tc.want, got)
+		}
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	results := searchIndex().Search(Query{Text: "cluster routes"})
+	if len(results) != 1 {
+		t.Fatalf("expected a result, got %d", len(results))
+	}
+	r := results[0]
+	if r.Message != 1 {
+		t.Errorf("expected the reply to match best, got message %d", r.Message)
+	}
+	var hits []string
+	for _, h := range r.Hits {
+		hits = append(hits, r.Snippet[h[0]:h[1]])
+	}
+	if strings.Join(hits, ",") != "cluster,routes" {
+		t.Errorf("expected the terms to be highlighted, got %q in %q", hits, r.Snippet)
+	}
+}
+
+func TestParseQueryInvalidDate(t *testing.T) {
+	if _, err := ParseQuery("since:yesterday"); err == nil {
+		t.Error("expected an error for an invalid date")
+	}
+}
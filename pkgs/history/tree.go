@@ -0,0 +1,170 @@
+package history
+
+import (
+	"sort"
+	"teachat/pkgs/types"
+)
+
+// Node is a message of the conversation tree. IDs start at 1 and follow the
+// order of creation, Parent is 0 for the first messages.
+type Node struct {
+	ID      int           `json:"id"`
+	Parent  int           `json:"parent,omitempty"`
+	Message types.Message `json:"message"`
+
+	// Pinned messages are kept when the context has to be shortened.
+	Pinned bool `json:"pinned,omitempty"`
+	// Excluded messages are shown but not sent to the model.
+	Excluded bool `json:"excluded,omitempty"`
+}
+
+// ensureTree builds the tree of a conversation only having Messages.
+func (c *Conversation) ensureTree() {
+	if len(c.Nodes) > 0 || len(c.Messages) == 0 {
+		return
+	}
+	for i, m := range c.Messages {
+		c.Nodes = append(c.Nodes, Node{ID: i + 1, Parent: i, Message: m})
+	}
+	c.Leaf = len(c.Nodes)
+}
+
+func (c *Conversation) node(id int) *Node {
+	return &c.Nodes[id-1]
+}
+
+func (c *Conversation) add(parent int, m types.Message) {
+	id := len(c.Nodes) + 1
+	c.Nodes = append(c.Nodes, Node{ID: id, Parent: parent, Message: m})
+	c.Leaf = id
+	c.sync()
+}
+
+// sync sets Messages to the path leading to Leaf.
+func (c *Conversation) sync() {
+	path := c.Path()
+	c.Messages = make([]types.Message, len(path))
+	for i, id := range path {
+		c.Messages[i] = c.node(id).Message
+	}
+}
+
+// Path returns the IDs of the nodes from the first message to Leaf.
+func (c *Conversation) Path() []int {
+	c.ensureTree()
+	var path []int
+	for id := c.Leaf; id != 0; id = c.node(id).Parent {
+		path = append(path, id)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// Append adds m after the last message.
+func (c *Conversation) Append(m types.Message) {
+	c.ensureTree()
+	c.add(c.Leaf, m)
+}
+
+// Fork replaces the message at index with m on a new branch, the messages
+// following index are kept on the previous branch.
+func (c *Conversation) Fork(index int, m types.Message) {
+	path := c.Path()
+	if index >= len(path) {
+		c.Append(m)
+		return
+	}
+	c.add(c.node(path[index]).Parent, m)
+}
+
+// Children returns the IDs of the nodes following id, 0 giving the first
+// messages of every branch.
+func (c *Conversation) Children(id int) []int {
+	c.ensureTree()
+	var children []int
+	for _, n := range c.Nodes {
+		if n.Parent == id {
+			children = append(children, n.ID)
+		}
+	}
+	sort.Ints(children)
+	return children
+}
+
+// Node returns the node with the given ID.
+func (c *Conversation) Node(id int) Node {
+	return *c.node(id)
+}
+
+// Siblings returns the position of the message at index among the messages
+// sharing its parent, and their number.
+func (c *Conversation) Siblings(index int) (position, count int) {
+	path := c.Path()
+	if index < 0 || index >= len(path) {
+		return 0, 0
+	}
+	siblings := c.Children(c.node(path[index]).Parent)
+	for i, id := range siblings {
+		if id == path[index] {
+			position = i
+		}
+	}
+	return position, len(siblings)
+}
+
+// SelectSibling switches the message at index to the previous or next
+// sibling, following the latest branch from there. It reports whether the
+// path changed.
+func (c *Conversation) SelectSibling(index, delta int) bool {
+	path := c.Path()
+	if index < 0 || index >= len(path) {
+		return false
+	}
+	siblings := c.Children(c.node(path[index]).Parent)
+	position, _ := c.Siblings(index)
+	position += delta
+	if position < 0 || position >= len(siblings) {
+		return false
+	}
+	c.SetLeaf(siblings[position])
+	return true
+}
+
+// SetLeaf makes the branch going through id the active one, following the
+// latest branch after id.
+func (c *Conversation) SetLeaf(id int) {
+	c.ensureTree()
+	for {
+		children := c.Children(id)
+		if len(children) == 0 {
+			break
+		}
+		id = children[len(children)-1]
+	}
+	c.Leaf = id
+	c.sync()
+}
+
+// PathNode returns the node of the message at index.
+func (c *Conversation) PathNode(index int) *Node {
+	path := c.Path()
+	if index < 0 || index >= len(path) {
+		return nil
+	}
+	return c.node(path[index])
+}
+
+// Context returns the messages before end that are sent to the model, that
+// is without the excluded ones.
+func (c *Conversation) Context(end int) []types.Message {
+	path := c.Path()
+	var messages []types.Message
+	for _, id := range path[:min(end, len(path))] {
+		if n := c.node(id); !n.Excluded {
+			messages = append(messages, n.Message)
+		}
+	}
+	return messages
+}
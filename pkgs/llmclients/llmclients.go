@@ -1,15 +1,47 @@
 package llmclients
 
 import (
+	"fmt"
+	"net/http"
+	"teachat/pkgs/config"
 	"teachat/pkgs/llminterface"
 	"teachat/pkgs/ollama"
 	"teachat/pkgs/openai"
 	"teachat/pkgs/types"
 )
 
-type InitFunc func(bool) llminterface.Client
+// InitFunc creates the client of a platform, it fails when the platform is
+// not configured properly.
+type InitFunc func(stream bool, httpClient *http.Client) (llminterface.Client, error)
+
+// HTTPClient is used by the clients created with New. It can be replaced to
+// record or replay the provider traffic.
+var HTTPClient = http.DefaultClient
 
 var PlatformInitialization = map[types.LLMPlatform]InitFunc{
 	types.OpenAI: openai.New,
 	types.Ollama: ollama.New,
 }
+
+// New initializes a streaming client for model, set up with the given
+// persona and the parameters from cfg.
+func New(model types.Model, cfg config.Config, persona string) (llminterface.Client, error) {
+	initFunc, ok := PlatformInitialization[model.Platform]
+	if !ok {
+		return nil, fmt.Errorf("platform %q is not supported", model.Platform)
+	}
+	systemPrompt, err := cfg.SystemPrompt(persona)
+	if err != nil {
+		return nil, err
+	}
+	client, err := initFunc(true, HTTPClient)
+	if err != nil {
+		return nil, err
+	}
+	client.SetModel(model.Name)
+	client.SetSystemPrompt(systemPrompt)
+	parameters := cfg.Parameters
+	parameters.ContextWindow = cfg.ContextWindow(model)
+	client.SetParameters(parameters)
+	return client, nil
+}
@@ -2,11 +2,81 @@ package llminterface
 
 import (
 	"context"
+	"strings"
 	"teachat/pkgs/types"
 )
 
+// StreamBuffer is the capacity of the event channels returned by the clients.
+// A full channel blocks the provider until the consumer catches up.
+const StreamBuffer = 64
+
+// Client talks to a provider. It keeps the conversation history and handles
+// one stream at a time.
 type Client interface {
-	Prompt(context.Context, string) (types.StreamReader, error)
-	GetDelta(context.Context, types.StreamReader) (*types.ChatResponse, types.StreamReader, error)
+	// Stream sends prompt and returns the reply as a stream of events. The
+	// channel is closed after a DoneEvent or an ErrorEvent, or once ctx is
+	// cancelled.
+	Stream(context.Context, string) (<-chan types.StreamEvent, error)
+	// Continue asks for the reply to the messages as they are, like after
+	// the results of tool calls, and returns it as Stream does.
+	Continue(context.Context) (<-chan types.StreamEvent, error)
 	SetModel(types.LLMModel)
+	SetSystemPrompt(string)
+	SetParameters(types.Parameters)
+	SetMessages([]types.Message)
+	// SetTools offers tools to the model. The calls it makes are sent as
+	// ToolCallEvents before the DoneEvent, the reply is then added to the
+	// history with its calls.
+	SetTools([]types.Tool)
+}
+
+// Send delivers ev unless ctx is cancelled first, in which case it returns
+// false and the producer should stop.
+func Send(ctx context.Context, events chan<- types.StreamEvent, ev types.StreamEvent) bool {
+	select {
+	case events <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Next blocks until an event is available and returns it along with every
+// other event already buffered, so that consumers can handle them at once.
+// A closed channel is reported as a DoneEvent.
+func Next(events <-chan types.StreamEvent) []types.StreamEvent {
+	ev, ok := <-events
+	if !ok {
+		return []types.StreamEvent{{Type: types.DoneEvent}}
+	}
+	batch := []types.StreamEvent{ev}
+	for !ev.Terminal() {
+		select {
+		case ev, ok = <-events:
+			if !ok {
+				return append(batch, types.StreamEvent{Type: types.DoneEvent})
+			}
+			batch = append(batch, ev)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// Collect waits for the whole reply and returns its text and usage.
+func Collect(ctx context.Context, events <-chan types.StreamEvent) (string, *types.Usage, error) {
+	var sb strings.Builder
+	var usage *types.Usage
+	for ev := range events {
+		switch ev.Type {
+		case types.TextDelta:
+			sb.WriteString(ev.Text)
+		case types.UsageEvent:
+			usage = ev.Usage
+		case types.ErrorEvent:
+			return sb.String(), usage, ev.Err
+		}
+	}
+	return sb.String(), usage, ctx.Err()
 }
@@ -0,0 +1,51 @@
+package llminterface
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"teachat/pkgs/types"
+)
+
+func TestNextDrainsBufferedEvents(t *testing.T) {
+	events := make(chan types.StreamEvent, 4)
+	events <- types.StreamEvent{Type: types.TextDelta, Text: "a"}
+	events <- types.StreamEvent{Type: types.TextDelta, Text: "b"}
+	events <- types.StreamEvent{Type: types.DoneEvent}
+	events <- types.StreamEvent{Type: types.TextDelta, Text: "ignored"}
+
+	batch := Next(events)
+	if len(batch) != 3 || batch[2].Type != types.DoneEvent {
+		t.Errorf("expected the batch to stop at the done event, got %+v", batch)
+	}
+}
+
+func TestNextClosed(t *testing.T) {
+	events := make(chan types.StreamEvent)
+	close(events)
+	if batch := Next(events); len(batch) != 1 || batch[0].Type != types.DoneEvent {
+		t.Errorf("expected a done event for a closed channel, got %+v", batch)
+	}
+}
+
+func TestSendCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if Send(ctx, make(chan types.StreamEvent), types.StreamEvent{}) {
+		t.Error("expected Send to give up once the context is cancelled")
+	}
+}
+
+func TestCollect(t *testing.T) {
+	boom := errors.New("boom")
+	events := make(chan types.StreamEvent, 3)
+	events <- types.StreamEvent{Type: types.TextDelta, Text: "partial"}
+	events <- types.StreamEvent{Type: types.ErrorEvent, Err: boom}
+	close(events)
+
+	text, _, err := Collect(context.Background(), events)
+	if text != "partial" || !errors.Is(err, boom) {
+		t.Errorf("expected the partial text and the error, got %q, %v", text, err)
+	}
+}
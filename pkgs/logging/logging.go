@@ -0,0 +1,133 @@
+// Package logging configures the process wide slog logger: level, format,
+// destination with size based rotation and redaction of secrets.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"teachat/pkgs/config"
+	"teachat/pkgs/utils"
+)
+
+const (
+	defaultMaxSizeMB  = 10
+	defaultMaxBackups = 3
+	redacted          = "[REDACTED]"
+)
+
+// Options are set from the command line and take precedence over the config.
+type Options struct {
+	// Debug forces the debug level.
+	Debug bool
+	// Stderr logs to stderr instead of the log file.
+	Stderr bool
+}
+
+// DefaultPath returns $XDG_STATE_HOME/teachat/teachat.log.
+func DefaultPath() (string, error) {
+	dir, err := utils.XDGDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "teachat.log"), nil
+}
+
+// Setup builds a logger from cfg and opts and makes it the slog default. The
+// returned closer releases the log file.
+func Setup(cfg config.Log, opts Options) (io.Closer, error) {
+	level := slog.LevelInfo
+	if cfg.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return nil, fmt.Errorf("log.level: %w", err)
+		}
+	}
+	if opts.Debug {
+		level = slog.LevelDebug
+	}
+
+	var w io.WriteCloser = nopCloser{os.Stderr}
+	if !opts.Stderr {
+		path := cfg.Path
+		if path == "" {
+			var err error
+			if path, err = DefaultPath(); err != nil {
+				return nil, err
+			}
+		}
+		maxSize := cfg.MaxSizeMB
+		if maxSize <= 0 {
+			maxSize = defaultMaxSizeMB
+		}
+		maxBackups := cfg.MaxBackups
+		if maxBackups <= 0 {
+			maxBackups = defaultMaxBackups
+		}
+		rw, err := newRotatingWriter(path, int64(maxSize)<<20, maxBackups)
+		if err != nil {
+			return nil, err
+		}
+		w = rw
+	}
+
+	handlerOpts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactor{content: cfg.RedactContent}.replaceAttr,
+	}
+	var handler slog.Handler
+	switch cfg.Format {
+	case "", "text":
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		w.Close()
+		return nil, fmt.Errorf("log.format: unknown format %q, expected text or json", cfg.Format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return w, nil
+}
+
+var (
+	// secretPattern matches credentials that end up inside other values,
+	// like API keys in error messages or URLs.
+	secretPattern = regexp.MustCompile(`(sk-[A-Za-z0-9_\-]{8,}|(?i:bearer)\s+[A-Za-z0-9_\-.=]+)`)
+	secretKeys    = map[string]bool{
+		"key": true, "api_key": true, "apikey": true, "token": true, "access_token": true,
+		"secret": true, "password": true, "authorization": true,
+	}
+	contentKeys = map[string]bool{
+		"prompt": true, "content": true, "message": true, "messages": true, "response": true,
+	}
+)
+
+type redactor struct {
+	content bool
+}
+
+func (r redactor) replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	switch {
+	case secretKeys[key] || strings.HasSuffix(key, "_key") || strings.HasSuffix(key, "_secret") || strings.HasSuffix(key, "_token"):
+		return slog.String(a.Key, redacted)
+	case r.content && contentKeys[key]:
+		return slog.String(a.Key, fmt.Sprintf("[REDACTED %d bytes]", len(a.Value.String())))
+	}
+	if a.Value.Kind() == slog.KindString || a.Value.Kind() == slog.KindAny {
+		if s := a.Value.String(); secretPattern.MatchString(s) {
+			return slog.String(a.Key, secretPattern.ReplaceAllString(s, redacted))
+		}
+	}
+	return a
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedaction(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content bool
+		attrs   []any
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "secret keys",
+			attrs:   []any{"api_key", "abc123", "openai_api_key", "abc123", "prompt_tokens", 12},
+			want:    []string{"api_key=[REDACTED]", "openai_api_key=[REDACTED]", "prompt_tokens=12"},
+			notWant: []string{"abc123"},
+		},
+		{
+			name:    "secrets inside values",
+			attrs:   []any{"error", "invalid key sk-1234567890abcdef", "header", "Bearer abc.def"},
+			want:    []string{"invalid key [REDACTED]", "header=[REDACTED]"},
+			notWant: []string{"sk-1234567890abcdef", "abc.def"},
+		},
+		{
+			name:  "content kept by default",
+			attrs: []any{"prompt", "hello"},
+			want:  []string{"prompt=hello"},
+		},
+		{
+			name:    "content redacted",
+			content: true,
+			attrs:   []any{"prompt", "hello"},
+			want:    []string{`prompt="[REDACTED 5 bytes]"`},
+			notWant: []string{"hello"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+				ReplaceAttr: redactor{content: tc.content}.replaceAttr,
+			}))
+			logger.Info("test", tc.attrs...)
+			out := buf.String()
+			for _, want := range tc.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("expected %q in %q", want, out)
+				}
+			}
+			for _, notWant := range tc.notWant {
+				if strings.Contains(out, notWant) {
+					t.Errorf("did not expect %q in %q", notWant, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "teachat.log")
+	w, err := newRotatingWriter(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for file, want := range map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	} {
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: expected %q, got %q", filepath.Base(file), want, got)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 backups to be kept")
+	}
+}
@@ -0,0 +1,248 @@
+// Package mcp is a client of the Model Context Protocol. It starts or
+// connects to the servers of the configuration, over their standard input
+// and output or the streamable HTTP transport, and lists their tools,
+// prompts and resources for the chat.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// ProtocolVersion is the version of the protocol the client speaks.
+const ProtocolVersion = "2025-03-26"
+
+// Tool is a tool offered by a server.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+	Annotations struct {
+		ReadOnlyHint bool `json:"readOnlyHint,omitempty"`
+	} `json:"annotations,omitempty"`
+}
+
+// Prompt is a prompt template offered by a server.
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// Resource is a document offered by a server.
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// content is an item of the content of a tool result or a prompt message.
+type content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Resource *struct {
+		URI  string `json:"uri"`
+		Text string `json:"text,omitempty"`
+	} `json:"resource,omitempty"`
+}
+
+// text returns the text of the content, binary content is only named.
+func (c content) text() string {
+	switch {
+	case c.Type == "text":
+		return c.Text
+	case c.Resource != nil && c.Resource.Text != "":
+		return c.Resource.Text
+	case c.MimeType != "":
+		return fmt.Sprintf("[%s %s]", c.Type, c.MimeType)
+	}
+	return fmt.Sprintf("[%s]", c.Type)
+}
+
+func joinContent(items []content) string {
+	texts := make([]string, len(items))
+	for i, c := range items {
+		texts[i] = c.text()
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Client talks to a server once initialized.
+type Client struct {
+	transport transport
+	nextID    atomic.Int64
+	// Server is the name and version the server gave.
+	Server struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+}
+
+// initialize negotiates the protocol with the server.
+func (c *Client) initialize(ctx context.Context) error {
+	params := map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]string{"name": "teachat", "version": "dev"},
+	}
+	var result struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      *struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+	}
+	if err := c.call(ctx, "initialize", params, &result); err != nil {
+		return fmt.Errorf("initializing: %w", err)
+	}
+	if result.ServerInfo != nil {
+		c.Server.Name, c.Server.Version = result.ServerInfo.Name, result.ServerInfo.Version
+	}
+	return c.transport.notify(ctx, message{JSONRPC: "2.0", Method: "notifications/initialized"})
+}
+
+// call sends the request method with params and decodes its result.
+func (c *Client) call(ctx context.Context, method string, params, result any) error {
+	req := message{JSONRPC: "2.0", Method: method}
+	id := c.nextID.Add(1)
+	req.ID = &id
+	if params != nil {
+		bts, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = bts
+	}
+	resp, err := c.transport.call(ctx, req)
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+// list calls a paginated list method, appending the items under key of
+// every page to items.
+func list[T any](ctx context.Context, c *Client, method, key string) ([]T, error) {
+	var items []T
+	cursor := ""
+	for {
+		var params map[string]string
+		if cursor != "" {
+			params = map[string]string{"cursor": cursor}
+		}
+		var page map[string]json.RawMessage
+		if err := c.call(ctx, method, params, &page); err != nil {
+			return nil, err
+		}
+		var pageItems []T
+		if raw, ok := page[key]; ok {
+			if err := json.Unmarshal(raw, &pageItems); err != nil {
+				return nil, fmt.Errorf("%s: %w", method, err)
+			}
+		}
+		items = append(items, pageItems...)
+		cursor = ""
+		if raw, ok := page["nextCursor"]; ok {
+			json.Unmarshal(raw, &cursor)
+		}
+		if cursor == "" {
+			return items, nil
+		}
+	}
+}
+
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	return list[Tool](ctx, c, "tools/list", "tools")
+}
+
+func (c *Client) ListPrompts(ctx context.Context) ([]Prompt, error) {
+	return list[Prompt](ctx, c, "prompts/list", "prompts")
+}
+
+func (c *Client) ListResources(ctx context.Context) ([]Resource, error) {
+	return list[Resource](ctx, c, "resources/list", "resources")
+}
+
+// CallTool runs a tool of the server and returns its text. A failure
+// reported by the tool is an error with the text it gave.
+func (c *Client) CallTool(ctx context.Context, name string, arguments json.RawMessage) (string, error) {
+	params := map[string]any{"name": name, "arguments": arguments}
+	var result struct {
+		Content []content `json:"content"`
+		IsError bool      `json:"isError"`
+	}
+	if err := c.call(ctx, "tools/call", params, &result); err != nil {
+		return "", err
+	}
+	text := joinContent(result.Content)
+	if result.IsError {
+		return "", errors.New(text)
+	}
+	return text, nil
+}
+
+// GetPrompt fills the prompt template name with arguments and returns the
+// text of its messages.
+func (c *Client) GetPrompt(ctx context.Context, name string, arguments map[string]string) (string, error) {
+	params := map[string]any{"name": name, "arguments": arguments}
+	var result struct {
+		Messages []struct {
+			Role    string  `json:"role"`
+			Content content `json:"content"`
+		} `json:"messages"`
+	}
+	if err := c.call(ctx, "prompts/get", params, &result); err != nil {
+		return "", err
+	}
+	texts := make([]string, len(result.Messages))
+	for i, m := range result.Messages {
+		texts[i] = m.Content.text()
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// ReadResource returns the text of the resource at uri.
+func (c *Client) ReadResource(ctx context.Context, uri string) (string, error) {
+	var result struct {
+		Contents []struct {
+			URI      string `json:"uri"`
+			MimeType string `json:"mimeType,omitempty"`
+			Text     string `json:"text,omitempty"`
+			Blob     string `json:"blob,omitempty"`
+		} `json:"contents"`
+	}
+	if err := c.call(ctx, "resources/read", map[string]string{"uri": uri}, &result); err != nil {
+		return "", err
+	}
+	texts := make([]string, 0, len(result.Contents))
+	for _, c := range result.Contents {
+		if c.Blob != "" && c.Text == "" {
+			return "", fmt.Errorf("%s is binary (%s)", c.URI, c.MimeType)
+		}
+		texts = append(texts, c.Text)
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// Close ends the session, stopping the server started by the client.
+func (c *Client) Close() error {
+	return c.transport.close()
+}
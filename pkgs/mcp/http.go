@@ -0,0 +1,167 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// sessionHeader carries the session given by the server on initialization.
+const sessionHeader = "Mcp-Session-Id"
+
+// streamableHTTP posts every message to the endpoint of a server, which
+// answers with JSON or a stream of server-sent events.
+type streamableHTTP struct {
+	url      string
+	headers  map[string]string
+	client   *http.Client
+	onNotify handler
+
+	mu      sync.Mutex
+	session string
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func newStreamableHTTP(url string, headers map[string]string, notify handler) *streamableHTTP {
+	return &streamableHTTP{url: url, headers: headers, client: http.DefaultClient, onNotify: notify, closed: make(chan struct{})}
+}
+
+func (t *streamableHTTP) post(ctx context.Context, msg message) (*http.Response, error) {
+	bts, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(bts))
+	if err != nil {
+		return nil, err
+	}
+	t.setHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if session := resp.Header.Get(sessionHeader); session != "" {
+		t.mu.Lock()
+		t.session = session
+		t.mu.Unlock()
+	}
+	return resp, nil
+}
+
+func (t *streamableHTTP) setHeaders(req *http.Request) {
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	t.mu.Lock()
+	if t.session != "" {
+		req.Header.Set(sessionHeader, t.session)
+	}
+	t.mu.Unlock()
+}
+
+func (t *streamableHTTP) call(ctx context.Context, req message) (message, error) {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return message{}, err
+	}
+	defer resp.Body.Close()
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/event-stream" {
+		var msg message
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+			return message{}, fmt.Errorf("decoding the response: %w", err)
+		}
+		return msg, nil
+	}
+	// the stream may carry requests and notifications before the response
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLine)
+	for {
+		more := scanner.Scan()
+		line := scanner.Text()
+		if d, ok := strings.CutPrefix(line, "data:"); more && ok {
+			data = append(data, strings.TrimPrefix(d, " "))
+			continue
+		}
+		// an event ends with a blank line, or the stream
+		if (line == "" || !more) && len(data) > 0 {
+			var msg message
+			err := json.Unmarshal([]byte(strings.Join(data, "\n")), &msg)
+			data = nil
+			switch {
+			case err != nil:
+			case msg.isResponse() && *msg.ID == *req.ID:
+				return msg, nil
+			case msg.ID != nil && msg.Method != "":
+				t.answer(ctx, reply(msg))
+			case msg.Method != "":
+				t.onNotify(msg.Method)
+			}
+		}
+		if !more {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return message{}, err
+	}
+	return message{}, fmt.Errorf("the stream ended without a response to %s", req.Method)
+}
+
+// answer posts the answer to a request of the server.
+func (t *streamableHTTP) answer(ctx context.Context, msg message) {
+	if resp, err := t.post(ctx, msg); err == nil {
+		resp.Body.Close()
+	}
+}
+
+func (t *streamableHTTP) notify(ctx context.Context, n message) error {
+	resp, err := t.post(ctx, n)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// done is only closed by close, a lost connection is told by the failed
+// requests.
+func (t *streamableHTTP) done() <-chan struct{} {
+	return t.closed
+}
+
+// close ends the session on the server.
+func (t *streamableHTTP) close() error {
+	t.once.Do(func() { close(t.closed) })
+	t.mu.Lock()
+	session := t.session
+	t.mu.Unlock()
+	if session == "" {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	t.setHeaders(req)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
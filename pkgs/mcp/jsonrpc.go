@@ -0,0 +1,63 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// message is a JSON-RPC 2.0 request, notification or response. Requests
+// have an ID and a method, notifications only a method and responses only
+// an ID.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+func (m message) isResponse() bool {
+	return m.ID != nil && m.Method == ""
+}
+
+// rpcError is the error of a response.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// methodNotFound answers the requests of the server the client doesn't
+// handle.
+const methodNotFound = -32601
+
+// transport carries the messages to a server.
+type transport interface {
+	// call sends a request and waits for its response.
+	call(ctx context.Context, req message) (message, error)
+	// notify sends a notification.
+	notify(ctx context.Context, n message) error
+	// done is closed when the connection is lost.
+	done() <-chan struct{}
+	close() error
+}
+
+// handler receives the notifications of the server.
+type handler func(method string)
+
+// reply answers the requests sent by the server: pings, and an error for
+// the rest since the client offers no capability.
+func reply(req message) message {
+	resp := message{JSONRPC: "2.0", ID: req.ID}
+	if req.Method == "ping" {
+		resp.Result = json.RawMessage("{}")
+		return resp
+	}
+	resp.Error = &rpcError{Code: methodNotFound, Message: "method not found: " + req.Method}
+	return resp
+}
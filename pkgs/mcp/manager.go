@@ -0,0 +1,408 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"teachat/pkgs/config"
+	"teachat/pkgs/tools"
+)
+
+// State is where a server is in its lifecycle.
+type State string
+
+const (
+	Starting State = "starting"
+	Running  State = "running"
+	Failed   State = "failed"
+	Stopped  State = "stopped"
+)
+
+const (
+	// startTimeout bounds the initialization of a server and the listing of
+	// what it offers.
+	startTimeout = 30 * time.Second
+	// maxRestarts is the number of times in a row a server that exited is
+	// started again, waiting twice as long every time from restartDelay.
+	maxRestarts = 5
+	// stderrLines is the number of lines of standard error kept for the
+	// status page.
+	stderrLines = 50
+)
+
+// restartDelay is replaced in tests.
+var restartDelay = time.Second
+
+// Status is the state of a server and what it offers.
+type Status struct {
+	Name string
+	// Target is the command line or the URL of the server.
+	Target string
+	State  State
+	Err    string
+	// Restarts counts the restarts since the server was last started.
+	Restarts  int
+	Server    string
+	Tools     []Tool
+	Prompts   []Prompt
+	Resources []Resource
+	Stderr    []string
+}
+
+// Manager runs the servers of the configuration, starting again the ones
+// that exit. It is safe for concurrent use.
+type Manager struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	changed chan struct{}
+
+	mu      sync.Mutex
+	servers map[string]*server
+	names   []string
+}
+
+type server struct {
+	config config.MCPServer
+	status Status
+	client *Client
+	// generation identifies the run of the server, a run ends when another
+	// one starts.
+	generation int
+}
+
+// NewManager prepares the servers of cfg, see Start.
+func NewManager(cfg map[string]config.MCPServer) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{ctx: ctx, cancel: cancel, changed: make(chan struct{}, 1), servers: make(map[string]*server)}
+	for name, c := range cfg {
+		target := c.URL
+		if c.Command != "" {
+			target = strings.Join(append([]string{c.Command}, c.Args...), " ")
+		}
+		m.servers[name] = &server{config: c, status: Status{Name: name, Target: target, State: Stopped}}
+		m.names = append(m.names, name)
+	}
+	slices.Sort(m.names)
+	return m
+}
+
+// Start starts the enabled servers in the background.
+func (m *Manager) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range m.names {
+		if s := m.servers[name]; !s.config.Disabled {
+			m.start(name, s)
+		}
+	}
+}
+
+// Restart stops the server and starts it again.
+func (m *Manager) Restart(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.servers[name]
+	if !ok {
+		return
+	}
+	if s.client != nil {
+		go s.client.Close()
+		s.client = nil
+	}
+	s.status.Restarts = 0
+	m.start(name, s)
+}
+
+// start begins a run of the server, m.mu being held.
+func (m *Manager) start(name string, s *server) {
+	s.generation++
+	s.status.State = Starting
+	s.status.Err = ""
+	m.notify()
+	go m.run(name, s.generation)
+}
+
+// run connects to the server and watches it, starting it again when it
+// exits, until the run is replaced or the manager closed.
+func (m *Manager) run(name string, generation int) {
+	for {
+		client, err := m.connect(name, generation)
+		if err == nil {
+			<-client.transport.done()
+			client.Close()
+			err = errors.New("the server exited")
+		}
+		if !m.current(name, generation) {
+			return
+		}
+		slog.Warn("MCP server stopped", "server", name, "error", err)
+		m.mu.Lock()
+		s := m.servers[name]
+		if s.generation != generation || m.ctx.Err() != nil {
+			m.mu.Unlock()
+			return
+		}
+		s.client = nil
+		s.status.Err = err.Error()
+		if s.status.Restarts >= maxRestarts {
+			s.status.State = Failed
+			m.notify()
+			m.mu.Unlock()
+			return
+		}
+		delay := restartDelay << s.status.Restarts
+		s.status.Restarts++
+		s.status.State = Starting
+		m.notify()
+		m.mu.Unlock()
+		select {
+		case <-time.After(delay):
+		case <-m.ctx.Done():
+			return
+		}
+		if !m.current(name, generation) {
+			return
+		}
+	}
+}
+
+// current reports whether generation is the current run of the server.
+func (m *Manager) current(name string, generation int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.servers[name].generation == generation && m.ctx.Err() == nil
+}
+
+// connect starts the server, initializes it and lists what it offers, for
+// the run generation.
+func (m *Manager) connect(name string, generation int) (*Client, error) {
+	m.mu.Lock()
+	cfg := m.servers[name].config
+	m.mu.Unlock()
+	notify := func(method string) {
+		if strings.HasSuffix(method, "/list_changed") {
+			go m.refresh(name)
+		}
+	}
+	var t transport
+	if cfg.Command != "" {
+		s, err := startStdio(cfg.Command, cfg.Args, cfg.Env, notify, func(line string) { m.stderr(name, line) })
+		if err != nil {
+			return nil, err
+		}
+		t = s
+	} else {
+		t = newStreamableHTTP(cfg.URL, cfg.Headers, notify)
+	}
+	client := &Client{transport: t}
+	ctx, cancel := context.WithTimeout(m.ctx, startTimeout)
+	defer cancel()
+	if err := client.initialize(ctx); err != nil {
+		client.Close()
+		return nil, err
+	}
+	m.mu.Lock()
+	s := m.servers[name]
+	if s.generation != generation || m.ctx.Err() != nil {
+		m.mu.Unlock()
+		client.Close()
+		return nil, errors.New("the run was replaced")
+	}
+	s.client = client
+	s.status.Server = strings.TrimSpace(client.Server.Name + " " + client.Server.Version)
+	m.mu.Unlock()
+	if err := m.list(ctx, name, client); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// list gets the tools, prompts and resources of the server. A server may
+// not offer them all, a method it doesn't know leaves the list empty.
+func (m *Manager) list(ctx context.Context, name string, client *Client) error {
+	listed, err := client.ListTools(ctx)
+	if err != nil && !notFound(err) {
+		return fmt.Errorf("listing the tools: %w", err)
+	}
+	prompts, err := client.ListPrompts(ctx)
+	if err != nil && !notFound(err) {
+		return fmt.Errorf("listing the prompts: %w", err)
+	}
+	resources, err := client.ListResources(ctx)
+	if err != nil && !notFound(err) {
+		return fmt.Errorf("listing the resources: %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.servers[name]
+	if s.client != client {
+		return nil
+	}
+	s.status.Tools, s.status.Prompts, s.status.Resources = listed, prompts, resources
+	s.status.State = Running
+	s.status.Err = ""
+	m.notify()
+	return nil
+}
+
+func notFound(err error) bool {
+	var rpcErr *rpcError
+	return errors.As(err, &rpcErr) && rpcErr.Code == methodNotFound
+}
+
+// refresh lists again what the server offers, after it told it changed.
+func (m *Manager) refresh(name string) {
+	client := m.client(name)
+	if client == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(m.ctx, startTimeout)
+	defer cancel()
+	if err := m.list(ctx, name, client); err != nil {
+		slog.Warn("refreshing an MCP server", "server", name, "error", err)
+	}
+}
+
+// stderr keeps a line written by the server on its standard error.
+func (m *Manager) stderr(name, line string) {
+	slog.Debug("MCP server stderr", "server", name, "line", line)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.servers[name]
+	s.status.Stderr = append(s.status.Stderr, line)
+	if len(s.status.Stderr) > stderrLines {
+		s.status.Stderr = s.status.Stderr[len(s.status.Stderr)-stderrLines:]
+	}
+	m.notify()
+}
+
+// notify tells Changed listeners, m.mu being held.
+func (m *Manager) notify() {
+	select {
+	case m.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Changed receives a value after the status of servers changed. Changes
+// made before the value is received are coalesced.
+func (m *Manager) Changed() <-chan struct{} {
+	return m.changed
+}
+
+// Statuses returns the status of every server, by name.
+func (m *Manager) Statuses() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	statuses := make([]Status, len(m.names))
+	for i, name := range m.names {
+		s := m.servers[name].status
+		s.Stderr = slices.Clone(s.Stderr)
+		statuses[i] = s
+	}
+	return statuses
+}
+
+func (m *Manager) client(name string) *Client {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.servers[name]; ok {
+		return s.client
+	}
+	return nil
+}
+
+var errNotRunning = errors.New("the server is not running")
+
+// GetPrompt fills a prompt template of the server.
+func (m *Manager) GetPrompt(ctx context.Context, server, name string, arguments map[string]string) (string, error) {
+	client := m.client(server)
+	if client == nil {
+		return "", errNotRunning
+	}
+	return client.GetPrompt(ctx, name, arguments)
+}
+
+// ReadResource reads a resource of the server.
+func (m *Manager) ReadResource(ctx context.Context, server, uri string) (string, error) {
+	client := m.client(server)
+	if client == nil {
+		return "", errNotRunning
+	}
+	return client.ReadResource(ctx, uri)
+}
+
+// Tools returns the tools of the running servers, for the registry. They
+// are named after the server, see ToolName.
+func (m *Manager) Tools() []tools.Tool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var all []tools.Tool
+	for _, name := range m.names {
+		s := m.servers[name]
+		if s.status.State != Running {
+			continue
+		}
+		for _, t := range s.status.Tools {
+			schema := t.InputSchema
+			if !json.Valid(schema) {
+				schema = json.RawMessage(`{"type": "object"}`)
+			}
+			server, tool := name, t.Name
+			all = append(all, tools.Tool{
+				Name:        ToolName(server, tool),
+				Description: t.Description,
+				Parameters:  schema,
+				ReadOnly:    t.Annotations.ReadOnlyHint,
+				Handler: func(ctx context.Context, arguments json.RawMessage) (string, error) {
+					client := m.client(server)
+					if client == nil {
+						return "", errNotRunning
+					}
+					return client.CallTool(ctx, tool, arguments)
+				},
+			})
+		}
+	}
+	return all
+}
+
+// invalidName matches the characters not allowed in tool names by the
+// model APIs.
+var invalidName = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// maxToolName is the longest tool name accepted by the model APIs.
+const maxToolName = 64
+
+// ToolName is the name of the tool of server offered to the models.
+func ToolName(server, tool string) string {
+	name := invalidName.ReplaceAllString(server+"__"+tool, "_")
+	return name[:min(len(name), maxToolName)]
+}
+
+// Close stops the servers.
+func (m *Manager) Close() {
+	m.cancel()
+	m.mu.Lock()
+	var clients []*Client
+	for _, s := range m.servers {
+		if s.client != nil {
+			clients = append(clients, s.client)
+			s.client = nil
+		}
+		s.status.State = Stopped
+	}
+	m.mu.Unlock()
+	for _, c := range clients {
+		c.Close()
+	}
+}
@@ -0,0 +1,136 @@
+package mcp
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"teachat/pkgs/config"
+	"teachat/pkgs/mcp/mcptest"
+	"teachat/pkgs/tools"
+	"teachat/pkgs/types"
+)
+
+func TestMain(m *testing.M) {
+	// the test binary is the fake server when started by the tests
+	mcptest.Main()
+	restartDelay = 10 * time.Millisecond
+	os.Exit(m.Run())
+}
+
+// waitFor waits until the status of the server named fake satisfies ok.
+func waitFor(t *testing.T, m *Manager, ok func(Status) bool) Status {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		if s := m.Statuses()[0]; ok(s) {
+			return s
+		}
+		select {
+		case <-m.Changed():
+		case <-timeout:
+			t.Fatalf("timed out, the server is %+v", m.Statuses()[0])
+		}
+	}
+}
+
+func running(s Status) bool { return s.State == Running }
+
+func run(t *testing.T, m *Manager, name, arguments string) string {
+	t.Helper()
+	r, err := tools.NewRegistry(m.Tools()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.Run(context.Background(), types.ToolCall{ID: "call_1", Name: name, Arguments: arguments}).Content
+}
+
+func TestStdio(t *testing.T) {
+	m := NewManager(map[string]config.MCPServer{"fake": {Command: os.Args[0], Env: map[string]string{mcptest.EnvVar: "1"}}})
+	defer m.Close()
+	m.Start()
+	s := waitFor(t, m, running)
+	if s.Server != "fake 1.0" || len(s.Tools) != 3 || len(s.Prompts) != 1 || len(s.Resources) != 1 {
+		t.Errorf("unexpected status %+v", s)
+	}
+	waitFor(t, m, func(s Status) bool { return slices.Contains(s.Stderr, "fake server ready") })
+
+	names := make([]string, 0, 3)
+	for _, tool := range m.Tools() {
+		names = append(names, tool.Name)
+	}
+	if strings.Join(names, ",") != "fake__echo,fake__fail,fake__exit" {
+		t.Errorf("unexpected tools %q", names)
+	}
+	if got := run(t, m, "fake__echo", `{"text": "hi"}`); got != "hi" {
+		t.Errorf("expected the echo, got %q", got)
+	}
+	if got := run(t, m, "fake__fail", `{}`); got != "error: it failed" {
+		t.Errorf("expected the failure, got %q", got)
+	}
+	ctx := context.Background()
+	if text, err := m.GetPrompt(ctx, "fake", "greet", map[string]string{"name": "Ada"}); err != nil || text != "Say hello to Ada." {
+		t.Errorf("unexpected prompt %q, %v", text, err)
+	}
+	if _, err := m.GetPrompt(ctx, "fake", "greet", nil); err == nil || !strings.Contains(err.Error(), "greet needs a name") {
+		t.Errorf("expected the error of the server, got %v", err)
+	}
+	if text, err := m.ReadResource(ctx, "fake", "memo://notes"); err != nil || text != mcptest.Notes {
+		t.Errorf("unexpected resource %q, %v", text, err)
+	}
+
+	// the server is started again when it exits
+	run(t, m, "fake__exit", `{}`)
+	waitFor(t, m, func(s Status) bool { return s.Restarts == 1 && s.State == Running })
+	if got := run(t, m, "fake__echo", `{"text": "again"}`); got != "again" {
+		t.Errorf("expected the restarted server to answer, got %q", got)
+	}
+}
+
+func TestStdioFailure(t *testing.T) {
+	m := NewManager(map[string]config.MCPServer{"fake": {Command: "/nonexistent/server"}})
+	defer m.Close()
+	m.Start()
+	s := waitFor(t, m, func(s Status) bool { return s.State == Failed })
+	if s.Restarts != maxRestarts || !strings.Contains(s.Err, "/nonexistent/server") {
+		t.Errorf("unexpected status %+v", s)
+	}
+	if len(m.Tools()) != 0 {
+		t.Error("expected no tools from a failed server")
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	fake := mcptest.New()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	m := NewManager(map[string]config.MCPServer{"fake": {URL: srv.URL}})
+	defer m.Close()
+	m.Start()
+	s := waitFor(t, m, running)
+	if s.Target != srv.URL || len(s.Tools) != 3 {
+		t.Errorf("unexpected status %+v", s)
+	}
+	if got := run(t, m, "fake__echo", `{"text": "streamed"}`); got != "streamed" {
+		t.Errorf("expected the echo from the event stream, got %q", got)
+	}
+	if len(fake.Calls) != 1 || fake.Calls[0] != `echo {"text":"streamed"}` {
+		t.Errorf("unexpected calls %q", fake.Calls)
+	}
+	if text, err := m.ReadResource(context.Background(), "fake", "memo://notes"); err != nil || text != mcptest.Notes {
+		t.Errorf("unexpected resource %q, %v", text, err)
+	}
+}
+
+func TestToolName(t *testing.T) {
+	if got := ToolName("my server", "read.file"); got != "my_server__read_file" {
+		t.Errorf("expected the invalid characters to be replaced, got %q", got)
+	}
+	if got := ToolName("s", strings.Repeat("x", 80)); len(got) != maxToolName {
+		t.Errorf("expected the name to be cut, got %d characters", len(got))
+	}
+}
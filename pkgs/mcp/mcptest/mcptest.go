@@ -0,0 +1,233 @@
+// Package mcptest is a fake Model Context Protocol server for tests. It
+// offers a few tools, a prompt and a resource, over standard input and
+// output or streamable HTTP.
+//
+// A test starts it as a process by running its own binary with EnvVar set,
+// calling Main from TestMain.
+package mcptest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// EnvVar makes Main serve over standard input and output.
+const EnvVar = "TEACHAT_FAKE_MCP"
+
+// Main serves and exits when EnvVar is set, it returns otherwise.
+func Main() {
+	if os.Getenv(EnvVar) == "" {
+		return
+	}
+	s := New()
+	s.exit = func() { os.Exit(3) }
+	if err := s.ServeStdio(os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// Notes is the text of the memo://notes resource.
+const Notes = "Remember the milk."
+
+// Server answers the requests of a client.
+type Server struct {
+	mu sync.Mutex
+	// Calls lists the tools called, with their arguments.
+	Calls []string
+	// exit is called by the exit tool, only a server run by Main exits.
+	exit func()
+}
+
+func New() *Server {
+	return &Server{}
+}
+
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func text(s string) []map[string]string {
+	return []map[string]string{{"type": "text", "text": s}}
+}
+
+var tools = []map[string]any{
+	{
+		"name":        "echo",
+		"description": "Echo the text",
+		"inputSchema": json.RawMessage(`{"type": "object", "properties": {"text": {"type": "string"}}, "required": ["text"]}`),
+		"annotations": map[string]bool{"readOnlyHint": true},
+	},
+	{
+		"name":        "fail",
+		"description": "Always fail",
+		"inputSchema": json.RawMessage(`{"type": "object"}`),
+	},
+	{
+		"name":        "exit",
+		"description": "Stop the server",
+		"inputSchema": json.RawMessage(`{"type": "object"}`),
+	},
+}
+
+// handle returns the response to req, or nil for a notification.
+func (s *Server) handle(req message) *message {
+	if req.ID == nil {
+		return nil
+	}
+	resp := &message{JSONRPC: "2.0", ID: req.ID}
+	var params struct {
+		Name      string          `json:"name"`
+		URI       string          `json:"uri"`
+		Arguments json.RawMessage `json:"arguments"`
+		Cursor    string          `json:"cursor"`
+	}
+	json.Unmarshal(req.Params, &params)
+	switch req.Method {
+	case "initialize":
+		resp.Result = map[string]any{
+			"protocolVersion": "2025-03-26",
+			"capabilities":    map[string]any{"tools": map[string]any{}, "prompts": map[string]any{}, "resources": map[string]any{}},
+			"serverInfo":      map[string]string{"name": "fake", "version": "1.0"},
+		}
+	case "ping":
+		resp.Result = map[string]any{}
+	case "tools/list":
+		// the tools come in two pages
+		if params.Cursor == "" {
+			resp.Result = map[string]any{"tools": tools[:1], "nextCursor": "2"}
+		} else {
+			resp.Result = map[string]any{"tools": tools[1:]}
+		}
+	case "tools/call":
+		s.mu.Lock()
+		s.Calls = append(s.Calls, params.Name+" "+string(params.Arguments))
+		s.mu.Unlock()
+		switch params.Name {
+		case "echo":
+			var args struct {
+				Text string `json:"text"`
+			}
+			json.Unmarshal(params.Arguments, &args)
+			resp.Result = map[string]any{"content": text(args.Text)}
+		case "fail":
+			resp.Result = map[string]any{"content": text("it failed"), "isError": true}
+		case "exit":
+			if s.exit == nil {
+				resp.Result = map[string]any{"content": text("only a process exits"), "isError": true}
+				break
+			}
+			s.exit()
+		default:
+			resp.Error = &rpcError{-32602, "unknown tool " + params.Name}
+		}
+	case "prompts/list":
+		resp.Result = map[string]any{"prompts": []map[string]any{{
+			"name":        "greet",
+			"description": "Greet someone",
+			"arguments":   []map[string]any{{"name": "name", "required": true}},
+		}}}
+	case "prompts/get":
+		var args map[string]string
+		json.Unmarshal(params.Arguments, &args)
+		if params.Name != "greet" || args["name"] == "" {
+			resp.Error = &rpcError{-32602, "greet needs a name"}
+			break
+		}
+		resp.Result = map[string]any{"messages": []map[string]any{
+			{"role": "user", "content": text("Say hello to " + args["name"] + ".")[0]},
+		}}
+	case "resources/list":
+		resp.Result = map[string]any{"resources": []map[string]string{{"uri": "memo://notes", "name": "notes", "mimeType": "text/plain"}}}
+	case "resources/read":
+		if params.URI != "memo://notes" {
+			resp.Error = &rpcError{-32002, "resource not found"}
+			break
+		}
+		resp.Result = map[string]any{"contents": []map[string]string{{"uri": params.URI, "mimeType": "text/plain", "text": Notes}}}
+	default:
+		resp.Error = &rpcError{-32601, "method not found"}
+	}
+	return resp
+}
+
+// ServeStdio reads a request per line of in and writes the responses to
+// out, until in is closed.
+func (s *Server) ServeStdio(in io.Reader, out, errOut io.Writer) error {
+	fmt.Fprintln(errOut, "fake server ready")
+	enc := json.NewEncoder(out)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		var req message
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			fmt.Fprintln(errOut, "invalid message:", err)
+			continue
+		}
+		if resp := s.handle(req); resp != nil {
+			if err := enc.Encode(resp); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// Session is the session given to HTTP clients.
+const Session = "fake-session"
+
+// ServeHTTP implements the streamable HTTP transport. Tool calls are
+// answered with a stream of events, preceded by a notification, the other
+// requests with JSON.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodPost:
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req message
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Method != "initialize" && r.Header.Get("Mcp-Session-Id") != Session {
+		http.Error(w, "missing session", http.StatusBadRequest)
+		return
+	}
+	resp := s.handle(req)
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if req.Method == "initialize" {
+		w.Header().Set("Mcp-Session-Id", Session)
+	}
+	bts, _ := json.Marshal(resp)
+	if req.Method != "tools/call" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bts)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprint(w, "data: {\"jsonrpc\": \"2.0\", \"method\": \"notifications/message\", \"params\": {\"level\": \"info\", \"data\": \"calling\"}}\n\n")
+	fmt.Fprintf(w, "data: %s\n\n", bts)
+}
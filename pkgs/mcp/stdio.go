@@ -0,0 +1,185 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// stopTimeout is how long a server has to exit once its input is closed,
+// before it is killed.
+const stopTimeout = 2 * time.Second
+
+// maxLine bounds a message read from a server.
+const maxLine = 16 << 20
+
+// stdio talks to a server started as a process, with a message per line on
+// its standard input and output.
+type stdio struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	onNotify handler
+	// stderrDone is closed once the standard error is read, the process
+	// can then be waited for.
+	stderrDone chan struct{}
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[int64]chan message
+	err     error
+	exited  chan struct{}
+}
+
+// startStdio starts command with args, adding env to the environment. The
+// lines it writes on its standard error are given to stderr.
+func startStdio(command string, args []string, env map[string]string, notify handler, stderr func(string)) (*stdio, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	errPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	s := &stdio{
+		cmd:        cmd,
+		stdin:      stdin,
+		onNotify:   notify,
+		stderrDone: make(chan struct{}),
+		pending:    make(map[int64]chan message),
+		exited:     make(chan struct{}),
+	}
+	go func() {
+		defer close(s.stderrDone)
+		scanner := bufio.NewScanner(errPipe)
+		for scanner.Scan() {
+			stderr(scanner.Text())
+		}
+	}()
+	go s.read(stdout)
+	return s, nil
+}
+
+// read dispatches the messages of the server until it exits.
+func (s *stdio) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLine)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			slog.Debug("ignoring a line of an MCP server", "error", err)
+			continue
+		}
+		switch {
+		case msg.isResponse():
+			s.mu.Lock()
+			ch := s.pending[*msg.ID]
+			delete(s.pending, *msg.ID)
+			s.mu.Unlock()
+			if ch != nil {
+				ch <- msg
+			}
+		case msg.ID != nil:
+			if err := s.write(reply(msg)); err != nil {
+				slog.Debug("answering an MCP server", "error", err)
+			}
+		default:
+			s.onNotify(msg.Method)
+		}
+	}
+	<-s.stderrDone
+	err := s.cmd.Wait()
+	if err == nil {
+		err = errors.New("the server exited")
+	} else {
+		err = fmt.Errorf("the server exited: %w", err)
+	}
+	s.mu.Lock()
+	s.err = err
+	for id, ch := range s.pending {
+		close(ch)
+		delete(s.pending, id)
+	}
+	s.mu.Unlock()
+	close(s.exited)
+}
+
+func (s *stdio) write(msg message) error {
+	bts, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_, err = s.stdin.Write(append(bts, '\n'))
+	return err
+}
+
+func (s *stdio) call(ctx context.Context, req message) (message, error) {
+	ch := make(chan message, 1)
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return message{}, s.err
+	}
+	s.pending[*req.ID] = ch
+	s.mu.Unlock()
+	if err := s.write(req); err != nil {
+		return message{}, err
+	}
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return message{}, s.err
+		}
+		return resp, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		delete(s.pending, *req.ID)
+		s.mu.Unlock()
+		return message{}, ctx.Err()
+	}
+}
+
+func (s *stdio) notify(ctx context.Context, n message) error {
+	return s.write(n)
+}
+
+func (s *stdio) done() <-chan struct{} {
+	return s.exited
+}
+
+// close closes the input of the server, which should make it exit, and
+// kills it if it doesn't.
+func (s *stdio) close() error {
+	s.stdin.Close()
+	select {
+	case <-s.exited:
+	case <-time.After(stopTimeout):
+		s.cmd.Process.Kill()
+		<-s.exited
+	}
+	return nil
+}
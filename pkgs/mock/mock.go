@@ -0,0 +1,185 @@
+// Package mock provides an offline llminterface.Client for tests and demos.
+// It streams a canned reply word by word without talking to any provider.
+//
+// When tools are set, a prompt like `call read_file {"path": "go.mod"}` is
+// answered with a call of the tool, and the result of the tool with its
+// first line.
+//
+// A prompt asking for a shell command is answered with a proposal to echo
+// the request.
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"teachat/pkgs/llmclients"
+	"teachat/pkgs/llminterface"
+	"teachat/pkgs/shell"
+	"teachat/pkgs/types"
+)
+
+const (
+	Platform types.LLMPlatform = "mock"
+	Name     types.LLMModel    = "mock"
+)
+
+// Model is the model served by the mock platform.
+var Model = types.Model{Name: Name, Platform: Platform, Tools: true}
+
+// Register makes the mock platform and model available to llmclients and
+// types.FindModel. It is meant to be called from tests.
+func Register() {
+	llmclients.PlatformInitialization[Platform] = New
+	if _, ok := types.FindModel(Name); !ok {
+		types.SupportedModels = append(types.SupportedModels, Model)
+	}
+}
+
+// Client replies with Reply when set, or echoes the prompt otherwise.
+type Client struct {
+	Reply        string
+	model        types.LLMModel
+	systemPrompt string
+	parameters   types.Parameters
+	tools        []types.Tool
+	messages     []types.Message
+}
+
+func New(stream bool, httpClient *http.Client) (llminterface.Client, error) {
+	return &Client{}, nil
+}
+
+func (c *Client) SetModel(model types.LLMModel) {
+	c.model = model
+}
+
+func (c *Client) SetSystemPrompt(prompt string) {
+	c.systemPrompt = prompt
+}
+
+func (c *Client) SetParameters(parameters types.Parameters) {
+	c.parameters = parameters
+}
+
+func (c *Client) SetMessages(messages []types.Message) {
+	c.messages = append([]types.Message{}, messages...)
+}
+
+func (c *Client) SetTools(tools []types.Tool) {
+	c.tools = tools
+}
+
+// Tools returns the tools offered to the model.
+func (c *Client) Tools() []types.Tool {
+	return c.tools
+}
+
+// Messages returns the conversation as the client knows it.
+func (c *Client) Messages() []types.Message {
+	return c.messages
+}
+
+func (c *Client) Stream(ctx context.Context, prompt string) (<-chan types.StreamEvent, error) {
+	c.messages = append(c.messages, types.Message{Role: types.UserRole, Content: prompt})
+	reply := c.Reply
+	request, shellRequest := shell.Request(prompt)
+	switch {
+	case reply != "":
+	case shellRequest:
+		proposal, _ := json.Marshal(shell.Proposal{Command: "echo " + request, Explanation: "prints " + request})
+		reply = string(proposal)
+	default:
+		reply = "You said: " + prompt
+	}
+	if call, ok := c.toolCall(prompt); ok {
+		return c.callTool(ctx, call), nil
+	}
+	return c.reply(ctx, prompt, reply), nil
+}
+
+// Continue replies with the first line of the last message, the result of
+// a tool.
+func (c *Client) Continue(ctx context.Context) (<-chan types.StreamEvent, error) {
+	reply := c.Reply
+	if reply == "" && len(c.messages) > 0 {
+		last := c.messages[len(c.messages)-1]
+		first, _, _ := strings.Cut(strings.TrimSpace(last.Content), "\n")
+		reply = fmt.Sprintf("%s said: %s", last.Name, first)
+	}
+	return c.reply(ctx, "", reply), nil
+}
+
+// reply streams reply word by word.
+func (c *Client) reply(ctx context.Context, prompt, reply string) <-chan types.StreamEvent {
+	events := make(chan types.StreamEvent, llminterface.StreamBuffer)
+	go func() {
+		defer close(events)
+		tokens := tokenize(reply)
+		for _, token := range tokens {
+			if !llminterface.Send(ctx, events, types.StreamEvent{Type: types.TextDelta, Text: token}) {
+				return
+			}
+		}
+		c.messages = append(c.messages, types.Message{Role: types.AssistantRole, Content: reply})
+		promptTokens := len(strings.Fields(prompt))
+		usage := &types.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: len(tokens),
+			TotalTokens:      promptTokens + len(tokens),
+		}
+		if llminterface.Send(ctx, events, types.StreamEvent{Type: types.UsageEvent, Usage: usage}) {
+			llminterface.Send(ctx, events, types.StreamEvent{Type: types.DoneEvent})
+		}
+	}()
+	return events
+}
+
+// toolCall reads the tool call asked for by prompt, when the tool is set.
+func (c *Client) toolCall(prompt string) (types.ToolCall, bool) {
+	rest, ok := strings.CutPrefix(prompt, "call ")
+	if !ok {
+		return types.ToolCall{}, false
+	}
+	name, arguments, _ := strings.Cut(rest, " ")
+	if arguments == "" {
+		arguments = "{}"
+	}
+	for _, t := range c.tools {
+		if t.Name == name {
+			return types.ToolCall{ID: "call_" + name, Name: name, Arguments: arguments}, true
+		}
+	}
+	return types.ToolCall{}, false
+}
+
+// callTool replies with a call of a tool and no text.
+func (c *Client) callTool(ctx context.Context, call types.ToolCall) <-chan types.StreamEvent {
+	events := make(chan types.StreamEvent, llminterface.StreamBuffer)
+	go func() {
+		defer close(events)
+		c.messages = append(c.messages, types.Message{Role: types.AssistantRole, ToolCalls: []types.ToolCall{call}})
+		if llminterface.Send(ctx, events, types.StreamEvent{Type: types.ToolCallEvent, ToolCall: &call}) {
+			llminterface.Send(ctx, events, types.StreamEvent{Type: types.DoneEvent})
+		}
+	}()
+	return events
+}
+
+// tokenize splits s in words, keeping the separating spaces so that joining
+// the tokens gives back s.
+func tokenize(s string) []string {
+	var tokens []string
+	for len(s) > 0 {
+		i := strings.Index(s[1:], " ")
+		if i < 0 {
+			tokens = append(tokens, s)
+			break
+		}
+		tokens = append(tokens, s[:i+1])
+		s = s[i+1:]
+	}
+	return tokens
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
@@ -22,11 +23,14 @@ import (
 )
 
 type Client struct {
-	base     *url.URL
-	http     *http.Client
-	stream   bool
-	model    types.LLMModel
-	messages []Message
+	base         *url.URL
+	http         *http.Client
+	stream       bool
+	model        types.LLMModel
+	systemPrompt string
+	parameters   types.Parameters
+	tools        []Tool
+	messages     []Message
 }
 
 type OllamaHost struct {
@@ -35,23 +39,6 @@ type OllamaHost struct {
 	Port   string
 }
 
-type streamReader struct {
-	*bufio.Scanner
-	io.ReadCloser
-}
-
-func (s *streamReader) Scan() bool {
-	return s.Scanner.Scan()
-}
-
-func (s streamReader) Bytes() []byte {
-	return s.Scanner.Bytes()
-}
-
-func (s *streamReader) Close() {
-	s.ReadCloser.Close()
-}
-
 func GetOllamaHost() (OllamaHost, error) {
 	defaultPort := "11434"
 
@@ -91,10 +78,10 @@ func GetOllamaHost() (OllamaHost, error) {
 	}, nil
 }
 
-func New(stream bool) llminterface.Client {
+func New(stream bool, httpClient *http.Client) (llminterface.Client, error) {
 	ollamaHost, err := GetOllamaHost()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	return &Client{
 		stream: stream,
@@ -102,40 +89,175 @@ func New(stream bool) llminterface.Client {
 			Scheme: ollamaHost.Scheme,
 			Host:   net.JoinHostPort(ollamaHost.Host, ollamaHost.Port),
 		},
-		http: http.DefaultClient,
-	}
+		http: httpClient,
+	}, nil
 }
 
 func (c *Client) SetModel(model types.LLMModel) {
 	c.model = model
 }
 
-func (c *Client) Prompt(ctx context.Context, prompt string) (types.StreamReader, error) {
+func (c *Client) SetSystemPrompt(prompt string) {
+	c.systemPrompt = prompt
+}
+
+func (c *Client) SetParameters(parameters types.Parameters) {
+	c.parameters = parameters
+}
+
+func (c *Client) SetMessages(messages []types.Message) {
+	c.messages = make([]Message, len(messages))
+	for i, m := range messages {
+		c.messages[i] = Message{Role: string(m.Role), Content: m.Content}
+		for _, call := range m.ToolCalls {
+			arguments := json.RawMessage(call.Arguments)
+			if !json.Valid(arguments) {
+				arguments = json.RawMessage("{}")
+			}
+			c.messages[i].ToolCalls = append(c.messages[i].ToolCalls, ToolCall{Function: ToolCallFunction{Name: call.Name, Arguments: arguments}})
+		}
+	}
+}
+
+func (c *Client) SetTools(tools []types.Tool) {
+	c.tools = make([]Tool, len(tools))
+	for i, t := range tools {
+		c.tools[i] = Tool{Type: "function", Function: ToolFunction{Name: t.Name, Description: t.Description, Parameters: t.Parameters}}
+	}
+}
+
+func (c *Client) Stream(ctx context.Context, prompt string) (<-chan types.StreamEvent, error) {
 	c.messages = append(c.messages, Message{
 		Role:    "user",
 		Content: prompt,
 	})
+	return c.Continue(ctx)
+}
+
+func (c *Client) Continue(ctx context.Context) (<-chan types.StreamEvent, error) {
+	messages := c.messages
+	if c.systemPrompt != "" {
+		messages = append([]Message{{Role: "system", Content: c.systemPrompt}}, messages...)
+	}
 	req := ChatRequest{
 		Model:    string(c.model),
-		Messages: c.messages,
+		Messages: messages,
 		Stream:   utils.Ptr(c.stream),
+		Options:  c.options(),
+		Tools:    c.tools,
 	}
-	return c.getStream(ctx, http.MethodPost, "/api/chat", req)
+	body, err := c.getStream(ctx, http.MethodPost, "/api/chat", req)
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan types.StreamEvent, llminterface.StreamBuffer)
+	go c.readStream(ctx, body, events)
+	return events, nil
 }
 
-func (c Client) GetDelta(ctx context.Context, stream types.StreamReader) (*types.ChatResponse, types.StreamReader, error) {
-	var resp ChatResponse
-	stream.Scan()
-	if err := json.Unmarshal(stream.Bytes(), &resp); err != nil {
-		return nil, stream, err
+// readStream decodes the NDJSON reply into events. The reply is added to
+// the history once complete. Tool calls come in a chunk of their own, they
+// are numbered to be told apart since Ollama doesn't give them an ID.
+func (c *Client) readStream(ctx context.Context, body io.ReadCloser, events chan<- types.StreamEvent) {
+	defer close(events)
+	defer body.Close()
+	fail := func(err error) {
+		llminterface.Send(ctx, events, types.StreamEvent{Type: types.ErrorEvent, Err: err})
 	}
-	return &types.ChatResponse{
-		Done: resp.Done,
-		Text: resp.Message.Content,
-	}, stream, nil
+
+	var reply strings.Builder
+	var calls []ToolCall
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), 1<<20)
+	for scanner.Scan() {
+		var resp struct {
+			ChatResponse
+			Error string `json:"error,omitempty"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			fail(err)
+			return
+		}
+		if resp.Error != "" {
+			fail(StatusError{ErrorMessage: resp.Error})
+			return
+		}
+		calls = append(calls, resp.Message.ToolCalls...)
+		if resp.Message.Content != "" {
+			reply.WriteString(resp.Message.Content)
+			if !llminterface.Send(ctx, events, types.StreamEvent{Type: types.TextDelta, Text: resp.Message.Content}) {
+				return
+			}
+		}
+		if resp.Done {
+			c.messages = append(c.messages, Message{
+				Role:      "assistant",
+				Content:   reply.String(),
+				ToolCalls: calls,
+			})
+			for i, call := range calls {
+				ev := types.StreamEvent{Type: types.ToolCallEvent, ToolCall: &types.ToolCall{
+					ID:        fmt.Sprintf("call_%d", i),
+					Name:      call.Function.Name,
+					Arguments: string(call.Function.Arguments),
+				}}
+				if !llminterface.Send(ctx, events, ev) {
+					return
+				}
+			}
+			usage := &types.Usage{
+				PromptTokens:     resp.PromptEvalCount,
+				CompletionTokens: resp.EvalCount,
+				TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
+			}
+			if llminterface.Send(ctx, events, types.StreamEvent{Type: types.UsageEvent, Usage: usage}) {
+				llminterface.Send(ctx, events, types.StreamEvent{Type: types.DoneEvent})
+			}
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fail(err)
+		return
+	}
+	fail(io.ErrUnexpectedEOF)
 }
 
-func (c Client) getStream(ctx context.Context, method, path string, data any) (types.StreamReader, error) {
+// Tokenize encodes text with the tokenizer of the model. Servers without
+// the tokenize endpoint answer with a 404 StatusError.
+func (c *Client) Tokenize(ctx context.Context, text string) ([]int, error) {
+	body, err := c.getStream(ctx, http.MethodPost, "/api/tokenize", TokenizeRequest{Model: string(c.model), Text: text})
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var resp TokenizeResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return nil, err
+	}
+	return resp.Tokens, nil
+}
+
+func (c Client) options() map[string]interface{} {
+	options := map[string]interface{}{}
+	if c.parameters.Temperature != nil {
+		options["temperature"] = *c.parameters.Temperature
+	}
+	if c.parameters.TopP != nil {
+		options["top_p"] = *c.parameters.TopP
+	}
+	if c.parameters.MaxTokens > 0 {
+		options["num_predict"] = c.parameters.MaxTokens
+	}
+	if c.parameters.ContextWindow > 0 {
+		// Ollama runs models with a small context by default and silently
+		// cuts longer conversations
+		options["num_ctx"] = c.parameters.ContextWindow
+	}
+	return options
+}
+
+func (c Client) getStream(ctx context.Context, method, path string, data any) (io.ReadCloser, error) {
 	var buf *bytes.Buffer
 	if data != nil {
 		bts, err := json.Marshal(data)
@@ -150,7 +272,7 @@ func (c Client) getStream(ctx context.Context, method, path string, data any) (t
 	}
 
 	requestURL := c.base.JoinPath(path)
-	utils.LogToFile("ollama.log", "info", fmt.Sprintf("requestURL: %s", requestURL.String()))
+	slog.Debug("ollama request", "method", method, "url", requestURL.String(), "model", c.model)
 	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), buf)
 	if err != nil {
 		return nil, err
@@ -164,10 +286,13 @@ func (c Client) getStream(ctx context.Context, method, path string, data any) (t
 	if err != nil {
 		return nil, err
 	}
+	if response.StatusCode >= http.StatusBadRequest {
+		defer response.Body.Close()
+		statusError := StatusError{StatusCode: response.StatusCode, Status: response.Status}
+		bts, _ := io.ReadAll(response.Body)
+		json.Unmarshal(bts, &statusError)
+		return nil, statusError
+	}
 
-	scanner := bufio.NewScanner(response.Body)
-	return &streamReader{
-		Scanner:    scanner,
-		ReadCloser: response.Body,
-	}, nil
+	return response.Body, nil
 }
@@ -0,0 +1,182 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"teachat/pkgs/cassette"
+	"teachat/pkgs/types"
+)
+
+// newClient creates a client sending its requests with httpClient.
+func newClient(t *testing.T, httpClient *http.Client) *Client {
+	t.Helper()
+	c, err := New(true, httpClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.(*Client)
+}
+
+func replayClient(t *testing.T) *Client {
+	t.Helper()
+	httpClient, err := cassette.NewHTTPClient(cassette.ModeReplay, "testdata/chat.json", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(t, httpClient)
+	c.SetModel(types.Llama3)
+	return c
+}
+
+func TestStream(t *testing.T) {
+	c := replayClient(t)
+	events, err := c.Stream(context.Background(), "Why is the sky blue?")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var text string
+	var deltas int
+	var usage *types.Usage
+	var last types.StreamEvent
+	for ev := range events {
+		switch ev.Type {
+		case types.TextDelta:
+			text += ev.Text
+			deltas++
+		case types.UsageEvent:
+			usage = ev.Usage
+		case types.ErrorEvent:
+			t.Fatal(ev.Err)
+		}
+		last = ev
+	}
+	if last.Type != types.DoneEvent {
+		t.Errorf("expected the stream to end with a DoneEvent, got %+v", last)
+	}
+	if want := "The sky is blue because of Rayleigh scattering."; text != want {
+		t.Errorf("expected %q, got %q", want, text)
+	}
+	if deltas != 9 {
+		t.Errorf("expected 9 deltas, got %d", deltas)
+	}
+	if want := (types.Usage{PromptTokens: 14, CompletionTokens: 9, TotalTokens: 23}); usage == nil || *usage != want {
+		t.Errorf("expected usage %+v, got %+v", want, usage)
+	}
+	if len(c.messages) != 2 || c.messages[1].Role != "assistant" || c.messages[1].Content != text {
+		t.Errorf("expected the reply to be added to the history, got %+v", c.messages)
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	c := replayClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := c.Stream(ctx, "Why is the sky blue?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-events
+	cancel()
+	for ev := range events {
+		if ev.Type == types.DoneEvent {
+			// the remaining chunks may already be buffered
+			return
+		}
+	}
+}
+
+func TestStreamStatusError(t *testing.T) {
+	c := replayClient(t)
+	// the first recorded interaction is the successful chat
+	events, err := c.Stream(context.Background(), "Why is the sky blue?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range events {
+	}
+
+	_, err = c.Stream(context.Background(), "hello")
+	var statusErr StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("expected a StatusError, got %v", err)
+	}
+	if statusErr.StatusCode != http.StatusNotFound || statusErr.ErrorMessage != `model "llama9" not found, try pulling it first` {
+		t.Errorf("unexpected error %+v", statusErr)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tokenize" {
+			http.NotFound(w, r)
+			return
+		}
+		var req TokenizeRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != string(types.Llama3) {
+			t.Errorf("expected the model to be sent, got %q", req.Model)
+		}
+		json.NewEncoder(w).Encode(TokenizeResponse{Tokens: make([]int, len(strings.Fields(req.Text)))})
+	}))
+	defer ts.Close()
+	t.Setenv("OLLAMA_HOST", ts.URL)
+	c := newClient(t, ts.Client())
+	c.SetModel(types.Llama3)
+	tokens, err := c.Tokenize(context.Background(), "why is the sky blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 5 {
+		t.Errorf("expected 5 tokens, got %d", len(tokens))
+	}
+}
+
+func TestStreamToolCalls(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Tools) != 1 || req.Tools[0].Function.Name != "current_time" {
+			t.Errorf("expected the tools to be sent, got %+v", req.Tools)
+		}
+		io.WriteString(w, `{"model":"llama3","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"current_time","arguments":{"timezone":"UTC"}}}]},"done":false}`+"\n")
+		io.WriteString(w, `{"model":"llama3","message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":20,"eval_count":10}`+"\n")
+	}))
+	defer ts.Close()
+	t.Setenv("OLLAMA_HOST", ts.URL)
+	c := newClient(t, ts.Client())
+	c.SetModel(types.Llama3)
+	c.SetTools([]types.Tool{{Name: "current_time", Description: "Get the current time.", Parameters: json.RawMessage(`{"type": "object"}`)}})
+	events, err := c.Stream(context.Background(), "What time is it?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls []types.ToolCall
+	for ev := range events {
+		switch ev.Type {
+		case types.ToolCallEvent:
+			calls = append(calls, *ev.ToolCall)
+		case types.ErrorEvent:
+			t.Fatal(ev.Err)
+		}
+	}
+	if len(calls) != 1 || calls[0].Name != "current_time" || calls[0].Arguments != `{"timezone":"UTC"}` || calls[0].ID == "" {
+		t.Errorf("expected a call of current_time, got %+v", calls)
+	}
+	if len(c.messages) != 2 || len(c.messages[1].ToolCalls) != 1 {
+		t.Errorf("expected the reply to be added to the history with its calls, got %+v", c.messages)
+	}
+}
+
+func TestNewInvalidHost(t *testing.T) {
+	t.Setenv("OLLAMA_HOST", "localhost:99999")
+	if _, err := New(true, http.DefaultClient); !errors.Is(err, ErrInvalidHostPort) {
+		t.Errorf("expected the host to be refused, got %v", err)
+	}
+}
@@ -3,105 +3,194 @@ package openai
 import (
 	"context"
 	"errors"
-	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
 	"os"
+	"strings"
 	"teachat/pkgs/llminterface"
 	"teachat/pkgs/types"
-	"teachat/pkgs/utils"
 
 	openai "github.com/sashabaranov/go-openai"
 )
 
-func New(stream bool) llminterface.Client {
+func New(stream bool, httpClient *http.Client) (llminterface.Client, error) {
 	openai_api_key := os.Getenv("OPENAI_API_KEY")
-	c := openai.NewClient(openai_api_key)
+	config := openai.DefaultConfig(openai_api_key)
+	config.HTTPClient = httpClient
+	c := openai.NewClientWithConfig(config)
 	messages := make([]openai.ChatCompletionMessage, 0)
 	// default type
 	return &Client{
 		Client:   c,
 		stream:   stream,
 		messages: messages,
-	}
+	}, nil
 }
 
 func (c *Client) SetModel(model types.LLMModel) {
 	c.model = model
 }
 
-type streamReader struct {
-	done     bool
-	stream   *openai.ChatCompletionStream
-	response openai.ChatCompletionStreamResponse
+func (c *Client) SetSystemPrompt(prompt string) {
+	c.systemPrompt = prompt
 }
 
-// The idea is to mimic the behavior of bufio.Scanner
-// So, if there are no more tokens to scan, we return false
-// If there is an error, we panic
-func (s *streamReader) Scan() bool {
-	response, err := s.stream.Recv()
-	if errors.Is(err, io.EOF) {
-		return false
-	}
-	if err != nil {
-		s.stream.Close()
-		panic(err)
-	}
-	s.response = response
-	return true
+func (c *Client) SetParameters(parameters types.Parameters) {
+	c.parameters = parameters
 }
 
-func (s *streamReader) Close() {
-	s.stream.Close()
+func (c *Client) SetMessages(messages []types.Message) {
+	c.messages = make([]openai.ChatCompletionMessage, len(messages))
+	for i, m := range messages {
+		c.messages[i] = openai.ChatCompletionMessage{Role: string(m.Role), Content: m.Content, ToolCallID: m.ToolCallID, Name: m.Name}
+		for _, call := range m.ToolCalls {
+			c.messages[i].ToolCalls = append(c.messages[i].ToolCalls, openai.ToolCall{
+				ID:       call.ID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: call.Name, Arguments: call.Arguments},
+			})
+		}
+	}
 }
 
-func (s streamReader) Bytes() []byte {
-	return []byte(s.response.Choices[0].Delta.Content)
+func (c *Client) SetTools(tools []types.Tool) {
+	c.tools = make([]openai.Tool, len(tools))
+	for i, t := range tools {
+		c.tools[i] = openai.Tool{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+			Name:        t.Name,
+			Description: t.Description,
+			Parameters:  t.Parameters,
+		}}
+	}
 }
 
 type Client struct {
-	messages        []openai.ChatCompletionMessage
-	currentResponse string
+	messages []openai.ChatCompletionMessage
 	*openai.Client
-	model  types.LLMModel
-	stream bool
+	model        types.LLMModel
+	systemPrompt string
+	parameters   types.Parameters
+	tools        []openai.Tool
+	stream       bool
 }
 
-func (c *Client) Prompt(ctx context.Context, prompt string) (types.StreamReader, error) {
+func (c *Client) Stream(ctx context.Context, prompt string) (<-chan types.StreamEvent, error) {
 	c.messages = append(c.messages, openai.ChatCompletionMessage{
 		Role:    openai.ChatMessageRoleUser,
 		Content: prompt,
 	})
-	for _, message := range c.messages {
-		utils.LogToFile("openai.log", "info", fmt.Sprintf("role: %s, message: %s", message.Role, message.Content))
+	return c.Continue(ctx)
+}
+
+func (c *Client) Continue(ctx context.Context) (<-chan types.StreamEvent, error) {
+	slog.Debug("openai request", "model", c.model, "messages", len(c.messages))
+	messages := c.messages
+	if c.systemPrompt != "" {
+		messages = append([]openai.ChatCompletionMessage{{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: c.systemPrompt,
+		}}, messages...)
 	}
 	req := openai.ChatCompletionRequest{
-		Model:    string(c.model),
-		Messages: c.messages,
-		Stream:   c.stream,
+		Model:         string(c.model),
+		Messages:      messages,
+		Stream:        c.stream,
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+		MaxTokens:     c.parameters.MaxTokens,
+		Tools:         c.tools,
+	}
+	if c.parameters.Temperature != nil {
+		req.Temperature = *c.parameters.Temperature
+	}
+	if c.parameters.TopP != nil {
+		req.TopP = *c.parameters.TopP
 	}
 	chatStream, err := c.Client.CreateChatCompletionStream(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-	return &streamReader{
-		stream: chatStream,
-	}, nil
+	events := make(chan types.StreamEvent, llminterface.StreamBuffer)
+	go c.readStream(ctx, chatStream, events)
+	return events, nil
+}
+
+// readStream turns the SSE chunks into events. The reply is added to the
+// history once complete. Tool calls are streamed in pieces, they are sent
+// once complete, at the end of the reply.
+func (c *Client) readStream(ctx context.Context, stream *openai.ChatCompletionStream, events chan<- types.StreamEvent) {
+	defer close(events)
+	defer stream.Close()
+
+	var reply strings.Builder
+	var calls []openai.ToolCall
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			c.messages = append(c.messages, openai.ChatCompletionMessage{
+				Role:      openai.ChatMessageRoleAssistant,
+				Content:   reply.String(),
+				ToolCalls: calls,
+			})
+			for _, call := range calls {
+				ev := types.StreamEvent{Type: types.ToolCallEvent, ToolCall: &types.ToolCall{
+					ID:        call.ID,
+					Name:      call.Function.Name,
+					Arguments: call.Function.Arguments,
+				}}
+				if !llminterface.Send(ctx, events, ev) {
+					return
+				}
+			}
+			llminterface.Send(ctx, events, types.StreamEvent{Type: types.DoneEvent})
+			return
+		}
+		if err != nil {
+			llminterface.Send(ctx, events, types.StreamEvent{Type: types.ErrorEvent, Err: err})
+			return
+		}
+		// the usage is sent in a last chunk without choices
+		if usage := response.Usage; usage != nil {
+			if !llminterface.Send(ctx, events, types.StreamEvent{Type: types.UsageEvent, Usage: &types.Usage{
+				PromptTokens:     usage.PromptTokens,
+				CompletionTokens: usage.CompletionTokens,
+				TotalTokens:      usage.TotalTokens,
+			}}) {
+				return
+			}
+		}
+		if len(response.Choices) == 0 {
+			continue
+		}
+		calls = appendToolCalls(calls, response.Choices[0].Delta.ToolCalls)
+		if response.Choices[0].Delta.Content == "" {
+			continue
+		}
+		delta := response.Choices[0].Delta.Content
+		reply.WriteString(delta)
+		if !llminterface.Send(ctx, events, types.StreamEvent{Type: types.TextDelta, Text: delta}) {
+			return
+		}
+	}
 }
 
-func (c *Client) GetDelta(ctx context.Context, stream types.StreamReader) (*types.ChatResponse, types.StreamReader, error) {
-	openaiStream := stream.(*streamReader)
-	done := !stream.Scan()
-	c.currentResponse = c.currentResponse + openaiStream.response.Choices[0].Delta.Content
-	if done {
-		c.messages = append(c.messages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleAssistant,
-			Content: c.currentResponse,
-		})
-		c.currentResponse = ""
+// appendToolCalls merges the pieces of tool calls of a chunk. The first
+// piece of a call has its ID and name, the arguments follow.
+func appendToolCalls(calls []openai.ToolCall, pieces []openai.ToolCall) []openai.ToolCall {
+	for _, piece := range pieces {
+		index := len(calls)
+		if piece.Index != nil {
+			index = *piece.Index
+		}
+		for len(calls) <= index {
+			calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+		}
+		call := &calls[index]
+		if piece.ID != "" {
+			call.ID = piece.ID
+		}
+		call.Function.Name += piece.Function.Name
+		call.Function.Arguments += piece.Function.Arguments
 	}
-	return &types.ChatResponse{
-		Done: done,
-		Text: openaiStream.response.Choices[0].Delta.Content,
-	}, stream, nil
+	return calls
 }
@@ -0,0 +1,101 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"teachat/pkgs/cassette"
+	"teachat/pkgs/llminterface"
+	"teachat/pkgs/types"
+)
+
+// newClient creates a client sending its requests with httpClient.
+func newClient(t *testing.T, httpClient *http.Client) *Client {
+	t.Helper()
+	c, err := New(true, httpClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.(*Client)
+}
+
+func TestStream(t *testing.T) {
+	httpClient, err := cassette.NewHTTPClient(cassette.ModeReplay, "testdata/chat.json", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(t, httpClient)
+	c.SetModel(types.GPT4o)
+	events, err := c.Stream(context.Background(), "Why is the sky blue?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, usage, err := llminterface.Collect(context.Background(), events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "The sky is blue because of Rayleigh scattering."; text != want {
+		t.Errorf("expected %q, got %q", want, text)
+	}
+	// the usage arrives in a chunk without choices
+	if want := (types.Usage{PromptTokens: 14, CompletionTokens: 9, TotalTokens: 23}); usage == nil || *usage != want {
+		t.Errorf("expected usage %+v, got %+v", want, usage)
+	}
+	if len(c.messages) != 2 || c.messages[1].Content != text {
+		t.Errorf("expected the reply to be added to the history, got %+v", c.messages)
+	}
+}
+
+func TestStreamToolCalls(t *testing.T) {
+	httpClient, err := cassette.NewHTTPClient(cassette.ModeReplay, "testdata/tools.json", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(t, httpClient)
+	c.SetModel(types.GPT4o)
+	c.SetTools([]types.Tool{
+		{Name: "read_file", Description: "Read a text file.", Parameters: json.RawMessage(`{"type": "object", "properties": {"path": {"type": "string"}}, "required": ["path"]}`)},
+		{Name: "current_time", Description: "Get the current date and time.", Parameters: json.RawMessage(`{"type": "object", "properties": {}}`)},
+	})
+	events, err := c.Stream(context.Background(), "What module is this?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls []types.ToolCall
+	var last types.StreamEvent
+	for ev := range events {
+		if ev.Type == types.ToolCallEvent {
+			calls = append(calls, *ev.ToolCall)
+		}
+		last = ev
+	}
+	if last.Type != types.DoneEvent {
+		t.Fatalf("expected the reply to end with a DoneEvent, got %+v", last)
+	}
+	want := []types.ToolCall{
+		{ID: "call_abc", Name: "read_file", Arguments: `{"path": "go.mod"}`},
+		{ID: "call_def", Name: "current_time", Arguments: "{}"},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("expected the pieces of the calls to be joined, got %+v", calls)
+	}
+	if len(c.messages) != 2 || len(c.messages[1].ToolCalls) != 2 {
+		t.Errorf("expected the reply to be added to the history with its calls, got %+v", c.messages)
+	}
+
+	// the results are sent back without a new prompt
+	c.SetMessages([]types.Message{
+		{Role: types.UserRole, Content: "What module is this?"},
+		{Role: types.AssistantRole, ToolCalls: want},
+		{Role: types.ToolRole, ToolCallID: "call_abc", Name: "read_file", Content: "module teachat"},
+	})
+	if m := c.messages[1].ToolCalls[0]; m.ID != "call_abc" || m.Function.Arguments != `{"path": "go.mod"}` {
+		t.Errorf("expected the calls to be sent back, got %+v", m)
+	}
+	if m := c.messages[2]; m.Role != "tool" || m.ToolCallID != "call_abc" {
+		t.Errorf("expected the result to answer the call, got %+v", m)
+	}
+}
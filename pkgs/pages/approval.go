@@ -0,0 +1,68 @@
+package pages
+
+import (
+	"teachat/pkgs/config"
+	"teachat/pkgs/sections"
+	"teachat/pkgs/styles"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Approval is shown over the chat while the user is asked about a tool call.
+type Approval struct {
+	current  bool
+	name     PageName
+	sections map[sections.SectionName]sections.Section
+	layout   *Layout
+}
+
+func NewApprovalPage() PageInterface {
+	p := &Approval{}
+	p.name = ApprovalPage
+	p.AddSection(sections.NewApproval())
+	p.layout = NewLayout(config.Layout{}, sections.ApprovalSection, sections.ApprovalSection)
+	return p
+}
+
+func (p *Approval) IsCurrentPage() bool {
+	return p.current
+}
+
+func (p *Approval) SetAsCurrentPage() {
+	p.current = true
+}
+
+func (p *Approval) UnsetCurrentPage() {
+	p.current = false
+}
+
+func (p *Approval) GetPageName() PageName {
+	return p.name
+}
+
+func (p *Approval) AddSection(section sections.Section) {
+	if p.sections == nil {
+		p.sections = make(map[sections.SectionName]sections.Section)
+	}
+	section.SetDimensions(0, styles.Height)
+	section.Show()
+	section.Focus()
+	p.sections[section.GetSectionName()] = section
+}
+
+func (p *Approval) View() string {
+	return p.layout.View(p.sections)
+}
+
+func (p *Approval) Update(msg tea.Msg) (PageInterface, tea.Cmd) {
+	if p.current {
+		sec, cmd := p.sections[sections.ApprovalSection].Update(msg)
+		p.sections[sections.ApprovalSection] = sec
+		return p, cmd
+	}
+	return p, nil
+}
+
+func (p *Approval) SetDimensions(width, height int) {
+	p.layout.Apply(width, height, p.sections)
+}
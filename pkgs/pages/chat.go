@@ -1,6 +1,8 @@
 package pages
 
 import (
+	"teachat/pkgs/config"
+	"teachat/pkgs/history"
 	"teachat/pkgs/sections"
 	"teachat/pkgs/styles"
 	"teachat/pkgs/teamsg"
@@ -13,13 +15,18 @@ type Chat struct {
 	name            PageName
 	sections        map[sections.SectionName]sections.Section
 	orderedSections []sections.SectionName
+	layout          *Layout
+	width, height   int
+	// usage is the context usage shown in the status bar.
+	usage teamsg.ContextUsageMsg
 }
 
-func NewChatPage() PageInterface {
+func NewChatPage(cfg config.Config, store *history.Store) PageInterface {
 	p := &Chat{}
 	p.name = ChatPage
 	p.AddSection(sections.NewPrompt())
-	p.AddSection(sections.NewConvo())
+	p.AddSection(sections.NewConvo(cfg, store))
+	p.layout = NewLayout(cfg.Layout, sections.ConvoSection, sections.PromptSection, sections.ConvoSection)
 	p.switchSection()
 	return p
 }
@@ -58,22 +65,41 @@ func (p *Chat) AddSection(section sections.Section) {
 
 func (p *Chat) Update(msg tea.Msg) (PageInterface, tea.Cmd) {
 	var cmds []tea.Cmd
+	if usage, ok := msg.(teamsg.ContextUsageMsg); ok {
+		p.usage = usage
+		return p, nil
+	}
 	if !p.current {
-		switch msg := msg.(type) {
-		case tea.WindowSizeMsg, teamsg.ModelSelectedMsg, teamsg.GetSupportedModelsMsg:
-			// update all sections
-			for i, s := range p.sections {
-				var cmd tea.Cmd
-				s, cmd = s.Update(msg)
-				cmds = append(cmds, cmd)
-				p.sections[i] = s
+		switch msg.(type) {
+		case tea.WindowSizeMsg, teamsg.ModelSelectedMsg, teamsg.GetSupportedModelsMsg, teamsg.MCPServersMsg:
+		default:
+			// a reply or a command goes on behind the page on top
+			if !sections.Background(msg) {
+				return p, nil
 			}
-			return p, tea.Batch(cmds...)
 		}
-		return p, nil
+		// update all sections
+		for i, s := range p.sections {
+			var cmd tea.Cmd
+			s, cmd = s.Update(msg)
+			cmds = append(cmds, cmd)
+			p.sections[i] = s
+		}
+		return p, tea.Batch(cmds...)
 	}
 	switch msg := msg.(type) {
+	case teamsg.EditMessageMsg, teamsg.QuoteMsg, teamsg.EditTitleMsg, teamsg.MCPPromptMsg, teamsg.AttachMsg:
+		// the message or title is edited, a message quoted or a document
+		// attached, in the prompt
+		for _, name := range p.orderedSections {
+			p.sections[name].Blur()
+		}
+		p.sections[sections.PromptSection].Focus()
 	case tea.KeyMsg:
+		if handled, cmd := p.layout.HandleKey(msg, p.focusedSection()); handled {
+			p.layout.Apply(p.width, p.height, p.sections)
+			return p, cmd
+		}
 		switch msg.Type {
 		case tea.KeyUp, tea.KeyDown, tea.KeyEnd:
 			sec, cmd := p.sections[sections.ConvoSection].Update(msg)
@@ -95,18 +121,23 @@ func (p *Chat) Update(msg tea.Msg) (PageInterface, tea.Cmd) {
 }
 
 func (p *Chat) View() string {
-	var view string
-	for _, section := range p.orderedSections {
-		if !p.sections[section].IsHidden() {
-			view = attachView(view, p.sections[section].View())
-		}
-	}
-	return view
+	return p.layout.View(p.sections) + "\n" + statusBar(p.usage, p.width)
 }
 
 func (p *Chat) SetDimensions(width, height int) {
-	p.sections[sections.ConvoSection].SetDimensions(int(float64(width)*0.7), height)
-	p.sections[sections.PromptSection].SetDimensions(int(float64(width)*0.2), height)
+	p.width = width
+	// the status bar takes a line
+	p.height = height - 1
+	p.layout.Apply(width, p.height, p.sections)
+}
+
+func (p *Chat) focusedSection() sections.SectionName {
+	for _, name := range p.orderedSections {
+		if p.sections[name].IsFocused() {
+			return name
+		}
+	}
+	return ""
 }
 
 func (p *Chat) switchSection() {
@@ -0,0 +1,68 @@
+package pages
+
+import (
+	"teachat/pkgs/config"
+	"teachat/pkgs/sections"
+	"teachat/pkgs/styles"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Command is shown over the chat while the user confirms a shell command.
+type Command struct {
+	current  bool
+	name     PageName
+	sections map[sections.SectionName]sections.Section
+	layout   *Layout
+}
+
+func NewCommandPage(sendOutput bool) PageInterface {
+	p := &Command{}
+	p.name = CommandPage
+	p.AddSection(sections.NewCommand(sendOutput))
+	p.layout = NewLayout(config.Layout{}, sections.CommandSection, sections.CommandSection)
+	return p
+}
+
+func (p *Command) IsCurrentPage() bool {
+	return p.current
+}
+
+func (p *Command) SetAsCurrentPage() {
+	p.current = true
+}
+
+func (p *Command) UnsetCurrentPage() {
+	p.current = false
+}
+
+func (p *Command) GetPageName() PageName {
+	return p.name
+}
+
+func (p *Command) AddSection(section sections.Section) {
+	if p.sections == nil {
+		p.sections = make(map[sections.SectionName]sections.Section)
+	}
+	section.SetDimensions(0, styles.Height)
+	section.Show()
+	section.Focus()
+	p.sections[section.GetSectionName()] = section
+}
+
+func (p *Command) View() string {
+	return p.layout.View(p.sections)
+}
+
+func (p *Command) Update(msg tea.Msg) (PageInterface, tea.Cmd) {
+	if p.current {
+		sec, cmd := p.sections[sections.CommandSection].Update(msg)
+		p.sections[sections.CommandSection] = sec
+		return p, cmd
+	}
+	return p, nil
+}
+
+func (p *Command) SetDimensions(width, height int) {
+	p.layout.Apply(width, height, p.sections)
+}
@@ -0,0 +1,68 @@
+package pages
+
+import (
+	"teachat/pkgs/config"
+	"teachat/pkgs/sections"
+	"teachat/pkgs/styles"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Edits is shown over the chat to preview and apply the edits of a reply.
+type Edits struct {
+	current  bool
+	name     PageName
+	sections map[sections.SectionName]sections.Section
+	layout   *Layout
+}
+
+func NewEditsPage() PageInterface {
+	p := &Edits{}
+	p.name = EditsPage
+	p.AddSection(sections.NewEdits("."))
+	p.layout = NewLayout(config.Layout{}, sections.EditsSection, sections.EditsSection)
+	return p
+}
+
+func (p *Edits) IsCurrentPage() bool {
+	return p.current
+}
+
+func (p *Edits) SetAsCurrentPage() {
+	p.current = true
+}
+
+func (p *Edits) UnsetCurrentPage() {
+	p.current = false
+}
+
+func (p *Edits) GetPageName() PageName {
+	return p.name
+}
+
+func (p *Edits) AddSection(section sections.Section) {
+	if p.sections == nil {
+		p.sections = make(map[sections.SectionName]sections.Section)
+	}
+	section.SetDimensions(0, styles.Height)
+	section.Show()
+	section.Focus()
+	p.sections[section.GetSectionName()] = section
+}
+
+func (p *Edits) View() string {
+	return p.layout.View(p.sections)
+}
+
+func (p *Edits) Update(msg tea.Msg) (PageInterface, tea.Cmd) {
+	if p.current {
+		sec, cmd := p.sections[sections.EditsSection].Update(msg)
+		p.sections[sections.EditsSection] = sec
+		return p, cmd
+	}
+	return p, nil
+}
+
+func (p *Edits) SetDimensions(width, height int) {
+	p.layout.Apply(width, height, p.sections)
+}
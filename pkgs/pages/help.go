@@ -1,6 +1,7 @@
 package pages
 
 import (
+	"teachat/pkgs/config"
 	"teachat/pkgs/sections"
 	"teachat/pkgs/styles"
 
@@ -11,12 +12,14 @@ type Help struct {
 	current  bool
 	name     PageName
 	sections map[sections.SectionName]sections.Section
+	layout   *Layout
 }
 
 func NewHelpPage() PageInterface {
 	p := &Help{}
 	p.name = HelpPage
 	p.AddSection(sections.NewHelp())
+	p.layout = NewLayout(config.Layout{}, sections.HelpSection, sections.HelpSection)
 	return p
 }
 
@@ -47,7 +50,7 @@ func (p *Help) AddSection(section sections.Section) {
 }
 
 func (p *Help) View() string {
-	return p.sections[sections.HelpSection].View()
+	return p.layout.View(p.sections)
 }
 
 func (p *Help) Update(msg tea.Msg) (PageInterface, tea.Cmd) {
@@ -60,5 +63,5 @@ func (p *Help) Update(msg tea.Msg) (PageInterface, tea.Cmd) {
 }
 
 func (p *Help) SetDimensions(width, height int) {
-	p.sections[sections.HelpSection].SetDimensions(width, height)
+	p.layout.Apply(width, height, p.sections)
 }
@@ -0,0 +1,68 @@
+package pages
+
+import (
+	"teachat/pkgs/config"
+	"teachat/pkgs/history"
+	"teachat/pkgs/sections"
+	"teachat/pkgs/styles"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type HistorySearch struct {
+	current  bool
+	name     PageName
+	sections map[sections.SectionName]sections.Section
+	layout   *Layout
+}
+
+func NewHistorySearchPage(store *history.Store) PageInterface {
+	p := &HistorySearch{}
+	p.name = HistorySearchPage
+	p.AddSection(sections.NewHistorySearch(store))
+	p.layout = NewLayout(config.Layout{}, sections.HistorySearchSection, sections.HistorySearchSection)
+	return p
+}
+
+func (p *HistorySearch) IsCurrentPage() bool {
+	return p.current
+}
+
+func (p *HistorySearch) SetAsCurrentPage() {
+	p.current = true
+}
+
+func (p *HistorySearch) UnsetCurrentPage() {
+	p.current = false
+}
+
+func (p *HistorySearch) GetPageName() PageName {
+	return p.name
+}
+
+func (p *HistorySearch) AddSection(section sections.Section) {
+	if p.sections == nil {
+		p.sections = make(map[sections.SectionName]sections.Section)
+	}
+	section.SetDimensions(0, styles.Height)
+	section.Show()
+	section.Focus()
+	p.sections[section.GetSectionName()] = section
+}
+
+func (p *HistorySearch) View() string {
+	return p.layout.View(p.sections)
+}
+
+func (p *HistorySearch) Update(msg tea.Msg) (PageInterface, tea.Cmd) {
+	if p.current {
+		sec, cmd := p.sections[sections.HistorySearchSection].Update(msg)
+		p.sections[sections.HistorySearchSection] = sec
+		return p, cmd
+	}
+	return p, nil
+}
+
+func (p *HistorySearch) SetDimensions(width, height int) {
+	p.layout.Apply(width, height, p.sections)
+}
@@ -0,0 +1,265 @@
+package pages
+
+import (
+	"log/slog"
+	"math"
+	"teachat/pkgs/config"
+	"teachat/pkgs/sections"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// LayoutMode tells how the panes of a page are arranged.
+type LayoutMode string
+
+const (
+	// HorizontalLayout puts the panes side by side.
+	HorizontalLayout LayoutMode = "horizontal"
+	// VerticalLayout stacks the panes, the input pane on top.
+	VerticalLayout LayoutMode = "vertical"
+	// PromptBottomLayout stacks the panes, the input pane at the bottom.
+	PromptBottomLayout LayoutMode = "prompt-bottom"
+)
+
+var layoutModes = []LayoutMode{HorizontalLayout, VerticalLayout, PromptBottomLayout}
+
+const (
+	defaultRatio      = 0.75
+	defaultStackBelow = 60
+	ratioStep         = 0.05
+	minRatio          = 0.2
+	maxRatio          = 0.9
+
+	// gutter is the number of columns left of each pane.
+	gutter = 2
+	// paneChrome is the number of lines taken by the borders of a pane.
+	paneChrome = 2
+)
+
+type paneSize struct {
+	width, height int
+}
+
+// Layout splits the space of a page between its panes. Panes are given in
+// display order, input pane first, and the main pane gets the configured
+// ratio of the space.
+type Layout struct {
+	mode       LayoutMode
+	ratio      float64
+	stackBelow int
+
+	panes     []sections.SectionName
+	main      sections.SectionName
+	collapsed map[sections.SectionName]bool
+	maximized sections.SectionName
+
+	width, height int
+}
+
+func NewLayout(cfg config.Layout, main sections.SectionName, panes ...sections.SectionName) *Layout {
+	l := &Layout{
+		mode:       LayoutMode(cfg.Mode),
+		ratio:      cfg.Ratio,
+		stackBelow: cfg.StackBelow,
+		panes:      panes,
+		main:       main,
+		collapsed:  make(map[sections.SectionName]bool),
+	}
+	if l.mode == "" {
+		l.mode = HorizontalLayout
+	}
+	if l.ratio == 0 {
+		l.ratio = defaultRatio
+	}
+	return l
+}
+
+// Settings returns the layout as saved in the configuration.
+func (l *Layout) Settings() config.Layout {
+	return config.Layout{Mode: string(l.mode), Ratio: l.ratio, StackBelow: l.stackBelow}
+}
+
+// Mode is the arrangement in use, side by side panes are stacked when the
+// page is narrower than the breakpoint.
+func (l *Layout) Mode() LayoutMode {
+	stackBelow := l.stackBelow
+	if stackBelow == 0 {
+		stackBelow = defaultStackBelow
+	}
+	if l.mode == HorizontalLayout && l.width < stackBelow {
+		return PromptBottomLayout
+	}
+	return l.mode
+}
+
+// Visible reports whether a pane is shown.
+func (l *Layout) Visible(name sections.SectionName) bool {
+	if l.maximized != "" {
+		return name == l.maximized
+	}
+	return !l.collapsed[name]
+}
+
+// order returns the visible panes from left to right or top to bottom.
+func (l *Layout) order() []sections.SectionName {
+	var visible []sections.SectionName
+	for _, name := range l.panes {
+		if l.Visible(name) {
+			visible = append(visible, name)
+		}
+	}
+	if l.Mode() == PromptBottomLayout {
+		for i, j := 0, len(visible)-1; i < j; i, j = i+1, j-1 {
+			visible[i], visible[j] = visible[j], visible[i]
+		}
+	}
+	return visible
+}
+
+// sizes computes the content size of the visible panes. height is the
+// content height of a pane filling the page.
+func (l *Layout) sizes() map[sections.SectionName]paneSize {
+	visible := l.order()
+	sizes := make(map[sections.SectionName]paneSize, len(visible))
+	if len(visible) == 0 {
+		return sizes
+	}
+	if l.Mode() == HorizontalLayout {
+		for name, width := range l.split(visible, l.width-gutter*len(visible)) {
+			sizes[name] = paneSize{width: width, height: l.height}
+		}
+		return sizes
+	}
+	available := l.height + paneChrome - paneChrome*len(visible)
+	for name, height := range l.split(visible, available) {
+		sizes[name] = paneSize{width: l.width - gutter, height: height}
+	}
+	return sizes
+}
+
+// split shares space between panes, the main pane gets its ratio and the
+// others share the rest.
+func (l *Layout) split(panes []sections.SectionName, space int) map[sections.SectionName]int {
+	split := make(map[sections.SectionName]int, len(panes))
+	var others []sections.SectionName
+	rest := space
+	for _, name := range panes {
+		if name == l.main && len(panes) > 1 {
+			split[name] = int(math.Round(float64(space) * l.ratio))
+			rest -= split[name]
+			continue
+		}
+		others = append(others, name)
+	}
+	for i, name := range others {
+		share := rest / len(others)
+		if i == len(others)-1 {
+			share = rest - share*(len(others)-1)
+		}
+		split[name] = share
+	}
+	for name, n := range split {
+		split[name] = max(n, 1)
+	}
+	return split
+}
+
+// Apply resizes the sections and shows or hides them. Focus moves away from
+// a pane that gets hidden.
+func (l *Layout) Apply(width, height int, secs map[sections.SectionName]sections.Section) {
+	l.width = width
+	l.height = height
+	sizes := l.sizes()
+	var lostFocus bool
+	for _, name := range l.panes {
+		sec := secs[name]
+		size, ok := sizes[name]
+		if !ok {
+			lostFocus = lostFocus || sec.IsFocused()
+			sec.Blur()
+			sec.Hide()
+			continue
+		}
+		sec.Show()
+		sec.SetDimensions(size.width, size.height)
+	}
+	if lostFocus {
+		if visible := l.order(); len(visible) > 0 {
+			secs[visible[0]].Focus()
+		}
+	}
+}
+
+// View joins the views of the visible panes.
+func (l *Layout) View(secs map[sections.SectionName]sections.Section) string {
+	var views []string
+	for _, name := range l.order() {
+		views = append(views, attachView("", secs[name].View()))
+	}
+	if l.Mode() == HorizontalLayout {
+		return lipgloss.JoinHorizontal(lipgloss.Top, views...)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, views...)
+}
+
+// HandleKey applies the layout key bindings, focused is the pane holding the
+// focus. It reports whether the key was used and returns a command saving
+// the layout when the settings changed.
+func (l *Layout) HandleKey(msg tea.KeyMsg, focused sections.SectionName) (bool, tea.Cmd) {
+	switch msg.String() {
+	case "alt+l":
+		for i, mode := range layoutModes {
+			if mode == l.mode {
+				l.mode = layoutModes[(i+1)%len(layoutModes)]
+				break
+			}
+		}
+		return true, l.save()
+	case "alt+left", "alt+up":
+		l.moveDivider(-ratioStep)
+		return true, l.save()
+	case "alt+right", "alt+down":
+		l.moveDivider(ratioStep)
+		return true, l.save()
+	case "alt+c":
+		if len(l.collapsed) > 0 {
+			clear(l.collapsed)
+		} else if len(l.order()) > 1 {
+			l.collapsed[focused] = true
+		}
+		return true, nil
+	case "alt+z":
+		if l.maximized != "" {
+			l.maximized = ""
+		} else {
+			l.maximized = focused
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// moveDivider moves the divider between the panes right or down for a
+// positive delta.
+func (l *Layout) moveDivider(delta float64) {
+	order := l.order()
+	if len(order) > 0 && order[0] != l.main {
+		delta = -delta
+	}
+	l.ratio = math.Round((l.ratio+delta)*100) / 100
+	l.ratio = min(max(l.ratio, minRatio), maxRatio)
+}
+
+func (l *Layout) save() tea.Cmd {
+	settings := l.Settings()
+	return func() tea.Msg {
+		err := config.Update(func(cfg *config.Config) {
+			cfg.Layout = settings
+		})
+		if err != nil {
+			slog.Error("saving layout", "error", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,56 @@
+package pages
+
+import (
+	"testing"
+
+	"teachat/pkgs/config"
+	"teachat/pkgs/sections"
+)
+
+func TestLayoutSizes(t *testing.T) {
+	l := NewLayout(config.Layout{}, sections.ConvoSection, sections.PromptSection, sections.ConvoSection)
+	l.width, l.height = 100, 30
+
+	sizes := l.sizes()
+	if got := sizes[sections.ConvoSection].width + sizes[sections.PromptSection].width + 2*gutter; got != 100 {
+		t.Errorf("expected the panes to fill the width, got %d", got)
+	}
+	if sizes[sections.ConvoSection].width <= sizes[sections.PromptSection].width {
+		t.Errorf("expected the conversation to be the larger pane, got %+v", sizes)
+	}
+
+	l.mode = VerticalLayout
+	sizes = l.sizes()
+	if got := sizes[sections.ConvoSection].height + sizes[sections.PromptSection].height + paneChrome; got != 30 {
+		t.Errorf("expected the panes to fill the height, got %d", got)
+	}
+}
+
+func TestLayoutMoveDivider(t *testing.T) {
+	l := NewLayout(config.Layout{Mode: string(PromptBottomLayout)}, sections.ConvoSection, sections.PromptSection, sections.ConvoSection)
+	l.width, l.height = 100, 30
+	// the conversation is above the divider and grows when it moves down
+	l.moveDivider(ratioStep)
+	if l.ratio != 0.8 {
+		t.Errorf("expected a ratio of 0.8, got %v", l.ratio)
+	}
+
+	l.mode = HorizontalLayout
+	// the conversation is right of the divider and shrinks when it moves right
+	l.moveDivider(ratioStep)
+	if l.ratio != 0.75 {
+		t.Errorf("expected a ratio of 0.75, got %v", l.ratio)
+	}
+}
+
+func TestLayoutStacksWhenNarrow(t *testing.T) {
+	l := NewLayout(config.Layout{StackBelow: 70}, sections.ConvoSection, sections.PromptSection, sections.ConvoSection)
+	l.width = 69
+	if l.Mode() != PromptBottomLayout {
+		t.Errorf("expected a stacked layout below the breakpoint, got %s", l.Mode())
+	}
+	l.width = 70
+	if l.Mode() != HorizontalLayout {
+		t.Errorf("expected a horizontal layout at the breakpoint, got %s", l.Mode())
+	}
+}
@@ -0,0 +1,71 @@
+package pages
+
+import (
+	"teachat/pkgs/config"
+	"teachat/pkgs/mcp"
+	"teachat/pkgs/sections"
+	"teachat/pkgs/styles"
+	"teachat/pkgs/teamsg"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// MCP shows the status of the MCP servers, their prompts and resources.
+type MCP struct {
+	current  bool
+	name     PageName
+	sections map[sections.SectionName]sections.Section
+	layout   *Layout
+}
+
+func NewMCPPage(manager *mcp.Manager) PageInterface {
+	p := &MCP{}
+	p.name = MCPPage
+	p.AddSection(sections.NewMCPServers(manager))
+	p.layout = NewLayout(config.Layout{}, sections.MCPServersSection, sections.MCPServersSection)
+	return p
+}
+
+func (p *MCP) IsCurrentPage() bool {
+	return p.current
+}
+
+func (p *MCP) SetAsCurrentPage() {
+	p.current = true
+}
+
+func (p *MCP) UnsetCurrentPage() {
+	p.current = false
+}
+
+func (p *MCP) GetPageName() PageName {
+	return p.name
+}
+
+func (p *MCP) AddSection(section sections.Section) {
+	if p.sections == nil {
+		p.sections = make(map[sections.SectionName]sections.Section)
+	}
+	section.SetDimensions(0, styles.Height)
+	section.Show()
+	section.Focus()
+	p.sections[section.GetSectionName()] = section
+}
+
+func (p *MCP) View() string {
+	return p.layout.View(p.sections)
+}
+
+func (p *MCP) Update(msg tea.Msg) (PageInterface, tea.Cmd) {
+	_, status := msg.(teamsg.MCPServersMsg)
+	if p.current || status {
+		sec, cmd := p.sections[sections.MCPServersSection].Update(msg)
+		p.sections[sections.MCPServersSection] = sec
+		return p, cmd
+	}
+	return p, nil
+}
+
+func (p *MCP) SetDimensions(width, height int) {
+	p.layout.Apply(width, height, p.sections)
+}
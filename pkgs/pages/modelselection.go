@@ -1,6 +1,7 @@
 package pages
 
 import (
+	"teachat/pkgs/config"
 	"teachat/pkgs/sections"
 	"teachat/pkgs/styles"
 
@@ -12,12 +13,14 @@ type ModelSelection struct {
 	name            PageName
 	sections        map[sections.SectionName]sections.Section
 	orderedSections []sections.SectionName
+	layout          *Layout
 }
 
 func NewModelSelectionPage() PageInterface {
 	p := &ModelSelection{}
 	p.name = ModelSelectionPage
 	p.AddSection(sections.NewModelList())
+	p.layout = NewLayout(config.Layout{}, sections.ModelListSection, sections.ModelListSection)
 	return p
 }
 
@@ -69,17 +72,11 @@ func (p *ModelSelection) Update(msg tea.Msg) (PageInterface, tea.Cmd) {
 }
 
 func (p *ModelSelection) View() string {
-	var view string
-	for _, section := range p.orderedSections {
-		if !p.sections[section].IsHidden() {
-			view = attachView(view, p.sections[section].View())
-		}
-	}
-	return view
+	return p.layout.View(p.sections)
 }
 
 func (p *ModelSelection) SetDimensions(width, height int) {
-	p.sections[sections.ModelListSection].SetDimensions(width, height)
+	p.layout.Apply(width, height, p.sections)
 }
 
 func (p *ModelSelection) switchSection() {
@@ -11,6 +11,12 @@ const (
 	HelpPage           PageName = "help"
 	ChatPage           PageName = "chat"
 	ModelSelectionPage PageName = "modelselection"
+	TreePage           PageName = "tree"
+	HistorySearchPage  PageName = "historysearch"
+	ApprovalPage       PageName = "approval"
+	MCPPage            PageName = "mcp"
+	CommandPage        PageName = "command"
+	EditsPage          PageName = "edits"
 )
 
 type Stack []PageInterface
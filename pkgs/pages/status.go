@@ -0,0 +1,49 @@
+package pages
+
+import (
+	"fmt"
+	"strings"
+	"teachat/pkgs/styles"
+	"teachat/pkgs/teamsg"
+	"teachat/pkgs/tokens"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// gaugeWidth is the number of cells of the context gauge.
+const gaugeWidth = 10
+
+// statusBar shows how much of the context window the conversation takes,
+// with a warning when close to the limit or beyond.
+func statusBar(usage teamsg.ContextUsageMsg, width int) string {
+	if usage.Window == 0 {
+		return ""
+	}
+	ratio := float64(usage.Tokens) / float64(usage.Window)
+	filled := min(int(ratio*gaugeWidth+0.5), gaugeWidth)
+	gauge := strings.Repeat("▰", filled) + strings.Repeat("▱", gaugeWidth-filled)
+	status := fmt.Sprintf("context %s/%s %s %d%%", tokens.Format(usage.Tokens), tokens.Format(usage.Window), gauge, int(ratio*100))
+	var note string
+	switch {
+	case usage.Dropped > 0 && usage.Summarized:
+		note = fmt.Sprintf("summarizing the %d oldest messages", usage.Dropped)
+	case usage.Dropped > 0:
+		note = fmt.Sprintf("the %d oldest messages are left out", usage.Dropped)
+	case usage.Warn:
+		note = "close to the context limit, the oldest messages will be left out"
+	case usage.Summarized:
+		note = "the oldest messages are summarized"
+	}
+	if note != "" {
+		status += " · " + note
+	}
+	style := styles.NoteStyle
+	if usage.Warn {
+		style = styles.WarningStyle
+	}
+	status = strings.Repeat(" ", gutter) + status
+	if lipgloss.Width(status) > width {
+		status = string([]rune(status)[:max(width-1, 0)]) + "…"
+	}
+	return style.Render(status)
+}
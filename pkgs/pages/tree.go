@@ -0,0 +1,67 @@
+package pages
+
+import (
+	"teachat/pkgs/config"
+	"teachat/pkgs/sections"
+	"teachat/pkgs/styles"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type Tree struct {
+	current  bool
+	name     PageName
+	sections map[sections.SectionName]sections.Section
+	layout   *Layout
+}
+
+func NewTreePage() PageInterface {
+	p := &Tree{}
+	p.name = TreePage
+	p.AddSection(sections.NewTree())
+	p.layout = NewLayout(config.Layout{}, sections.TreeSection, sections.TreeSection)
+	return p
+}
+
+func (p *Tree) IsCurrentPage() bool {
+	return p.current
+}
+
+func (p *Tree) SetAsCurrentPage() {
+	p.current = true
+}
+
+func (p *Tree) UnsetCurrentPage() {
+	p.current = false
+}
+
+func (p *Tree) GetPageName() PageName {
+	return p.name
+}
+
+func (p *Tree) AddSection(section sections.Section) {
+	if p.sections == nil {
+		p.sections = make(map[sections.SectionName]sections.Section)
+	}
+	section.SetDimensions(0, styles.Height)
+	section.Show()
+	section.Focus()
+	p.sections[section.GetSectionName()] = section
+}
+
+func (p *Tree) View() string {
+	return p.layout.View(p.sections)
+}
+
+func (p *Tree) Update(msg tea.Msg) (PageInterface, tea.Cmd) {
+	if p.current {
+		sec, cmd := p.sections[sections.TreeSection].Update(msg)
+		p.sections[sections.TreeSection] = sec
+		return p, cmd
+	}
+	return p, nil
+}
+
+func (p *Tree) SetDimensions(width, height int) {
+	p.layout.Apply(width, height, p.sections)
+}
@@ -0,0 +1,270 @@
+package patch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"teachat/pkgs/utils"
+)
+
+// Conflict tells why a hunk doesn't apply to a file.
+type Conflict struct {
+	Path string
+	// Hunk is the index of the hunk in the file, or -1 when the whole file
+	// is concerned.
+	Hunk   int
+	Reason string
+}
+
+func (c *Conflict) Error() string {
+	if c.Hunk < 0 {
+		return fmt.Sprintf("%s: %s", c.Path, c.Reason)
+	}
+	return fmt.Sprintf("%s: hunk %d %s", c.Path, c.Hunk+1, c.Reason)
+}
+
+// current is a file of the working tree before the edits.
+type current struct {
+	path    string
+	content []byte
+	exists  bool
+	mode    fs.FileMode
+}
+
+// read reads the file edited by f, which must be within root, symbolic
+// links followed.
+func read(root string, f File) (current, error) {
+	outside := &Conflict{Path: f.Path, Hunk: -1, Reason: "is outside the working directory"}
+	if !filepath.IsLocal(filepath.FromSlash(f.Path)) {
+		return current{}, outside
+	}
+	c := current{path: filepath.Join(root, filepath.FromSlash(f.Path)), mode: 0o644}
+	if rel, err := filepath.Rel(utils.Resolve(root), utils.Resolve(c.path)); err != nil || !filepath.IsLocal(rel) {
+		return current{}, outside
+	}
+	info, err := os.Stat(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if !info.Mode().IsRegular() {
+		return c, &Conflict{Path: f.Path, Hunk: -1, Reason: "is not a regular file"}
+	}
+	c.content, err = os.ReadFile(c.path)
+	c.exists, c.mode = true, info.Mode().Perm()
+	return c, err
+}
+
+// edit returns the content of the file once edited by f.
+func edit(c current, f File) ([]byte, error) {
+	if f.Create && c.exists {
+		return nil, &Conflict{Path: f.Path, Hunk: -1, Reason: "already exists"}
+	}
+	text := string(c.content)
+	final := strings.HasSuffix(text, "\n") || !c.exists
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if text == "" {
+		lines = nil
+	}
+	// offset is how far the hunks are from where they were expected, from
+	// the lines added and removed before them or the file having changed
+	offset, from := 0, 0
+	for i, h := range f.Hunks {
+		old, replacement := h.Old(), h.New()
+		if !c.exists && len(old) > 0 {
+			return nil, &Conflict{Path: f.Path, Hunk: -1, Reason: "doesn't exist"}
+		}
+		expected := -1
+		if h.Start > 0 {
+			expected = h.Start - 1 + offset
+		}
+		at, reason := find(lines, old, from, expected)
+		if reason != "" {
+			return nil, &Conflict{Path: f.Path, Hunk: i, Reason: reason}
+		}
+		lines = slices.Replace(lines, at, at+len(old), replacement...)
+		if expected >= 0 {
+			offset += at - expected
+		}
+		offset += len(replacement) - len(old)
+		from = at + len(replacement)
+	}
+	if len(lines) == 0 {
+		return []byte{}, nil
+	}
+	content := strings.Join(lines, "\n")
+	if final {
+		content += "\n"
+	}
+	return []byte(content), nil
+}
+
+// find returns where old is in lines, at from or after, the closest to
+// expected when it is known. Lines differing in trailing spaces match when
+// nothing matches exactly.
+func find(lines, old []string, from, expected int) (int, string) {
+	if len(old) == 0 {
+		// an insertion, at the end when the edit doesn't tell where
+		if expected < 0 {
+			return len(lines), ""
+		}
+		return min(max(expected, from), len(lines)), ""
+	}
+	for _, equal := range []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool { return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t") },
+	} {
+		var matches []int
+		for i := from; i+len(old) <= len(lines); i++ {
+			if slices.EqualFunc(lines[i:i+len(old)], old, equal) {
+				matches = append(matches, i)
+			}
+		}
+		switch {
+		case len(matches) == 0:
+			continue
+		case expected >= 0:
+			best := matches[0]
+			for _, m := range matches {
+				if abs(m-expected) < abs(best-expected) {
+					best = m
+				}
+			}
+			return best, ""
+		case len(matches) > 1:
+			return 0, fmt.Sprintf("matches %d places", len(matches))
+		}
+		return matches[0], ""
+	}
+	return 0, "doesn't match the file"
+}
+
+func abs(n int) int {
+	return max(n, -n)
+}
+
+// Check tells for each hunk of f why it doesn't apply to the file in root
+// on its own, or nil when it does.
+func Check(root string, f File) []error {
+	errs := make([]error, len(f.Hunks))
+	c, err := read(root, f)
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	for i, h := range f.Hunks {
+		single := f
+		single.Hunks = []Hunk{h}
+		if _, err := edit(c, single); err != nil {
+			var conflict *Conflict
+			if errors.As(err, &conflict) && conflict.Hunk == 0 {
+				conflict.Hunk = i
+			}
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+// Backup is the files as they were before edits were applied.
+type Backup struct {
+	files []backup
+}
+
+type backup struct {
+	current
+	// after is the content written, nil when the file was removed.
+	after []byte
+}
+
+// Apply applies the hunks of files to the working tree in root. Nothing is
+// written when a hunk doesn't apply. The backup returned undoes the edits.
+func Apply(root string, files []File) (*Backup, error) {
+	b := &Backup{}
+	for _, f := range files {
+		if len(f.Hunks) == 0 {
+			continue
+		}
+		c, err := read(root, f)
+		if err != nil {
+			return nil, err
+		}
+		after, err := edit(c, f)
+		if err != nil {
+			return nil, err
+		}
+		if f.Delete && len(after) == 0 {
+			after = nil
+		}
+		b.files = append(b.files, backup{current: c, after: after})
+	}
+	for i, f := range b.files {
+		if err := write(f.path, f.after, f.mode); err != nil {
+			// the files written so far are put back
+			(&Backup{files: b.files[:i]}).restore()
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// write writes content to path, or removes it when content is nil.
+func write(path string, content []byte, mode fs.FileMode) error {
+	if content == nil {
+		return os.Remove(path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, mode)
+}
+
+// Files returns the number of files edited.
+func (b *Backup) Files() int {
+	return len(b.files)
+}
+
+// Undo puts back the files as they were before the edits. Nothing is undone
+// when one of them changed since.
+func (b *Backup) Undo() error {
+	for _, f := range b.files {
+		content, err := os.ReadFile(f.path)
+		switch {
+		case f.after == nil && errors.Is(err, fs.ErrNotExist):
+		case f.after == nil && err == nil:
+			return fmt.Errorf("%s was created since the edits were applied", f.path)
+		case err != nil:
+			return fmt.Errorf("%s changed since the edits were applied: %w", f.path, err)
+		case !bytes.Equal(content, f.after):
+			return fmt.Errorf("%s changed since the edits were applied", f.path)
+		}
+	}
+	return b.restore()
+}
+
+func (b *Backup) restore() error {
+	var errs []error
+	for _, f := range b.files {
+		var err error
+		if f.exists {
+			// an empty file is written, not removed
+			err = write(f.path, append([]byte{}, f.content...), f.mode)
+		} else {
+			err = os.Remove(f.path)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
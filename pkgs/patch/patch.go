@@ -0,0 +1,248 @@
+// Package patch reads the edits proposed by the models and applies them to
+// the working tree. Edits are unified diffs, or blocks naming a file
+// followed by the lines to search and their replacement:
+//
+//	path/to/file.go
+//	<<<<<<< SEARCH
+//	old lines
+//	=======
+//	new lines
+//	>>>>>>> REPLACE
+package patch
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// File is the edits of a file.
+type File struct {
+	Path string
+	// Create is set when the diff creates the file, Delete when it removes
+	// it.
+	Create bool
+	Delete bool
+	Hunks  []Hunk
+}
+
+// Hunk is a change of consecutive lines.
+type Hunk struct {
+	// Start is the line where the hunk is expected, from 1, or 0 when the
+	// edit doesn't tell. Hunks are found around it.
+	Start int
+	// Lines are the lines of the hunk as in a unified diff, starting with a
+	// space for context, - when removed and + when added.
+	Lines []string
+}
+
+// Old returns the lines the hunk replaces.
+func (h Hunk) Old() []string {
+	return h.side('-')
+}
+
+// New returns the lines the hunk writes.
+func (h Hunk) New() []string {
+	return h.side('+')
+}
+
+func (h Hunk) side(change byte) []string {
+	var lines []string
+	for _, l := range h.Lines {
+		if l[0] == ' ' || l[0] == change {
+			lines = append(lines, l[1:])
+		}
+	}
+	return lines
+}
+
+const (
+	searchMarker  = "<<<<<<< SEARCH"
+	dividerMarker = "======="
+	replaceMarker = ">>>>>>> REPLACE"
+)
+
+// hunkHeader matches the header of a hunk, the counts being optional as
+// models often leave them out or get them wrong.
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// Detect reports whether text, like a reply, has edits.
+func Detect(text string) bool {
+	return len(Parse(text)) > 0
+}
+
+// Parse returns the edits found in text, by file in the order they first
+// appear.
+func Parse(text string) []File {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var files []File
+	add := func(f File) {
+		for i := range files {
+			if files[i].Path == f.Path {
+				files[i].Hunks = append(files[i].Hunks, f.Hunks...)
+				files[i].Create = files[i].Create || f.Create
+				files[i].Delete = files[i].Delete || f.Delete
+				return
+			}
+		}
+		files = append(files, f)
+	}
+	for i := 0; i < len(lines); i++ {
+		switch {
+		case strings.HasPrefix(lines[i], "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			f, next := parseDiff(lines, i)
+			if len(f.Hunks) > 0 {
+				add(f)
+			}
+			i = next - 1
+		case strings.TrimSpace(lines[i]) == searchMarker:
+			f, next, ok := parseBlock(lines, i)
+			if ok {
+				add(f)
+			}
+			i = next - 1
+		}
+	}
+	return files
+}
+
+// parseDiff reads the diff of a file starting with the --- line at start,
+// it returns the index of the line following it.
+func parseDiff(lines []string, start int) (File, int) {
+	oldPath, newPath := diffPath(lines[start][4:]), diffPath(lines[start+1][4:])
+	f := File{Path: newPath, Create: oldPath == "/dev/null", Delete: newPath == "/dev/null"}
+	if f.Delete {
+		f.Path = oldPath
+	}
+	i := start + 2
+	for i < len(lines) {
+		m := hunkHeader.FindStringSubmatch(lines[i])
+		if m == nil {
+			if strings.HasPrefix(lines[i], "@@") {
+				// a header without line numbers
+				m = []string{lines[i], "0", "", "0", ""}
+			} else {
+				break
+			}
+		}
+		h := Hunk{Start: atoi(m[1])}
+		// the counts, when given, tell where the hunk ends, blank lines
+		// being context lines stripped of their space
+		oldCount, newCount := -1, -1
+		if m[1] != "0" || m[3] != "0" {
+			oldCount, newCount = count(m[2]), count(m[4])
+		}
+		i++
+		for ; i < len(lines); i++ {
+			l := lines[i]
+			if oldCount == 0 && newCount == 0 {
+				break
+			}
+			if l == "" && oldCount > 0 && newCount > 0 {
+				l = " "
+			}
+			if l == "" || !strings.ContainsRune(" -+\\", rune(l[0])) {
+				break
+			}
+			if l[0] == '\\' {
+				// no newline at end of file
+				continue
+			}
+			if l[0] != '+' && oldCount > 0 {
+				oldCount--
+			}
+			if l[0] != '-' && newCount > 0 {
+				newCount--
+			}
+			h.Lines = append(h.Lines, l)
+		}
+		if h.Start == 0 && f.Create {
+			h.Start = 1
+		}
+		if len(h.Lines) > 0 {
+			f.Hunks = append(f.Hunks, h)
+		}
+	}
+	return f, i
+}
+
+// diffPath reads the path of a --- or +++ line, without the a/ or b/
+// prefix of git and the timestamp of diff.
+func diffPath(s string) string {
+	s, _, _ = strings.Cut(s, "\t")
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return s
+	}
+	for _, prefix := range []string{"a/", "b/"} {
+		if rest, ok := strings.CutPrefix(s, prefix); ok {
+			return rest
+		}
+	}
+	return s
+}
+
+func count(s string) int {
+	if s == "" {
+		return 1
+	}
+	return atoi(s)
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// parseBlock reads the search and replace block starting at start, the
+// file being named on the line before, or before the opening fence.
+func parseBlock(lines []string, start int) (File, int, bool) {
+	path := ""
+	for i := start - 1; i >= 0 && path == ""; i-- {
+		l := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(l, "```") {
+			continue
+		}
+		if l == "" {
+			break
+		}
+		path = strings.Trim(l, "`*: ")
+	}
+	var old, replacement []string
+	divider := -1
+	for i := start + 1; i < len(lines); i++ {
+		switch strings.TrimSpace(lines[i]) {
+		case dividerMarker:
+			divider = i
+			continue
+		case replaceMarker:
+			if divider < 0 || path == "" {
+				return File{}, i + 1, false
+			}
+			h := Hunk{}
+			for _, l := range old {
+				h.Lines = append(h.Lines, "-"+l)
+			}
+			for _, l := range replacement {
+				h.Lines = append(h.Lines, "+"+l)
+			}
+			return File{Path: path, Hunks: []Hunk{h}}, i + 1, true
+		}
+		if divider < 0 {
+			old = append(old, lines[i])
+		} else {
+			replacement = append(replacement, lines[i])
+		}
+	}
+	return File{}, len(lines), false
+}
+
+// Header describes the hunk, like a unified diff would.
+func (h Hunk) Header() string {
+	removed, added := len(h.Old()), len(h.New())
+	if h.Start == 0 {
+		return fmt.Sprintf("@@ -%d +%d lines @@", removed, added)
+	}
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.Start, removed, h.Start, added)
+}
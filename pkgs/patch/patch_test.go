@@ -0,0 +1,200 @@
+package patch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const reply = "Here are the changes:\n\n" +
+	"```diff\n" +
+	"--- a/greet.go\n" +
+	"+++ b/greet.go\n" +
+	"@@ -1,3 +1,3 @@\n" +
+	" package greet\n" +
+	"\n" +
+	"-const Hello = \"hello\"\n" +
+	"+const Hello = \"hi\"\n" +
+	"@@ -6,2 +6,3 @@\n" +
+	" func Greet() string {\n" +
+	"+\t// short and sweet\n" +
+	" \treturn Hello\n" +
+	"--- /dev/null\n" +
+	"+++ b/notes.txt\n" +
+	"@@ -0,0 +1 @@\n" +
+	"+remember\n" +
+	"```\n\n" +
+	"And in the readme:\n\n" +
+	"README.md\n" +
+	"```\n" +
+	"<<<<<<< SEARCH\n" +
+	"# Greet\n" +
+	"=======\n" +
+	"# Greetings\n" +
+	">>>>>>> REPLACE\n" +
+	"```\n"
+
+const greet = "package greet\n\nconst Hello = \"hello\"\n\n// Greet greets.\nfunc Greet() string {\n\treturn Hello\n}\n"
+
+func TestParse(t *testing.T) {
+	files := Parse(reply)
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	if !reflect.DeepEqual(paths, []string{"greet.go", "notes.txt", "README.md"}) {
+		t.Fatalf("unexpected files %q", paths)
+	}
+	if len(files[0].Hunks) != 2 || !files[1].Create || len(files[2].Hunks) != 1 {
+		t.Fatalf("unexpected edits %+v", files)
+	}
+	h := files[0].Hunks[0]
+	if h.Start != 1 || !reflect.DeepEqual(h.Old(), []string{"package greet", "", `const Hello = "hello"`}) {
+		t.Errorf("the blank context line should be kept, got %+v", h)
+	}
+	if got := files[2].Hunks[0].Lines; !reflect.DeepEqual(got, []string{"-# Greet", "+# Greetings"}) {
+		t.Errorf("unexpected block %q", got)
+	}
+	if Detect("no edits here\n---\n") {
+		t.Error("expected no edits in plain text")
+	}
+}
+
+func setup(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	// the file changed a bit since the diff was written
+	for name, content := range map[string]string{
+		"greet.go":  "// Package greet greets.\n" + greet,
+		"README.md": "# Greet\n\nSays hello.\n",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func content(t *testing.T, root, name string) string {
+	t.Helper()
+	bts, err := os.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bts)
+}
+
+func TestApplyAndUndo(t *testing.T) {
+	root := setup(t)
+	files := Parse(reply)
+	for _, f := range files {
+		for i, err := range Check(root, f) {
+			if err != nil {
+				t.Errorf("%s hunk %d: %s", f.Path, i, err)
+			}
+		}
+	}
+	backup, err := Apply(root, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "// Package greet greets.\npackage greet\n\nconst Hello = \"hi\"\n\n// Greet greets.\nfunc Greet() string {\n\t// short and sweet\n\treturn Hello\n}\n"
+	if got := content(t, root, "greet.go"); got != want {
+		t.Errorf("unexpected greet.go\n%s", got)
+	}
+	if got := content(t, root, "notes.txt"); got != "remember\n" {
+		t.Errorf("unexpected notes.txt %q", got)
+	}
+	if got := content(t, root, "README.md"); got != "# Greetings\n\nSays hello.\n" {
+		t.Errorf("unexpected README.md %q", got)
+	}
+
+	if err := backup.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if got := content(t, root, "greet.go"); got != "// Package greet greets.\n"+greet {
+		t.Errorf("expected greet.go back, got\n%s", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "notes.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the created file to be removed, got %v", err)
+	}
+}
+
+func TestUndoAfterChange(t *testing.T) {
+	root := setup(t)
+	backup, err := Apply(root, Parse(reply)[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(root, "README.md"), []byte("edited\n"), 0o644)
+	if err := backup.Undo(); err == nil {
+		t.Error("expected the undo to be refused")
+	}
+	if got := content(t, root, "README.md"); got != "edited\n" {
+		t.Errorf("expected the file to be left alone, got %q", got)
+	}
+}
+
+func TestConflict(t *testing.T) {
+	root := setup(t)
+	os.WriteFile(filepath.Join(root, "greet.go"), []byte("package greet\n\nconst Hello = \"hey\"\n"), 0o644)
+	files := Parse(reply)
+	errs := Check(root, files[0])
+	var conflict *Conflict
+	if !errors.As(errs[0], &conflict) || conflict.Hunk != 0 || errs[1] == nil {
+		t.Errorf("expected both hunks to conflict, got %v", errs)
+	}
+	if _, err := Apply(root, files); err == nil {
+		t.Fatal("expected a conflict")
+	}
+	// nothing was written
+	if got := content(t, root, "README.md"); got != "# Greet\n\nSays hello.\n" {
+		t.Errorf("expected README.md unchanged, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "notes.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected notes.txt not to be created, got %v", err)
+	}
+
+	outside := []File{{Path: "../escape.txt", Create: true, Hunks: []Hunk{{Start: 1, Lines: []string{"+no"}}}}}
+	if _, err := Apply(root, outside); err == nil {
+		t.Error("expected a path outside the working directory to be refused")
+	}
+}
+
+func TestSymlinkOutside(t *testing.T) {
+	root, elsewhere := setup(t), t.TempDir()
+	os.WriteFile(filepath.Join(elsewhere, "secret.txt"), []byte("keep\n"), 0o644)
+	if err := os.Symlink(elsewhere, filepath.Join(root, "link")); err != nil {
+		t.Skip("symbolic links not supported:", err)
+	}
+	os.Symlink(filepath.Join(elsewhere, "secret.txt"), filepath.Join(root, "secret.txt"))
+	for _, f := range []File{
+		{Path: "link/new.txt", Create: true, Hunks: []Hunk{{Start: 1, Lines: []string{"+no"}}}},
+		{Path: "secret.txt", Hunks: []Hunk{{Start: 1, Lines: []string{"-keep", "+changed"}}}},
+	} {
+		if errs := Check(root, f); errs[0] == nil {
+			t.Errorf("%s: expected the link outside to be refused", f.Path)
+		}
+		if _, err := Apply(root, []File{f}); err == nil {
+			t.Errorf("%s: expected the edit to be refused", f.Path)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(elsewhere, "new.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no file created outside, got %v", err)
+	}
+	if got := content(t, elsewhere, "secret.txt"); got != "keep\n" {
+		t.Errorf("expected the file outside unchanged, got %q", got)
+	}
+
+	// links within the working directory are followed
+	os.Symlink(filepath.Join(root, "README.md"), filepath.Join(root, "readme"))
+	readme := File{Path: "readme", Hunks: []Hunk{{Start: 1, Lines: []string{"-# Greet", "+# Greetings"}}}}
+	if _, err := Apply(root, []File{readme}); err != nil {
+		t.Fatal(err)
+	}
+	if got := content(t, root, "README.md"); got != "# Greetings\n\nSays hello.\n" {
+		t.Errorf("unexpected README.md %q", got)
+	}
+}
@@ -0,0 +1,306 @@
+// Package permissions decides whether the tools called by the models may run.
+// Each call is allowed, denied or asked to the user according to the rules of
+// the configuration, the allowed paths and commands, and the answers given
+// earlier. Every decision is recorded in the audit log.
+package permissions
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"teachat/pkgs/config"
+	"teachat/pkgs/utils"
+)
+
+// Decision is what happens to a tool call.
+type Decision string
+
+const (
+	Allow Decision = "allow"
+	Ask   Decision = "ask"
+	Deny  Decision = "deny"
+)
+
+// Answer is the choice made by the user when asked about a call.
+type Answer string
+
+const (
+	AllowOnce    Answer = "once"
+	AllowSession Answer = "session"
+	AllowAlways  Answer = "always"
+	DenyOnce     Answer = "deny"
+)
+
+// Request describes a tool call to decide on.
+type Request struct {
+	Tool      string
+	Arguments string
+	// ReadOnly tools are allowed by default.
+	ReadOnly bool
+	// Paths are the files and directories the call accesses.
+	Paths []string
+	// Command is the command line the call runs.
+	Command string
+}
+
+// Verdict is a decision and the reason it was made, told to the user and
+// written in the audit log.
+type Verdict struct {
+	Decision Decision
+	Reason   string
+}
+
+// Policy holds the rules and the answers given during the session. It is
+// safe for concurrent use.
+type Policy struct {
+	rules    map[string]Decision
+	paths    []string
+	commands []string
+	audit    string
+
+	mu sync.Mutex
+	// granted holds the keys allowed for the session, see grants.
+	granted map[string]bool
+}
+
+// New builds the policy of cfg. Relative paths are resolved from the working
+// directory.
+func New(cfg config.Tools) *Policy {
+	p := &Policy{
+		rules:    make(map[string]Decision),
+		commands: cfg.Commands,
+		audit:    cfg.Audit,
+		granted:  make(map[string]bool),
+	}
+	for tool, rule := range cfg.Permissions {
+		p.rules[tool] = Decision(rule)
+	}
+	paths := cfg.Paths
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	for _, path := range paths {
+		p.paths = append(p.paths, utils.Resolve(path))
+	}
+	if p.audit == "" {
+		path, err := DefaultAuditPath()
+		if err != nil {
+			slog.Error("locating the audit log", "error", err)
+		}
+		p.audit = path
+	}
+	return p
+}
+
+// DefaultAuditPath returns $XDG_STATE_HOME/teachat/audit.log.
+func DefaultAuditPath() (string, error) {
+	dir, err := utils.XDGDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "audit.log"), nil
+}
+
+// Check decides on r. A deny rule always wins, then paths outside the
+// allowed ones are asked, even for allowed tools.
+func (p *Policy) Check(r Request) Verdict {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rule := p.rule(r)
+	if rule == Deny {
+		return Verdict{Deny, fmt.Sprintf("%s is denied by the permissions", r.Tool)}
+	}
+	for _, path := range r.Paths {
+		if !p.allowedPath(path) && !p.granted[pathKey(path)] {
+			return Verdict{Ask, fmt.Sprintf("%s is outside the allowed paths", path)}
+		}
+	}
+	switch {
+	case rule == Allow:
+		return Verdict{Allow, fmt.Sprintf("%s is allowed by the permissions", r.Tool)}
+	case r.Command != "" && p.allowedCommand(r.Command):
+		return Verdict{Allow, "the command is allowed"}
+	case p.granted[key(r)]:
+		return Verdict{Allow, "allowed for the session"}
+	case r.Command != "":
+		return Verdict{Ask, fmt.Sprintf("%s runs %s", r.Tool, r.Command)}
+	}
+	return Verdict{Ask, fmt.Sprintf("%s asks before running", r.Tool)}
+}
+
+// Answer applies the answer of the user about r. Allowing for the session
+// grants what r needed, see Save to keep it after the session.
+func (p *Policy) Answer(r Request, a Answer) Verdict {
+	switch a {
+	case AllowOnce:
+		return Verdict{Allow, "allowed once by the user"}
+	case AllowSession, AllowAlways:
+		p.mu.Lock()
+		for _, k := range p.grants(r) {
+			p.granted[k] = true
+		}
+		p.mu.Unlock()
+		if a == AllowAlways {
+			return Verdict{Allow, "always allowed by the user"}
+		}
+		return Verdict{Allow, "allowed for the session by the user"}
+	}
+	return Verdict{Deny, "denied by the user"}
+}
+
+// Save adds what r needed to the configuration file, for the next sessions:
+// the paths outside the allowed ones, then the command or the tool.
+func (p *Policy) Save(r Request) error {
+	p.mu.Lock()
+	var paths []string
+	for _, path := range r.Paths {
+		if !p.allowedPath(path) {
+			paths = append(paths, utils.Resolve(path))
+		}
+	}
+	p.paths = append(p.paths, paths...)
+	rule := p.rule(r)
+	command := ""
+	if rule != Allow && r.Command != "" && !p.allowedCommand(r.Command) {
+		command = strings.Join(strings.Fields(r.Command), " ")
+		p.commands = append(p.commands, command)
+	}
+	allowTool := rule != Allow && r.Command == ""
+	if allowTool {
+		p.rules[r.Tool] = Allow
+	}
+	p.mu.Unlock()
+
+	return config.Update(func(cfg *config.Config) {
+		for _, path := range paths {
+			if !slices.Contains(cfg.Tools.Paths, path) {
+				cfg.Tools.Paths = append(cfg.Tools.Paths, path)
+			}
+		}
+		if command != "" && !slices.Contains(cfg.Tools.Commands, command) {
+			cfg.Tools.Commands = append(cfg.Tools.Commands, command)
+		}
+		if allowTool {
+			if cfg.Tools.Permissions == nil {
+				cfg.Tools.Permissions = make(map[string]string)
+			}
+			cfg.Tools.Permissions[r.Tool] = string(Allow)
+		}
+	})
+}
+
+// entry is a line of the audit log.
+type entry struct {
+	Time      time.Time `json:"time"`
+	Tool      string    `json:"tool"`
+	Arguments string    `json:"arguments"`
+	Decision  Decision  `json:"decision"`
+	Reason    string    `json:"reason"`
+}
+
+// Record appends the verdict about r to the audit log, as a line of JSON.
+func (p *Policy) Record(r Request, v Verdict) {
+	if p.audit == "" {
+		return
+	}
+	line, err := json.Marshal(entry{time.Now(), r.Tool, r.Arguments, v.Decision, v.Reason})
+	if err != nil {
+		slog.Error("encoding the audit entry", "error", err)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(p.audit), 0o700); err != nil {
+		slog.Error("writing the audit log", "error", err)
+		return
+	}
+	f, err := os.OpenFile(p.audit, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		slog.Error("writing the audit log", "error", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		slog.Error("writing the audit log", "error", err)
+	}
+}
+
+// rule returns the rule of the tool of r.
+func (p *Policy) rule(r Request) Decision {
+	if rule, ok := p.rules[r.Tool]; ok {
+		return rule
+	}
+	if rule, ok := p.rules["*"]; ok {
+		return rule
+	}
+	if r.ReadOnly {
+		return Allow
+	}
+	return Ask
+}
+
+// grants returns the keys allowing r for the session.
+func (p *Policy) grants(r Request) []string {
+	var keys []string
+	for _, path := range r.Paths {
+		if !p.allowedPath(path) {
+			keys = append(keys, pathKey(path))
+		}
+	}
+	if p.rule(r) != Allow {
+		keys = append(keys, key(r))
+	}
+	return keys
+}
+
+// key identifies the calls allowed together: calls of the same tool, or
+// running the same command.
+func key(r Request) string {
+	if r.Command != "" {
+		return r.Tool + " " + strings.Join(strings.Fields(r.Command), " ")
+	}
+	return r.Tool
+}
+
+func pathKey(path string) string {
+	return "path " + utils.Resolve(path)
+}
+
+// allowedPath reports whether path is one of the allowed paths or inside
+// one of them.
+func (p *Policy) allowedPath(path string) bool {
+	path = utils.Resolve(path)
+	for _, allowed := range p.paths {
+		if rel, err := filepath.Rel(allowed, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// shellOperators chain or redirect commands, a command using them is never
+// allowed by the command list.
+const shellOperators = ";&|<>`$\n"
+
+// allowedCommand reports whether command starts with the words of one of the
+// allowed commands.
+func (p *Policy) allowedCommand(command string) bool {
+	if strings.ContainsAny(command, shellOperators) {
+		return false
+	}
+	words := strings.Fields(command)
+	for _, allowed := range p.commands {
+		prefix := strings.Fields(allowed)
+		if len(prefix) > 0 && len(prefix) <= len(words) && slices.Equal(prefix, words[:len(prefix)]) {
+			return true
+		}
+	}
+	return false
+}
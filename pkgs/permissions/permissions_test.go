@@ -0,0 +1,142 @@
+package permissions
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"teachat/pkgs/config"
+	"teachat/pkgs/utils"
+)
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	p := New(config.Tools{
+		Permissions: map[string]string{"delete_file": "deny", "fetch": "allow"},
+		Paths:       []string{dir},
+		Commands:    []string{"ls", "git status"},
+		Audit:       filepath.Join(dir, "audit.log"),
+	})
+	outside := filepath.Join(filepath.Dir(dir), "other")
+	for _, tc := range []struct {
+		name    string
+		request Request
+		want    Decision
+	}{
+		{"read-only inside", Request{Tool: "read_file", ReadOnly: true, Paths: []string{filepath.Join(dir, "a.txt")}}, Allow},
+		{"read-only outside", Request{Tool: "read_file", ReadOnly: true, Paths: []string{outside}}, Ask},
+		{"prefix of an allowed path", Request{Tool: "read_file", ReadOnly: true, Paths: []string{dir + "-other"}}, Ask},
+		{"escaping with dots", Request{Tool: "read_file", ReadOnly: true, Paths: []string{filepath.Join(dir, "..", "x")}}, Ask},
+		{"denied", Request{Tool: "delete_file", Paths: []string{dir}}, Deny},
+		{"allowed", Request{Tool: "fetch"}, Allow},
+		{"allowed outside", Request{Tool: "fetch", Paths: []string{outside}}, Ask},
+		{"unknown", Request{Tool: "write_file"}, Ask},
+		{"allowed command", Request{Tool: "shell", Command: "ls -la"}, Allow},
+		{"allowed subcommand", Request{Tool: "shell", Command: "git  status -s"}, Allow},
+		{"other subcommand", Request{Tool: "shell", Command: "git push"}, Ask},
+		{"chained command", Request{Tool: "shell", Command: "ls; rm -rf /"}, Ask},
+		{"substitution", Request{Tool: "shell", Command: "ls $(rm -rf /)"}, Ask},
+	} {
+		if got := p.Check(tc.request); got.Decision != tc.want {
+			t.Errorf("%s: expected %s, got %+v", tc.name, tc.want, got)
+		}
+	}
+
+	p = New(config.Tools{Permissions: map[string]string{"*": "deny"}, Paths: []string{dir}})
+	if got := p.Check(Request{Tool: "read_file", ReadOnly: true}); got.Decision != Deny {
+		t.Errorf("expected the default rule to apply, got %+v", got)
+	}
+}
+
+func TestSymlink(t *testing.T) {
+	dir, other := t.TempDir(), t.TempDir()
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(other, link); err != nil {
+		t.Skip(err)
+	}
+	p := New(config.Tools{Paths: []string{dir}, Audit: filepath.Join(dir, "audit.log")})
+	if got := p.Check(Request{Tool: "read_file", ReadOnly: true, Paths: []string{filepath.Join(link, "secret")}}); got.Decision != Ask {
+		t.Errorf("expected a link leading outside to be asked, got %+v", got)
+	}
+}
+
+func TestAnswer(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TEACHAT_CONFIG", filepath.Join(dir, "config.json"))
+	p := New(config.Tools{Paths: []string{dir}, Audit: filepath.Join(dir, "audit.log")})
+	write := Request{Tool: "write_file", Paths: []string{filepath.Join(dir, "a.txt")}}
+	command := Request{Tool: "shell", Command: "make test"}
+
+	if got := p.Answer(write, AllowOnce); got.Decision != Allow {
+		t.Errorf("expected the call to be allowed, got %+v", got)
+	}
+	if got := p.Check(write); got.Decision != Ask {
+		t.Errorf("expected allowing once to be forgotten, got %+v", got)
+	}
+	if got := p.Answer(write, DenyOnce); got.Decision != Deny {
+		t.Errorf("expected the call to be denied, got %+v", got)
+	}
+	p.Answer(write, AllowSession)
+	if got := p.Check(write); got.Decision != Allow {
+		t.Errorf("expected the tool to be allowed for the session, got %+v", got)
+	}
+	p.Answer(command, AllowSession)
+	if got := p.Check(command); got.Decision != Allow {
+		t.Errorf("expected the command to be allowed for the session, got %+v", got)
+	}
+	if got := p.Check(Request{Tool: "shell", Command: "make install"}); got.Decision != Ask {
+		t.Errorf("expected another command to be asked, got %+v", got)
+	}
+
+	outside := filepath.Join(t.TempDir(), "notes.txt")
+	read := Request{Tool: "read_file", ReadOnly: true, Paths: []string{outside}}
+	p.Answer(read, AllowAlways)
+	p.Answer(command, AllowAlways)
+	for _, r := range []Request{read, command, write} {
+		if err := p.Save(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Tools.Paths) != 1 || cfg.Tools.Paths[0] != utils.Resolve(outside) {
+		t.Errorf("expected the path to be saved, got %q", cfg.Tools.Paths)
+	}
+	if len(cfg.Tools.Commands) != 1 || cfg.Tools.Commands[0] != "make test" {
+		t.Errorf("expected the command to be saved, got %q", cfg.Tools.Commands)
+	}
+	if cfg.Tools.Permissions["write_file"] != "allow" || cfg.Tools.Permissions["read_file"] != "" {
+		t.Errorf("expected only write_file to be allowed, got %v", cfg.Tools.Permissions)
+	}
+	if got := New(cfg.Tools).Check(read); got.Decision != Allow {
+		t.Errorf("expected the saved path to be allowed in the next session, got %+v", got)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	audit := filepath.Join(t.TempDir(), "state", "audit.log")
+	p := New(config.Tools{Audit: audit})
+	r := Request{Tool: "read_file", Arguments: `{"path": "go.mod"}`}
+	p.Record(r, Verdict{Allow, "read_file is allowed by the permissions"})
+	p.Record(r, Verdict{Deny, "denied by the user"})
+
+	data, err := os.ReadFile(audit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 entries, got %q", data)
+	}
+	var e entry
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Tool != "read_file" || e.Arguments != r.Arguments || e.Decision != Deny || e.Reason != "denied by the user" || e.Time.IsZero() {
+		t.Errorf("unexpected entry %+v", e)
+	}
+}
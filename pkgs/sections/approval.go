@@ -0,0 +1,134 @@
+package sections
+
+import (
+	"fmt"
+	"strings"
+	"teachat/pkgs/permissions"
+	"teachat/pkgs/styles"
+	"teachat/pkgs/teamsg"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/muesli/reflow/wordwrap"
+)
+
+// Approval asks the user whether a tool call may run.
+type Approval struct {
+	hidden        bool
+	focused       bool
+	width, height int
+	request       teamsg.ToolApprovalMsg
+	// cursor is the option selected with the arrows.
+	cursor int
+}
+
+// approvalOption is an answer and the key choosing it.
+type approvalOption struct {
+	key    string
+	label  string
+	answer permissions.Answer
+}
+
+var approvalOptions = []approvalOption{
+	{"o", "allow once", permissions.AllowOnce},
+	{"s", "allow for this session", permissions.AllowSession},
+	{"a", "always allow", permissions.AllowAlways},
+	{"d", "deny", permissions.DenyOnce},
+}
+
+func NewApproval() Section {
+	return &Approval{}
+}
+
+func (s *Approval) GetSectionName() SectionName {
+	return ApprovalSection
+}
+
+func (s *Approval) SetDimensions(width, height int) {
+	s.width = width
+	s.height = height
+}
+
+func (s *Approval) IsHidden() bool {
+	return s.hidden
+}
+
+func (s *Approval) IsFocused() bool {
+	return s.focused
+}
+
+func (s *Approval) Update(msg tea.Msg) (Section, tea.Cmd) {
+	if !s.focused {
+		return s, nil
+	}
+	switch msg := msg.(type) {
+	case teamsg.ToolApprovalMsg:
+		s.request = msg
+		s.cursor = 0
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "up", "k":
+			s.cursor = max(s.cursor-1, 0)
+		case "down", "j":
+			s.cursor = min(s.cursor+1, len(approvalOptions)-1)
+		case "enter":
+			return s, s.answer(approvalOptions[s.cursor].answer)
+		case "y":
+			return s, s.answer(permissions.AllowOnce)
+		case "n", "esc", "ctrl+b":
+			return s, s.answer(permissions.DenyOnce)
+		default:
+			for _, o := range approvalOptions {
+				if msg.String() == o.key {
+					return s, s.answer(o.answer)
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+func (s *Approval) answer(a permissions.Answer) tea.Cmd {
+	approved := teamsg.ToolApprovedMsg{Run: s.request.Run, Index: s.request.Index, Answer: a}
+	return func() tea.Msg { return approved }
+}
+
+func (s *Approval) View() string {
+	if s.hidden {
+		return ""
+	}
+	width := max(s.width-4, 10)
+	var sb strings.Builder
+	sb.WriteString(styles.ToolStyle.Render("Allow this tool call?") + "\n\n")
+	call := fmt.Sprintf("%s %s", s.request.Call.Name, s.request.Call.Arguments)
+	sb.WriteString(wordwrap.String(call, width) + "\n\n")
+	sb.WriteString(styles.NoteStyle.Render(wordwrap.String(s.request.Reason, width)) + "\n\n")
+	for i, o := range approvalOptions {
+		line := fmt.Sprintf("  %s  %s", o.key, o.label)
+		if i == s.cursor {
+			line = styles.SelectedStyle.Render("| " + o.key + "  " + o.label)
+		}
+		sb.WriteString(line + "\n")
+	}
+	style := styles.InactiveStyle
+	if s.focused {
+		style = styles.ActiveStyle
+	}
+	return style.Render(sb.String())
+}
+
+func (s *Approval) Hide() {
+	s.hidden = true
+}
+
+func (s *Approval) Show() {
+	s.hidden = false
+}
+
+func (s *Approval) Focus() {
+	s.Show()
+	s.focused = true
+}
+
+func (s *Approval) Blur() {
+	s.focused = false
+}
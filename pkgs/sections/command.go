@@ -0,0 +1,122 @@
+package sections
+
+import (
+	"strings"
+	"teachat/pkgs/styles"
+	"teachat/pkgs/teamsg"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/muesli/reflow/wordwrap"
+)
+
+// Command shows a shell command proposed by the model, which the user may
+// edit before running it.
+type Command struct {
+	hidden        bool
+	focused       bool
+	width, height int
+	explanation   string
+	input         textinput.Model
+	// sendOutput is toggled with tab, it starts from the configuration.
+	sendOutput        bool
+	defaultSendOutput bool
+}
+
+func NewCommand(sendOutput bool) Section {
+	input := textinput.New()
+	input.Prompt = "$ "
+	input.CharLimit = 0
+	return &Command{input: input, defaultSendOutput: sendOutput}
+}
+
+func (s *Command) GetSectionName() SectionName {
+	return CommandSection
+}
+
+func (s *Command) SetDimensions(width, height int) {
+	s.width = width
+	s.height = height
+	s.input.Width = max(width-8, 10)
+}
+
+func (s *Command) IsHidden() bool {
+	return s.hidden
+}
+
+func (s *Command) IsFocused() bool {
+	return s.focused
+}
+
+func (s *Command) Update(msg tea.Msg) (Section, tea.Cmd) {
+	if !s.focused {
+		return s, nil
+	}
+	switch msg := msg.(type) {
+	case teamsg.CommandProposedMsg:
+		s.explanation = msg.Explanation
+		s.sendOutput = s.defaultSendOutput
+		s.input.SetValue(msg.Command)
+		s.input.CursorEnd()
+		return s, s.input.Focus()
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "enter":
+			command := strings.TrimSpace(s.input.Value())
+			if command == "" {
+				return s, nil
+			}
+			run := teamsg.RunCommandMsg{Command: command, SendOutput: s.sendOutput}
+			return s, func() tea.Msg { return run }
+		case "tab":
+			s.sendOutput = !s.sendOutput
+			return s, nil
+		case "esc", "ctrl+b":
+			return s, func() tea.Msg { return teamsg.CommandCancelledMsg{} }
+		}
+	}
+	input, cmd := s.input.Update(msg)
+	s.input = input
+	return s, cmd
+}
+
+func (s *Command) View() string {
+	if s.hidden {
+		return ""
+	}
+	width := max(s.width-4, 10)
+	var sb strings.Builder
+	sb.WriteString(styles.ToolStyle.Render("Run this command?") + "\n\n")
+	if s.explanation != "" {
+		sb.WriteString(styles.NoteStyle.Render(wordwrap.String(s.explanation, width)) + "\n\n")
+	}
+	sb.WriteString(s.input.View() + "\n\n")
+	check := "[ ]"
+	if s.sendOutput {
+		check = "[x]"
+	}
+	sb.WriteString(check + " send the output to the model\n\n")
+	sb.WriteString(styles.NoteStyle.Render("enter run · tab send the output or not · esc cancel"))
+	style := styles.InactiveStyle
+	if s.focused {
+		style = styles.ActiveStyle
+	}
+	return style.Render(sb.String())
+}
+
+func (s *Command) Hide() {
+	s.hidden = true
+}
+
+func (s *Command) Show() {
+	s.hidden = false
+}
+
+func (s *Command) Focus() {
+	s.Show()
+	s.focused = true
+}
+
+func (s *Command) Blur() {
+	s.focused = false
+}
@@ -2,37 +2,139 @@ package sections
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
 	"strings"
+	"teachat/pkgs/config"
+	"teachat/pkgs/history"
 	"teachat/pkgs/llmclients"
 	"teachat/pkgs/llminterface"
+	"teachat/pkgs/patch"
+	"teachat/pkgs/permissions"
+	"teachat/pkgs/shell"
 	"teachat/pkgs/styles"
 	"teachat/pkgs/teamsg"
+	"teachat/pkgs/titles"
+	"teachat/pkgs/tokens"
+	"teachat/pkgs/tools"
 	"teachat/pkgs/types"
+	"teachat/pkgs/window"
+	"time"
 
-	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/atotto/clipboard"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/muesli/reflow/wordwrap"
+	"github.com/muesli/termenv"
 )
 
 type Convo struct {
 	hidden     bool
 	focused    bool
-	messages   []string
-	viewport   viewport.Model
+	messages   []*message
+	markdown   markdown
+	viewport   scroller
 	style      lipgloss.Style
 	chatClient llminterface.Client
+	// clientErr is why there is no chat client for the model selected.
+	clientErr error
+	config    config.Config
+
+	store           *history.Store
+	conversation    history.Conversation
+	currentResponse string
+	// regenerating is set while receiving another reply to the last prompt.
+	regenerating bool
+	// selected is the index of the message selected with [ and ], or -1.
+	selected int
+	search   search
+	// titleRequested is the ID of the conversation last sent to be named,
+	// suggested is set while the name it got is shown for review.
+	titleRequested string
+	suggested      bool
+	// counter counts the tokens of the messages with the tokenizer of the
+	// model, or an estimate of it, summarizing is set while
+	// the oldest messages are being summarized and stopSummary cancels it.
+	counter     tokens.Counter
+	summarizing bool
+	stopSummary context.CancelFunc
+	// tools are run when the model calls them. toolCalls are the calls of
+	// the reply being received, toolRounds counts the replies in a row
+	// calling tools and toolRun identifies the calls being run. The policy
+	// decides on the calls, pending holds them while the user is asked and
+	// toolCtx is cancelled with the reply.
+	tools      *tools.Registry
+	toolCalls  []types.ToolCall
+	toolRounds int
+	toolRun    int
+	policy     *permissions.Policy
+	pending    []pendingCall
+	toolCtx    context.Context
+	// mcpTools are the names of the tools of the MCP servers in the
+	// registry.
+	mcpTools []string
+	// command is the shell command being run.
+	command *runningCommand
+	// queue holds the prompts to send once the reply being received is done.
+	queue []string
+	// height is the height of the section, the search bar takes a line of
+	// the viewport when shown.
+	height int
+
+	// events is the reply being received, cancel stops it. replying is set
+	// from the request of a reply to its end.
+	events   <-chan types.StreamEvent
+	cancel   context.CancelFunc
+	replying bool
+
+	// head caches the rendered lines of every message but the last one, so
+	// that a streamed reply only costs the rendering of the reply itself.
+	head []string
+	// dirty is set when deltas were received since the last frame.
+	dirty          bool
+	frameScheduled bool
 }
 
-func NewConvo() Section {
+// frameInterval is how often a streamed reply is rendered. Deltas received
+// in between are coalesced.
+const frameInterval = time.Second / 60
+
+type frameMsg struct{}
 
-	vp := viewport.New(0, 0)
+// titleTimeout bounds the background request naming a conversation.
+const titleTimeout = 30 * time.Second
+
+// foldLines is the height above which C folds a message.
+const foldLines = 20
+
+// copyToClipboard uses the system clipboard, falling back to the terminal
+// through OSC 52 when there is none, like over SSH. It is replaced in tests.
+var copyToClipboard = func(text string) error {
+	if err := clipboard.WriteAll(text); err != nil {
+		slog.Debug("system clipboard unavailable, using OSC 52", "error", err)
+		termenv.Copy(text)
+	}
+	return nil
+}
+
+func NewConvo(cfg config.Config, store *history.Store) Section {
+
+	vp := newScroller()
 	vp.SetContent(`Welcome to the chat room!
 Type a message and press Enter to send.`)
 
 	convo := &Convo{
 		viewport: vp,
 		style:    styles.ActiveStyle.Copy(),
+		config:   cfg,
+		store:    store,
+		selected: -1,
+		search:   newSearch(),
+		counter:  tokens.Heuristic{},
+		tools:    newToolRegistry(cfg),
+		policy:   permissions.New(cfg.Tools),
 	}
 
 	return convo
@@ -42,9 +144,30 @@ func (c *Convo) GetSectionName() SectionName {
 	return ConvoSection
 }
 
+// SetDimensions resizes the viewport. When the width changes the messages
+// are rendered again, keeping the message at the top of the view in place.
 func (c *Convo) SetDimensions(width, height int) {
+	reflow := width != c.viewport.Width && len(c.messages) > 0
+	var anchor, line, lines int
+	atBottom := c.viewport.AtBottom()
+	if reflow {
+		anchor, line, lines = c.lineAt(c.viewport.YOffset)
+	}
 	c.viewport.Width = width
-	c.viewport.Height = height
+	c.height = height
+	c.fitViewport()
+	c.search.input.Width = max(width-30, 10)
+	if !reflow {
+		return
+	}
+	c.renderHead()
+	c.setContent()
+	if atBottom {
+		c.viewport.GotoBottom()
+		return
+	}
+	start, newLines := c.messageLines(anchor)
+	c.viewport.SetYOffset(start + line*newLines/max(lines, 1))
 }
 
 func (c Convo) IsHidden() bool {
@@ -56,35 +179,249 @@ func (c Convo) IsFocused() bool {
 }
 
 func (c *Convo) Update(msg tea.Msg) (Section, tea.Cmd) {
-	if c.focused {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if c.focused && c.search.typing {
+			return c, c.updateSearch(msg)
+		}
+		switch msg.String() {
+		case "ctrl+r":
+			return c, c.regenerate()
+		case "ctrl+left":
+			c.selectSibling(-1)
+			return c, c.usage()
+		case "ctrl+right":
+			c.selectSibling(1)
+			return c, c.usage()
+		case "ctrl+y":
+			if c.suggested {
+				c.suggested = false
+				c.fitViewport()
+			}
+			return c, nil
+		case "ctrl+e":
+			if len(c.conversation.Messages) == 0 {
+				return c, nil
+			}
+			title := teamsg.EditTitleMsg(titles.Format(c.conversation.Title(), c.conversation.Tags))
+			return c, func() tea.Msg { return title }
+		case "ctrl+t":
+			if len(c.conversation.Messages) == 0 {
+				return c, nil
+			}
+			conversation := c.conversation
+			return c, func() tea.Msg { return teamsg.ConversationTreeMsg(conversation) }
+		}
+		if !c.focused {
+			return c, nil
+		}
+		switch msg.String() {
+		case "/":
+			c.search.typing = true
+			c.search.input.Reset()
+			c.fitViewport()
+			return c, c.search.input.Focus()
+		case "n", "N":
+			if len(c.search.matches) > 0 {
+				c.nextMatch(map[string]int{"n": 1, "N": -1}[msg.String()])
+				return c, nil
+			}
+		case "esc":
+			if c.search.shown() {
+				c.clearSearch()
+				return c, nil
+			}
+		}
+		switch msg.String() {
+		case "[":
+			c.selectMessage(-1)
+			return c, nil
+		case "]":
+			c.selectMessage(1)
+			return c, nil
+		case "esc":
+			c.setSelected(-1)
+			return c, nil
+		case "g":
+			c.jumpTo(0)
+			return c, nil
+		case "G":
+			c.jumpTo(len(c.conversation.Messages) - 1)
+			return c, nil
+		case "C":
+			c.foldLong()
+			return c, nil
+		}
+		if c.selected >= 0 && c.selected < len(c.conversation.Messages) {
+			if handled, cmd := c.messageAction(msg.String()); handled {
+				return c, cmd
+			}
+		}
+		vp, cmd := c.viewport.Update(msg)
+		c.viewport = vp
+		return c, cmd
+	case tea.MouseMsg:
+		if !c.focused {
+			return c, nil
+		}
 		vp, cmd := c.viewport.Update(msg)
 		c.viewport = vp
 		return c, cmd
-	}
-	switch msg := msg.(type) {
 	case teamsg.ChatPromptMsg:
+		c.interruptReply()
 		prompt := string(msg)
-		c.messages = append(c.messages, styles.SenderStyle.Render("\nYou: ")+prompt, styles.AiStyle.Render("\nAI: "))
-		c.viewport.SetContent(strings.Join(c.messages, "\n"))
-		c.viewport.GotoBottom()
-		return c, func() tea.Msg { return c.chat(string(msg)) }
+		c.conversation.Append(types.Message{Role: types.UserRole, Content: prompt})
+		c.push(&message{role: types.UserRole, content: prompt}, &message{role: types.AssistantRole})
+		return c, c.send(len(c.conversation.Messages) - 1)
+	case teamsg.QueuedPromptsMsg:
+		c.queue = append(c.queue, msg...)
+		if c.cancel != nil {
+			return c, nil
+		}
+		return c, c.next()
+	case teamsg.ChatEditMsg:
+		if c.chatClient == nil || msg.Index >= len(c.conversation.Messages) {
+			return c, nil
+		}
+		c.cancelReply()
+		c.conversation.Fork(msg.Index, types.Message{Role: types.UserRole, Content: msg.Content})
+		c.selected = -1
+		c.rebuild()
+		c.push(&message{role: types.AssistantRole})
+		return c, c.send(msg.Index)
+	case teamsg.BranchSelectedMsg:
+		c.cancelReply()
+		c.conversation.SetLeaf(int(msg))
+		c.syncContext()
+		c.selected = -1
+		c.rebuild()
+		c.save()
+		return c, c.usage()
 	case teamsg.ChatStreamMsg:
-		cs := types.ChatStream{Stream: msg}
-		return c, func() tea.Msg { return c.receiveChatStream(cs) }
+		c.events = msg.Events
+		if len(msg.Batch) > 0 {
+			return c.Update(teamsg.ChatStreamDeltaMsg(msg))
+		}
+		return c, receiveChatStream(msg.Events)
 	case teamsg.ChatStreamDeltaMsg:
-		curMessage := c.messages[len(c.messages)-1]
-		curMessage = curMessage + msg.Response.Text
-		c.messages[len(c.messages)-1] = wordwrap.String(curMessage, c.viewport.Width)
-		c.viewport.SetContent(strings.Join(c.messages, "\n"))
-		c.viewport.GotoBottom()
-		return c, func() tea.Msg { return c.receiveChatStream(types.ChatStream(msg)) }
-	case teamsg.ChatStreamCloseMsg:
-		msg.Stream.Close()
+		if msg.Events != c.events {
+			// left over from a cancelled reply
+			return c, nil
+		}
+		for _, ev := range msg.Batch {
+			switch ev.Type {
+			case types.TextDelta:
+				c.currentResponse += ev.Text
+				c.dirty = true
+			case types.ToolCallEvent:
+				c.toolCalls = append(c.toolCalls, *ev.ToolCall)
+			case types.ErrorEvent:
+				slog.Error("chat stream", "error", ev.Err)
+				c.queue = nil
+				c.finishReply(styles.ErrorStyle.Render("error: " + ev.Err.Error()))
+				return c, nil
+			case types.DoneEvent:
+				calls := c.toolCalls
+				c.finishReply("")
+				if len(calls) > 0 {
+					return c, tea.Batch(c.usage(), c.runTools(calls))
+				}
+				c.toolRounds = 0
+				if last := len(c.conversation.Messages) - 1; last >= 0 && patch.Detect(c.conversation.Messages[last].Content) {
+					c.refresh(last)
+				}
+				return c, tea.Batch(c.usage(), c.suggestTitle(), c.proposeCommand(), c.next())
+			}
+		}
+		cmd := receiveChatStream(msg.Events)
+		if c.dirty && !c.frameScheduled {
+			c.frameScheduled = true
+			cmd = tea.Batch(cmd, tea.Tick(frameInterval, func(time.Time) tea.Msg { return frameMsg{} }))
+		}
+		return c, cmd
+	case frameMsg:
+		c.frameScheduled = false
+		c.flush()
 		return c, nil
 	case teamsg.ModelSelectedMsg:
-		client := llmclients.PlatformInitialization[msg.Platform](true)
-		client.SetModel(msg.Name)
-		c.chatClient = client
+		c.stop()
+		c.cancelSummary()
+		c.queue = nil
+		client, err := llmclients.New(types.Model(msg), c.config, "")
+		c.chatClient, c.clientErr = client, err
+		c.counter = tokens.For(types.Model(msg), client)
+		c.conversation = history.New(types.Model(msg), c.config.Persona)
+		// the error takes a line above the messages
+		c.fitViewport()
+		if err != nil {
+			slog.Error("creating the chat client", "model", msg.Name, "error", err)
+			return c, nil
+		}
+		c.offerTools()
+		return c, c.usage()
+	case teamsg.ConversationLoadedMsg:
+		c.conversation = history.Conversation(msg)
+		c.syncContext()
+		c.selected = -1
+		c.rebuild()
+		return c, c.usage()
+	case countsWarmedMsg:
+		// reported again with the counts of the server, without asking it
+		// for more
+		usage := c.contextUsage(c.plan(len(c.conversation.Messages), ""), "")
+		return c, func() tea.Msg { return usage }
+	case teamsg.SummaryMsg:
+		c.summarizing = false
+		c.stopSummary = nil
+		if msg.ConversationID != c.conversation.ID || msg.Text == "" {
+			return c, nil
+		}
+		c.conversation.Summary = &history.Summary{Text: msg.Text, Through: msg.Through}
+		c.save()
+		return c, c.usage()
+	case teamsg.TitleSuggestedMsg:
+		if msg.ConversationID != c.conversation.ID || c.conversation.Name != "" {
+			return c, nil
+		}
+		c.conversation.Name = msg.Title
+		c.conversation.Tags = msg.Tags
+		c.suggested = true
+		c.fitViewport()
+		c.save()
+		return c, nil
+	case teamsg.TitleEditedMsg:
+		edited := titles.ParseEdited(string(msg))
+		if edited.Title == "" || len(c.conversation.Messages) == 0 {
+			return c, nil
+		}
+		c.conversation.Name = edited.Title
+		c.conversation.Tags = edited.Tags
+		c.suggested = false
+		c.fitViewport()
+		c.save()
+		return c, nil
+	case teamsg.ToolResultsMsg:
+		if msg.Run != c.toolRun || c.cancel == nil {
+			// the calls were cancelled
+			return c, nil
+		}
+		return c, c.addToolResults(msg.Results)
+	case teamsg.MCPServersMsg:
+		c.setMCPTools(msg.Tools)
+		return c, nil
+	case teamsg.ToolApprovedMsg:
+		if msg.Run != c.toolRun || c.cancel == nil || msg.Index >= len(c.pending) {
+			return c, nil
+		}
+		return c, c.approve(msg.Index, msg.Answer)
+	case teamsg.RunCommandMsg:
+		return c, c.runCommand(msg)
+	case commandOutputMsg:
+		return c, c.commandOutput(msg)
+	case teamsg.PromptChangedMsg:
+		return c, c.promptTokens(msg.Text, msg.Index)
+	case teamsg.ShowMessageMsg:
+		c.showMessage(msg.Index, msg.Terms)
 		return c, nil
 	}
 	return c, nil
@@ -92,10 +429,17 @@ func (c *Convo) Update(msg tea.Msg) (Section, tea.Cmd) {
 
 func (c Convo) View() string {
 	if !c.hidden {
-		if c.focused {
-			return styles.ActiveStyle.Render(c.viewport.View())
+		view := c.viewport.View()
+		if c.suggested {
+			view = c.titleBar() + "\n" + view
+		}
+		if c.clientErr != nil {
+			view = styles.ErrorStyle.Render(truncate("error: "+c.clientErr.Error(), max(c.viewport.Width, 10))) + "\n" + view
 		}
-		return styles.InactiveStyle.Render(c.viewport.View())
+		if c.search.shown() {
+			view += "\n" + c.search.view(c.viewport.Width)
+		}
+		return styles.PaneStyle(c.focused, c.height).Render(view)
 	}
 	return ""
 }
@@ -115,27 +459,706 @@ func (c *Convo) Focus() {
 
 func (c *Convo) Blur() {
 	c.focused = false
+	c.search.typing = false
+	c.search.input.Blur()
+	c.fitViewport()
+}
+
+// save persists the conversation, failures are logged and otherwise ignored
+// so that they don't interrupt the chat.
+func (c *Convo) save() {
+	if c.store == nil {
+		return
+	}
+	c.conversation.UpdatedAt = time.Now()
+	if err := c.store.Save(c.conversation); err != nil {
+		slog.Error("saving conversation", "id", c.conversation.ID, "error", err)
+	}
 }
 
-func (c Convo) chat(msg string) tea.Msg {
-	streamreader, err := c.chatClient.Prompt(context.Background(), msg)
+// push appends messages and shows them.
+func (c *Convo) push(messages ...*message) {
+	c.messages = append(c.messages, messages...)
+	c.renderHead()
+	c.setContent()
+	c.viewport.GotoBottom()
+}
+
+// renderHead renders every message but the last one in the cached head.
+func (c *Convo) renderHead() {
+	var head []string
+	for _, m := range c.messages[:max(len(c.messages)-1, 0)] {
+		head = append(head, splitLines(m.render(&c.markdown, c.viewport.Width))...)
+	}
+	c.head = head
+}
+
+// setContent shows the cached head followed by the last message, only the
+// last message is split in lines again.
+func (c *Convo) setContent() {
+	if len(c.messages) == 0 {
+		return
+	}
+	c.viewport.SetLines(c.head, splitLines(c.messages[len(c.messages)-1].render(&c.markdown, c.viewport.Width)))
+}
+
+// lineAt returns the message shown at the given line of the content, the
+// line within that message and its number of lines, as last rendered.
+func (c *Convo) lineAt(offset int) (index, line, lines int) {
+	start := 0
+	for i, m := range c.messages {
+		lines = strings.Count(m.rendered, "\n") + 1
+		if offset < start+lines || i == len(c.messages)-1 {
+			return i, offset - start, lines
+		}
+		start += lines
+	}
+	return 0, 0, 0
+}
+
+// messageLines returns the first line of a message in the content and its
+// number of lines.
+func (c *Convo) messageLines(index int) (start, lines int) {
+	for _, m := range c.messages[:index] {
+		start += strings.Count(m.rendered, "\n") + 1
+	}
+	return start, strings.Count(c.messages[index].rendered, "\n") + 1
+}
+
+// flush renders the deltas received since the last frame, only the reply
+// is rendered again.
+func (c *Convo) flush() {
+	if !c.dirty || len(c.messages) == 0 {
+		return
+	}
+	c.dirty = false
+	c.renderReply("")
+}
+
+// renderReply shows the reply being received, followed by suffix, as the
+// last message.
+func (c *Convo) renderReply(suffix string) {
+	reply := c.messages[len(c.messages)-1]
+	reply.content = c.currentResponse
+	reply.toolCalls = c.toolCalls
+	reply.suffix = suffix
+	reply.invalidate()
+	c.setContent()
+	c.viewport.GotoBottom()
+}
+
+// finishReply ends the current reply. A reply ending with an error is only
+// shown, with the error appended, it is not added to the conversation.
+func (c *Convo) finishReply(errText string) {
+	c.dirty = false
+	c.renderReply(errText)
+	switch {
+	case c.regenerating && errText == "":
+		last := len(c.conversation.Messages) - 1
+		c.conversation.Fork(last, types.Message{Role: types.AssistantRole, Content: c.currentResponse, ToolCalls: c.toolCalls})
+		c.showReply(last)
+		c.save()
+	case c.regenerating:
+		// the previous reply stays selected
+		c.syncContext()
+	case errText == "":
+		c.conversation.Append(types.Message{Role: types.AssistantRole, Content: c.currentResponse, ToolCalls: c.toolCalls})
+		c.save()
+	}
+	if c.search.query() != "" {
+		c.refreshSearch()
+	}
+	c.regenerating = false
+	c.currentResponse = ""
+	c.toolCalls = nil
+	c.events = nil
+	c.frameScheduled = false
+	c.stop()
+}
+
+// send streams the reply to the prompt at index, replacing the reply being
+// received. The messages before it are fitted in the context window.
+func (c *Convo) send(index int) tea.Cmd {
+	prompt := outgoing(c.conversation.Messages[index]).Content
+	return c.stream(c.plan(index, prompt), prompt)
+}
+
+// stream sends the messages of plan followed by prompt.
+func (c *Convo) stream(plan window.Plan, prompt string) tea.Cmd {
+	client := c.chatClient
+	return c.ask(plan, prompt, func(ctx context.Context) (<-chan types.StreamEvent, error) {
+		return client.Stream(ctx, prompt)
+	})
+}
+
+// goOn sends the messages of plan for the model to go on after tool
+// results.
+func (c *Convo) goOn(plan window.Plan) tea.Cmd {
+	client := c.chatClient
+	return c.ask(plan, "", func(ctx context.Context) (<-chan types.StreamEvent, error) {
+		return client.Continue(ctx)
+	})
+}
+
+// ask asks for a reply with the messages of plan, prompt being sent after
+// them by open.
+func (c *Convo) ask(plan window.Plan, prompt string, open func(context.Context) (<-chan types.StreamEvent, error)) tea.Cmd {
+	c.stop()
+	c.replying = true
+	if c.chatClient != nil {
+		c.chatClient.SetMessages(plan.Messages)
+	} else if err := c.clientErr; err != nil {
+		open = func(context.Context) (<-chan types.StreamEvent, error) { return nil, err }
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	return tea.Batch(
+		func() tea.Msg { return chat(ctx, open) },
+		c.reportUsage(plan, prompt),
+		c.summarize(plan),
+	)
+}
+
+// regenerate asks for another reply to the last prompt. The current reply
+// is kept as an alternative. A prompt left without reply, after an error, is
+// simply sent again.
+func (c *Convo) regenerate() tea.Cmd {
+	n := len(c.conversation.Messages)
+	if c.cancel != nil || c.chatClient == nil || n == 0 {
+		return nil
+	}
+	prompt := n - 1
+	if c.conversation.Messages[n-1].Role == types.AssistantRole {
+		prompt = n - 2
+		c.regenerating = true
+	}
+	if prompt < 0 || c.conversation.Messages[prompt].Role != types.UserRole {
+		c.regenerating = false
+		return nil
+	}
+	c.currentResponse = ""
+	c.messages[len(c.messages)-1].note = ""
+	c.renderReply("")
+	return c.send(prompt)
+}
+
+// selectSibling switches the selected message, or the last one, to its
+// previous or next version. The messages after it follow the branch.
+func (c *Convo) selectSibling(delta int) {
+	index := c.selected
+	if index < 0 {
+		index = len(c.conversation.Messages) - 1
+	}
+	if c.cancel != nil || index < 0 || !c.conversation.SelectSibling(index, delta) {
+		return
+	}
+	c.syncContext()
+	c.rebuild()
+	c.scrollTo(index)
+	c.save()
+}
+
+// messageAction applies the action bound to key to the selected message.
+func (c *Convo) messageAction(key string) (bool, tea.Cmd) {
+	index := c.selected
+	m := c.conversation.Messages[index]
+	switch key {
+	case "e":
+		if m.Role != types.UserRole {
+			return true, nil
+		}
+		edit := teamsg.EditMessageMsg{Index: index, Content: m.Content}
+		return true, func() tea.Msg { return edit }
+	case "y":
+		c.copyText(m.Content)
+	case "Y":
+		c.copyText(history.MessageMarkdown(m))
+	case "q":
+		quote := teamsg.QuoteMsg(quote(m.Content))
+		return true, func() tea.Msg { return quote }
+	case "a":
+		files := patch.Parse(m.Content)
+		if m.Role != types.AssistantRole || len(files) == 0 {
+			return true, nil
+		}
+		return true, func() tea.Msg { return teamsg.EditsMsg(files) }
+	case "d":
+		if c.cancel != nil {
+			return true, nil
+		}
+		node := c.conversation.PathNode(index)
+		node.Excluded = !node.Excluded
+		c.syncContext()
+		c.refresh(index)
+		c.save()
+		return true, c.usage()
+	case "p":
+		node := c.conversation.PathNode(index)
+		node.Pinned = !node.Pinned
+		c.refresh(index)
+		c.save()
+		return true, c.usage()
+	case "c", " ":
+		c.messages[index].folded = !c.messages[index].folded
+		c.refresh(index)
+		c.scrollTo(index)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// copyText puts text in the clipboard.
+func (c *Convo) copyText(text string) {
+	if err := copyToClipboard(text); err != nil {
+		slog.Error("copying to the clipboard", "error", err)
+	}
+}
+
+// quote formats text as a markdown quote followed by an empty line.
+func quote(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	return strings.Join(lines, "\n") + "\n\n"
+}
+
+// foldLong folds every message taller than foldLines, or unfolds them all
+// when some already are.
+func (c *Convo) foldLong() {
+	var folded bool
+	for _, m := range c.messages {
+		folded = folded || m.folded
+	}
+	for _, m := range c.messages {
+		if folded {
+			m.folded = false
+		} else if m.lines(&c.markdown, c.viewport.Width) > foldLines {
+			m.folded = true
+		}
+		m.invalidate()
+	}
+	c.renderHead()
+	c.setContent()
+}
+
+// refresh renders the message at index again, after its state changed.
+func (c *Convo) refresh(index int) {
+	if index >= len(c.messages) {
+		return
+	}
+	c.messages[index].note = c.messageNote(index)
+	if node := c.conversation.PathNode(index); node != nil {
+		c.messages[index].excluded = node.Excluded
+	}
+	c.messages[index].invalidate()
+	c.renderHead()
+	c.setContent()
+}
+
+// syncContext sends the messages of the active branch, but the excluded
+// ones, to the client, as fitted in the context window.
+func (c *Convo) syncContext() {
+	if c.chatClient == nil {
+		return
+	}
+	c.chatClient.SetMessages(c.plan(len(c.conversation.Messages), "").Messages)
+}
+
+// selectMessage moves the selection to the previous or next message,
+// starting from the last one.
+func (c *Convo) selectMessage(delta int) {
+	n := len(c.conversation.Messages)
+	if n == 0 {
+		return
+	}
+	index := c.selected
+	switch {
+	case index < 0 && delta < 0:
+		index = n - 1
+	case index < 0:
+		return
+	default:
+		index = min(max(index+delta, 0), n-1)
+	}
+	c.setSelected(index)
+	c.scrollTo(index)
+}
+
+// jumpTo selects the message at index and scrolls to it.
+func (c *Convo) jumpTo(index int) {
+	if index < 0 || index >= len(c.conversation.Messages) {
+		return
+	}
+	c.setSelected(index)
+	c.scrollTo(index)
+}
+
+func (c *Convo) setSelected(index int) {
+	if index == c.selected {
+		return
+	}
+	for _, i := range []int{c.selected, index} {
+		if i >= 0 && i < len(c.messages) {
+			c.messages[i].selected = i == index
+			c.messages[i].invalidate()
+		}
+	}
+	c.selected = index
+	c.renderHead()
+	c.setContent()
+}
+
+// scrollTo shows the message at index at the top of the view.
+func (c *Convo) scrollTo(index int) {
+	if index >= len(c.messages) {
+		return
+	}
+	start, _ := c.messageLines(index)
+	c.viewport.SetYOffset(start)
+}
+
+// rebuild shows the messages of the conversation again, after the active
+// branch changed.
+func (c *Convo) rebuild() {
+	messages := make([]*message, len(c.conversation.Messages))
+	for i, m := range c.conversation.Messages {
+		messages[i] = newMessage(m)
+		messages[i].note = c.messageNote(i)
+		messages[i].selected = i == c.selected
+		if node := c.conversation.PathNode(i); node != nil {
+			messages[i].excluded = node.Excluded
+		}
+	}
+	c.messages = nil
+	c.push(messages...)
+	if c.search.query() != "" {
+		c.refreshSearch()
+	}
+}
+
+// cancelReply stops the reply being received and forgets it.
+func (c *Convo) cancelReply() {
+	c.stop()
+	c.cancelSummary()
+	c.events = nil
+	c.regenerating = false
+	c.currentResponse = ""
+	c.toolCalls = nil
+	c.toolRounds = 0
+	c.pending = nil
+	c.queue = nil
+	c.dirty = false
+}
+
+// interruptReply ends what is in progress for a new prompt, keeping the
+// conversation valid: the text of the reply received so far is added to it,
+// the tool calls waiting for results are answered with an error and the
+// output of a command is kept for the user only. Another version of a reply
+// is dropped, the previous one stays.
+func (c *Convo) interruptReply() {
+	if c.cancel == nil {
+		return
+	}
+	last := len(c.conversation.Messages) - 1
+	switch {
+	case c.command != nil:
+		done := shell.Event{Done: true, ExitCode: -1, Err: errors.New("cancelled")}
+		c.conversation.Append(types.Message{Role: types.UserRole, Content: shell.Transcript(c.command.command, c.command.output.String(), &done)})
+		c.conversation.PathNode(last + 1).Excluded = true
+		c.refresh(last + 1)
+	case c.replying && c.regenerating:
+		c.showReply(last)
+	case c.replying:
+		c.renderReply(styles.NoteStyle.Render("interrupted"))
+		c.conversation.Append(types.Message{Role: types.AssistantRole, Content: c.currentResponse})
+	case last >= 0 && len(c.conversation.Messages[last].ToolCalls) > 0:
+		var messages []*message
+		for _, call := range c.conversation.Messages[last].ToolCalls {
+			result := types.Message{Role: types.ToolRole, ToolCallID: call.ID, Name: call.Name, Content: "error: interrupted by the user"}
+			c.conversation.Append(result)
+			messages = append(messages, newMessage(result))
+		}
+		c.push(messages...)
+	}
+	c.save()
+	c.cancelReply()
+}
+
+// next sends the first prompt of the queue. Queued prompts are folded, they
+// hold long documents like diffs.
+func (c *Convo) next() tea.Cmd {
+	if len(c.queue) == 0 || c.chatClient == nil {
+		return nil
+	}
+	prompt := c.queue[0]
+	c.queue = c.queue[1:]
+	c.conversation.Append(types.Message{Role: types.UserRole, Content: prompt})
+	c.push(&message{role: types.UserRole, content: prompt, folded: true}, &message{role: types.AssistantRole})
+	return c.send(len(c.conversation.Messages) - 1)
+}
+
+// showReply shows the selected alternative of the reply at index, which is
+// the last message.
+func (c *Convo) showReply(index int) {
+	reply := c.messages[len(c.messages)-1]
+	reply.content = c.conversation.Messages[index].Content
+	reply.toolCalls = c.conversation.Messages[index].ToolCalls
+	reply.suffix = ""
+	reply.note = c.messageNote(index)
+	reply.invalidate()
+	c.setContent()
+	c.viewport.GotoBottom()
+}
+
+// messageNote tells which version of the message at index is shown, like
+// 2/3, when it was edited or regenerated, and whether it is pinned or
+// excluded from the context.
+func (c *Convo) messageNote(index int) string {
+	var notes []string
+	if position, count := c.conversation.Siblings(index); count > 1 {
+		notes = append(notes, fmt.Sprintf("%d/%d", position+1, count))
+	}
+	if m := c.conversation.Messages[index]; m.Role == types.AssistantRole && patch.Detect(m.Content) {
+		notes = append(notes, "edits")
+	}
+	if node := c.conversation.PathNode(index); node != nil {
+		if node.Pinned {
+			notes = append(notes, "pinned")
+		}
+		if node.Excluded {
+			notes = append(notes, "excluded")
+		}
+	}
+	return strings.Join(notes, ", ")
+}
+
+// stop cancels the reply being received or the command being run, if any.
+func (c *Convo) stop() {
+	c.command = nil
+	c.replying = false
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+}
+
+func chat(ctx context.Context, ask func(context.Context) (<-chan types.StreamEvent, error)) tea.Msg {
+	events, err := ask(ctx)
 	if err != nil {
-		panic(err)
+		// report the failure through the usual path
+		failed := make(chan types.StreamEvent)
+		close(failed)
+		return teamsg.ChatStreamMsg{Events: failed, Batch: []types.StreamEvent{{Type: types.ErrorEvent, Err: err}}}
 	}
-	return teamsg.ChatStreamMsg(streamreader)
+	return teamsg.ChatStreamMsg{Events: events}
 }
 
-func (c Convo) receiveChatStream(stream types.ChatStream) tea.Msg {
-	resp, respstream, err := c.chatClient.GetDelta(context.Background(), stream.Stream)
+// receiveChatStream waits for the next events of the reply, handing over
+// everything buffered at once.
+func receiveChatStream(events <-chan types.StreamEvent) tea.Cmd {
+	return func() tea.Msg {
+		return teamsg.ChatStreamDeltaMsg{Events: events, Batch: llminterface.Next(events)}
+	}
+}
+
+// suggestTitle names the conversation in the background after its first
+// exchange, with the utility model when one is configured.
+func (c *Convo) suggestTitle() tea.Cmd {
+	if c.conversation.Name != "" || c.titleRequested == c.conversation.ID || len(c.conversation.Messages) < 2 {
+		return nil
+	}
+	c.titleRequested = c.conversation.ID
+	client, err := c.utilityClient()
 	if err != nil {
-		panic(err)
+		slog.Warn("naming conversation", "error", err)
+		return nil
+	}
+	id := c.conversation.ID
+	messages := c.conversation.Context(len(c.conversation.Messages))
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), titleTimeout)
+		defer cancel()
+		suggestion, err := titles.Suggest(ctx, client, messages)
+		if err != nil {
+			slog.Debug("naming conversation", "id", id, "error", err)
+			return nil
+		}
+		return teamsg.TitleSuggestedMsg{ConversationID: id, Title: suggestion.Title, Tags: suggestion.Tags}
+	}
+}
+
+// utilityClient returns a client for the requests made in the background,
+// with the utility model when one is configured.
+func (c *Convo) utilityClient() (llminterface.Client, error) {
+	model := c.conversation.Model
+	if c.config.UtilityModel != "" {
+		if utility, ok := types.FindModel(c.config.UtilityModel); ok {
+			model = utility
+		}
+	}
+	return llmclients.New(model, c.config, "")
+}
+
+// titleBar shows the name given to the conversation for review.
+func (c *Convo) titleBar() string {
+	title := titles.Format(c.conversation.Name, c.conversation.Tags)
+	keys := " · ctrl+y keep · ctrl+e edit"
+	title = truncate(title, max(c.viewport.Width-lipgloss.Width(keys)-len("Named: "), 10))
+	return styles.NoteStyle.Render("Named: ") + title + styles.NoteStyle.Render(keys)
+}
+
+// showMessage selects the message at index and searches the terms, as found
+// by the search of the saved conversations. The first match in the message
+// is shown.
+func (c *Convo) showMessage(index int, terms []string) {
+	c.jumpTo(index)
+	if len(terms) == 0 {
+		return
+	}
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	c.search.regex = true
+	c.search.ignoreCase = true
+	c.search.input.SetValue(strings.Join(quoted, "|"))
+	c.fitViewport()
+	c.search.find(c.messages)
+	c.search.current = 0
+	for i, found := range c.search.matches {
+		if found.message >= index {
+			c.search.current = i
+			break
+		}
+	}
+	c.highlightMatches()
+	c.showMatch()
+}
+
+// fitViewport leaves a line for the search bar when it is shown.
+func (c *Convo) fitViewport() {
+	height := c.height
+	if c.search.shown() {
+		height--
 	}
-	chatStream := types.ChatStream{
-		Response: resp,
-		Stream:   respstream,
+	if c.suggested {
+		height--
+	}
+	if c.clientErr != nil {
+		height--
+	}
+	c.viewport.Height = max(height, 0)
+}
+
+// updateSearch handles the keys typed in the search bar. The matches are
+// updated on every key, jumping to the first one from the top of the view.
+func (c *Convo) updateSearch(msg tea.KeyMsg) tea.Cmd {
+	var cmd tea.Cmd
+	switch msg.String() {
+	case "enter":
+		c.search.typing = false
+		c.search.input.Blur()
+		if c.search.query() == "" {
+			c.clearSearch()
+		}
+		return nil
+	case "esc":
+		c.clearSearch()
+		return nil
+	case "alt+r":
+		c.search.regex = !c.search.regex
+	case "alt+i":
+		c.search.ignoreCase = !c.search.ignoreCase
+	default:
+		query := c.search.query()
+		c.search.input, cmd = c.search.input.Update(msg)
+		if c.search.query() == query {
+			return cmd
+		}
+	}
+	c.search.find(c.messages)
+	top, _, _ := c.lineAt(c.viewport.YOffset)
+	c.search.current = 0
+	for i, m := range c.search.matches {
+		if m.message >= top {
+			c.search.current = i
+			break
+		}
+	}
+	c.highlightMatches()
+	c.showMatch()
+	return cmd
+}
+
+// refreshSearch finds the matches again after the messages changed, without
+// moving the view.
+func (c *Convo) refreshSearch() {
+	c.search.find(c.messages)
+	c.highlightMatches()
+}
+
+// clearSearch closes the search bar and removes the highlights.
+func (c *Convo) clearSearch() {
+	c.search.typing = false
+	c.search.input.Blur()
+	c.search.input.Reset()
+	c.search.find(c.messages)
+	c.highlightMatches()
+	c.fitViewport()
+}
+
+// nextMatch jumps to the next match, or the previous one for a negative
+// delta, wrapping around.
+func (c *Convo) nextMatch(delta int) {
+	n := len(c.search.matches)
+	c.search.current = ((c.search.current+delta)%n + n) % n
+	c.highlightMatches()
+	c.showMatch()
+}
+
+// highlightMatches marks the matches in the messages and renders the
+// messages that changed.
+func (c *Convo) highlightMatches() {
+	changed := make(map[int]bool)
+	for i, m := range c.messages {
+		if len(m.highlights) > 0 {
+			m.highlights = nil
+			changed[i] = true
+		}
+	}
+	for i, found := range c.search.matches {
+		m := c.messages[found.message]
+		if i == c.search.current {
+			m.currentMatch = len(m.highlights)
+		} else if len(m.highlights) == 0 {
+			m.currentMatch = -1
+		}
+		m.highlights = append(m.highlights, [2]int{found.start, found.end})
+		changed[found.message] = true
+	}
+	if len(changed) == 0 {
+		return
+	}
+	for i := range changed {
+		c.messages[i].invalidate()
+	}
+	c.renderHead()
+	c.setContent()
+}
+
+// showMatch scrolls to the current match when it is out of view.
+func (c *Convo) showMatch() {
+	if len(c.search.matches) == 0 {
+		return
 	}
-	if resp.Done {
-		return teamsg.ChatStreamCloseMsg(chatStream)
+	found := c.search.matches[c.search.current]
+	m := c.messages[found.message]
+	start, _ := c.messageLines(found.message)
+	// the message starts with an empty line and its label
+	line := start + 2 + strings.Count(wordwrap.String(m.content[:found.start], c.viewport.Width), "\n")
+	if line < c.viewport.YOffset || line >= c.viewport.YOffset+c.viewport.Height {
+		c.viewport.SetYOffset(line - c.viewport.Height/2)
 	}
-	return teamsg.ChatStreamDeltaMsg(chatStream)
 }
@@ -0,0 +1,519 @@
+package sections
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"teachat/pkgs/config"
+	"teachat/pkgs/history"
+	"teachat/pkgs/teamsg"
+	"teachat/pkgs/tokens"
+	"teachat/pkgs/types"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// tokensPerFrame approximates a fast local model, around 200 tokens per
+// second at 60 frames per second.
+const tokensPerFrame = 4
+
+var paragraph = strings.Repeat("The quick brown fox jumps over the lazy dog. ", 10)
+
+func streamingConvo(messages int) (*Convo, chan types.StreamEvent) {
+	c := NewConvo(config.Config{}, nil).(*Convo)
+	c.SetDimensions(80, 40)
+	history := make([]*message, messages)
+	for i := range history {
+		history[i] = &message{role: types.AssistantRole, content: paragraph}
+	}
+	c.push(history...)
+	c.Update(teamsg.ChatPromptMsg("hello"))
+	events := make(chan types.StreamEvent)
+	c.Update(teamsg.ChatStreamMsg{Events: events})
+	return c, events
+}
+
+func TestStreamCoalescesDeltas(t *testing.T) {
+	c, events := streamingConvo(2)
+	before := c.viewport.View()
+	for _, token := range []string{"Hello", " world"} {
+		c.Update(teamsg.ChatStreamDeltaMsg{Events: events, Batch: []types.StreamEvent{{Type: types.TextDelta, Text: token}}})
+	}
+	if c.viewport.View() != before {
+		t.Error("expected deltas to wait for the next frame")
+	}
+	c.Update(frameMsg{})
+	if !strings.Contains(c.viewport.View(), "Hello world") {
+		t.Errorf("expected the reply to be shown after a frame, got\n%s", c.viewport.View())
+	}
+
+	c.Update(teamsg.ChatStreamDeltaMsg{Events: events, Batch: []types.StreamEvent{{Type: types.TextDelta, Text: "!"}, {Type: types.DoneEvent}}})
+	if !strings.Contains(c.viewport.View(), "Hello world!") {
+		t.Errorf("expected the reply to be flushed when done, got\n%s", c.viewport.View())
+	}
+	if got := c.conversation.Messages[len(c.conversation.Messages)-1].Content; got != "Hello world!" {
+		t.Errorf("expected the reply to be added to the conversation, got %q", got)
+	}
+}
+
+func TestResizeReflowsMessages(t *testing.T) {
+	c := NewConvo(config.Config{}, nil).(*Convo)
+	c.SetDimensions(80, 5)
+	c.push(
+		&message{role: types.UserRole, content: paragraph},
+		&message{role: types.AssistantRole, content: paragraph},
+		&message{role: types.UserRole, content: "last"},
+	)
+	for _, line := range c.head {
+		if w := len(strings.TrimRight(line, " ")); w > 80 {
+			t.Fatalf("line wider than the viewport: %q", line)
+		}
+	}
+
+	// read the second message
+	start, _ := c.messageLines(1)
+	c.viewport.SetYOffset(start + 1)
+
+	c.SetDimensions(40, 5)
+	for _, line := range c.head {
+		if w := len(strings.TrimRight(line, " ")); w > 40 {
+			t.Fatalf("line wider than the viewport after resize: %q", line)
+		}
+	}
+	if index, _, _ := c.lineAt(c.viewport.YOffset); index != 1 {
+		t.Errorf("expected the view to stay on the second message, got message %d", index)
+	}
+}
+
+func key(s string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+func TestMessageActions(t *testing.T) {
+	var copied string
+	defer func(previous func(string) error) { copyToClipboard = previous }(copyToClipboard)
+	copyToClipboard = func(text string) error {
+		copied = text
+		return nil
+	}
+	c := NewConvo(config.Config{}, nil).(*Convo)
+	c.SetDimensions(80, 40)
+	c.Focus()
+	c.Update(teamsg.ConversationLoadedMsg(history.Conversation{Messages: []types.Message{
+		{Role: types.UserRole, Content: "question"},
+		{Role: types.AssistantRole, Content: "first line\nsecond line\nthird line"},
+	}}))
+
+	c.Update(key("G"))
+	if c.selected != 1 {
+		t.Fatalf("expected G to select the last message, got %d", c.selected)
+	}
+	c.Update(key("y"))
+	if copied != "first line\nsecond line\nthird line" {
+		t.Errorf("expected y to copy the text, got %q", copied)
+	}
+	c.Update(key("Y"))
+	if !strings.HasPrefix(copied, "## AI\n\nfirst line") {
+		t.Errorf("expected Y to copy markdown, got %q", copied)
+	}
+
+	_, cmd := c.Update(key("q"))
+	if quote, ok := cmd().(teamsg.QuoteMsg); !ok || quote != "> first line\n> second line\n> third line\n\n" {
+		t.Errorf("expected q to quote the message, got %#v", cmd())
+	}
+
+	c.Update(key("c"))
+	if view := c.viewport.View(); !strings.Contains(view, "(3 lines)") || strings.Contains(view, "second line") {
+		t.Errorf("expected c to fold the message, got\n%s", view)
+	}
+	c.Update(key("c"))
+	if !strings.Contains(c.viewport.View(), "second line") {
+		t.Errorf("expected c to unfold the message, got\n%s", c.viewport.View())
+	}
+
+	c.Update(key("g"))
+	c.Update(key("d"))
+	c.Update(key("p"))
+	if got := c.conversation.Context(2); len(got) != 1 || got[0].Role != types.AssistantRole {
+		t.Errorf("expected the first message to be excluded from the context, got %v", got)
+	}
+	if node := c.conversation.PathNode(0); !node.Pinned {
+		t.Error("expected p to pin the message")
+	}
+	if !strings.Contains(c.viewport.View(), "(pinned, excluded)") {
+		t.Errorf("expected the notes to be shown, got\n%s", c.viewport.View())
+	}
+}
+
+func TestSearch(t *testing.T) {
+	c := NewConvo(config.Config{}, nil).(*Convo)
+	c.SetDimensions(80, 40)
+	c.Focus()
+	c.Update(teamsg.ConversationLoadedMsg(history.Conversation{Messages: []types.Message{
+		{Role: types.UserRole, Content: "alpha beta"},
+		{Role: types.AssistantRole, Content: "**Beta** gamma, beta"},
+	}}))
+
+	c.Update(key("/"))
+	for _, r := range "beta" {
+		c.Update(key(string(r)))
+	}
+	if got := len(c.search.matches); got != 2 {
+		t.Fatalf("expected 2 matches, got %d", got)
+	}
+	if !strings.Contains(c.View(), "1/2") {
+		t.Errorf("expected the match counter, got\n%s", c.View())
+	}
+	c.Update(tea.KeyMsg{Type: tea.KeyEnter})
+
+	c.Update(key("n"))
+	if found := c.search.matches[c.search.current]; found.message != 1 || found.start != 16 {
+		t.Errorf("expected n to jump to the match in the reply, got %+v", found)
+	}
+	c.Update(key("n"))
+	if c.search.current != 0 {
+		t.Errorf("expected n to wrap around, got %d", c.search.current)
+	}
+	c.Update(key("N"))
+	if c.search.current != 1 {
+		t.Errorf("expected N to go back, got %d", c.search.current)
+	}
+
+	// the markdown emphasis is not in the way
+	c.Update(key("/"))
+	c.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("beta")})
+	c.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("i"), Alt: true})
+	if got := len(c.search.matches); got != 3 {
+		t.Errorf("expected 3 matches ignoring case, got %d", got)
+	}
+
+	c.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r"), Alt: true})
+	for i := 0; i < 4; i++ {
+		c.Update(tea.KeyMsg{Type: tea.KeyBackspace})
+	}
+	c.Update(key("b.t+a"))
+	if got := len(c.search.matches); got != 3 {
+		t.Errorf("expected 3 regex matches, got %d", got)
+	}
+	c.Update(key("("))
+	if c.search.err == nil || !strings.Contains(c.View(), "invalid regex") {
+		t.Errorf("expected an invalid regex, got\n%s", c.View())
+	}
+
+	c.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if c.search.shown() || len(c.search.matches) > 0 {
+		t.Error("expected esc to close the search")
+	}
+	for _, m := range c.messages {
+		if len(m.highlights) > 0 {
+			t.Error("expected esc to remove the highlights")
+		}
+	}
+}
+
+func TestTitleSuggestion(t *testing.T) {
+	c := NewConvo(config.Config{}, nil).(*Convo)
+	c.SetDimensions(80, 20)
+	c.Update(teamsg.ConversationLoadedMsg(history.Conversation{ID: "a", Messages: []types.Message{
+		{Role: types.UserRole, Content: "How do I configure NATS?"},
+		{Role: types.AssistantRole, Content: "Write a nats.conf file."},
+	}}))
+
+	c.Update(teamsg.TitleSuggestedMsg{ConversationID: "other", Title: "Pancakes"})
+	if c.conversation.Name != "" {
+		t.Fatal("expected a suggestion for another conversation to be ignored")
+	}
+	c.Update(teamsg.TitleSuggestedMsg{ConversationID: "a", Title: "Configure NATS", Tags: []string{"nats"}})
+	if c.conversation.Title() != "Configure NATS" || !strings.Contains(c.View(), "Named: Configure NATS #nats") {
+		t.Errorf("expected the suggestion to be applied and shown, got\n%s", c.View())
+	}
+	if c.viewport.Height != 19 {
+		t.Errorf("expected the title bar to take a line, got a viewport of %d lines", c.viewport.Height)
+	}
+
+	_, cmd := c.Update(tea.KeyMsg{Type: tea.KeyCtrlE})
+	if edit := cmd(); edit != teamsg.EditTitleMsg("Configure NATS #nats") {
+		t.Errorf("expected ctrl+e to edit the title, got %#v", edit)
+	}
+	c.Update(teamsg.TitleEditedMsg("NATS cluster setup #nats #infra"))
+	if c.conversation.Name != "NATS cluster setup" || strings.Join(c.conversation.Tags, ",") != "nats,infra" {
+		t.Errorf("expected the edited title and tags, got %q %q", c.conversation.Name, c.conversation.Tags)
+	}
+	if strings.Contains(c.View(), "Named:") {
+		t.Error("expected the title bar to be closed after editing")
+	}
+}
+
+func TestContextWindow(t *testing.T) {
+	long := strings.Repeat("word ", 40)
+	cfg := config.Config{Context: config.Context{Windows: map[types.LLMModel]int{"small": 150}, Reserve: 50}}
+	conversation := history.Conversation{ID: "a", Model: types.Model{Name: "small"}, Messages: []types.Message{
+		{Role: types.UserRole, Content: "first " + long},
+		{Role: types.AssistantRole, Content: long},
+		{Role: types.UserRole, Content: "second"},
+		{Role: types.AssistantRole, Content: "ok"},
+	}}
+
+	c := NewConvo(cfg, nil).(*Convo)
+	c.Update(teamsg.ConversationLoadedMsg(conversation))
+	c.conversation.PathNode(0).Pinned = true
+	plan := c.plan(4, "third")
+	if len(plan.Dropped) != 1 || plan.Messages[0].Content != "first "+long {
+		t.Errorf("expected the reply to the pinned prompt to be left out, got %d messages", len(plan.Messages))
+	}
+	usage, ok := c.usage()().(teamsg.ContextUsageMsg)
+	if !ok || !usage.Warn || usage.Dropped != 1 || usage.Window != 150 {
+		t.Errorf("expected a warning about the dropped message, got %+v", usage)
+	}
+
+	cfg.Context.Strategy = "summary"
+	c = NewConvo(cfg, nil).(*Convo)
+	conversation.Summary = &history.Summary{Text: "They said hello.", Through: 2}
+	c.Update(teamsg.ConversationLoadedMsg(conversation))
+	plan = c.plan(4, "third")
+	if len(plan.Dropped) != 0 || len(plan.Messages) != 3 || !strings.Contains(plan.Messages[0].Content, "They said hello.") {
+		t.Errorf("expected the summary to replace the first turn, got %+v", plan.Messages)
+	}
+}
+
+// slowTokenizer is an Ollama server taking its time to tokenize.
+type slowTokenizer struct{}
+
+func (slowTokenizer) Tokenize(ctx context.Context, text string) ([]int, error) {
+	select {
+	case <-time.After(100 * time.Millisecond):
+		return make([]int, len(text)), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// TestSlowTokenizer checks a slow server doesn't block Update, the tokens are
+// estimated until it counted them in the background.
+func TestSlowTokenizer(t *testing.T) {
+	c := NewConvo(config.Config{}, nil).(*Convo)
+	remote := tokens.NewRemote(slowTokenizer{}, tokens.Heuristic{})
+	c.counter = remote
+	conversation := history.Conversation{ID: "a"}
+	for i := 0; i < 10; i++ {
+		conversation.Messages = append(conversation.Messages, types.Message{Role: types.UserRole, Content: fmt.Sprint("message ", i)})
+	}
+	start := time.Now()
+	_, cmd := c.Update(teamsg.ConversationLoadedMsg(conversation))
+	c.Update(teamsg.PromptChangedMsg{Text: "next", Index: -1})
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("expected Update not to wait on the server, took %s", d)
+	}
+	estimated := c.plan(len(conversation.Messages), "").Tokens
+	// the usage is reported, then the counts are made
+	msgs := cmd().(tea.BatchMsg)
+	if _, ok := msgs[0]().(teamsg.ContextUsageMsg); !ok {
+		t.Fatal("expected the usage to be reported first")
+	}
+	if _, ok := msgs[1]().(countsWarmedMsg); !ok {
+		t.Fatal("expected the counts to be made in the background")
+	}
+	_, cmd = c.Update(countsWarmedMsg{})
+	usage := cmd().(teamsg.ContextUsageMsg)
+	if usage.Tokens <= estimated {
+		t.Errorf("expected the server counts to replace the estimates, got %d tokens, estimated %d", usage.Tokens, estimated)
+	}
+}
+
+func TestPromptTokens(t *testing.T) {
+	cfg := config.Config{Context: config.Context{Windows: map[types.LLMModel]int{"small": 100}, Reserve: 20}}
+	conversation := history.Conversation{ID: "a", Model: types.Model{Name: "small"}, Messages: []types.Message{
+		{Role: types.UserRole, Content: strings.Repeat("word ", 40)},
+		{Role: types.AssistantRole, Content: "ok"},
+	}}
+	c := NewConvo(cfg, nil).(*Convo)
+	c.Update(teamsg.ConversationLoadedMsg(conversation))
+
+	// the heuristic counts a token per 4 characters, messages take 4 more
+	_, cmd := c.Update(teamsg.PromptChangedMsg{Text: "12345678", Index: -1})
+	count := cmd().(teamsg.PromptTokensMsg)
+	if count.Tokens != 2 || count.Context != 3+54+5+6 || count.Window != 100 || count.Warn {
+		t.Errorf("unexpected count %+v", count)
+	}
+	// editing the first message leaves out the rest
+	_, cmd = c.Update(teamsg.PromptChangedMsg{Text: strings.Repeat("word ", 60), Index: 0})
+	count = cmd().(teamsg.PromptTokensMsg)
+	if count.Context != 3+79 || !count.Warn {
+		t.Errorf("expected a warning for the long edit, got %+v", count)
+	}
+
+	p := NewPrompt().(*Prompt)
+	p.SetDimensions(40, 3)
+	p.Focus()
+	p.Update(teamsg.PromptTokensMsg{Text: "stale", Tokens: 2, Context: 10, Window: 100})
+	if strings.Contains(p.View(), "tokens") {
+		t.Errorf("expected the count of another prompt to be ignored, got\n%s", p.View())
+	}
+	p.textarea.SetValue("hello")
+	p.Update(teamsg.PromptTokensMsg{Text: "hello", Tokens: 2, Context: 10, Window: 100})
+	if !strings.Contains(p.View(), "2 tokens · context 10/100") {
+		t.Errorf("expected the count below the prompt, got\n%s", p.View())
+	}
+}
+
+func TestClientError(t *testing.T) {
+	c := NewConvo(config.Config{}, nil).(*Convo)
+	c.SetDimensions(80, 20)
+	c.Update(teamsg.ModelSelectedMsg(types.Model{Name: "gpt-9", Platform: "nowhere"}))
+	if !strings.Contains(c.View(), `error: platform "nowhere" is not supported`) {
+		t.Errorf("expected the error to be shown, got\n%s", c.View())
+	}
+	if len(c.messages) != 0 || c.viewport.Height != 19 {
+		t.Errorf("expected the error to take a line above the messages, got %d messages in %d lines", len(c.messages), c.viewport.Height)
+	}
+	// the prompt is answered with the error
+	_, cmd := c.Update(teamsg.ChatPromptMsg("hello"))
+	stream, ok := cmd().(tea.BatchMsg)[0]().(teamsg.ChatStreamMsg)
+	if !ok || len(stream.Batch) != 1 || stream.Batch[0].Type != types.ErrorEvent {
+		t.Fatalf("expected an error event, got %+v", stream)
+	}
+	c.Update(stream)
+	if !strings.Contains(c.View(), "You:") {
+		t.Errorf("expected the prompt to be shown, got\n%s", c.View())
+	}
+}
+
+// TestSummaryCancelled checks a summary stopped with the reply or the model
+// doesn't keep the next ones from being made.
+func TestSummaryCancelled(t *testing.T) {
+	for _, stop := range []tea.Msg{
+		teamsg.ChatPromptMsg("next"),
+		teamsg.ModelSelectedMsg(types.Model{Name: "gpt-9", Platform: "nowhere"}),
+	} {
+		c := NewConvo(config.Config{}, nil).(*Convo)
+		c.SetDimensions(80, 20)
+		c.Update(teamsg.ChatPromptMsg("hello"))
+		ctx, cancel := context.WithCancel(context.Background())
+		c.summarizing, c.stopSummary = true, cancel
+		c.Update(stop)
+		if c.summarizing || ctx.Err() == nil {
+			t.Errorf("expected %T to stop the summary", stop)
+		}
+	}
+}
+
+func TestEmptyPromptIsNotSent(t *testing.T) {
+	p := NewPrompt().(*Prompt)
+	p.SetDimensions(40, 3)
+	p.Focus()
+	p.textarea.SetValue("  ")
+	if _, cmd := p.Update(tea.KeyMsg{Type: tea.KeyEnter}); cmd != nil {
+		t.Errorf("expected a blank prompt not to be sent, got %#v", cmd())
+	}
+	p.Update(teamsg.AttachMsg{Name: "notes.txt", Content: "remember"})
+	_, cmd := p.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd == nil {
+		t.Fatal("expected the attachment to be sent")
+	}
+	if prompt, ok := cmd().(teamsg.ChatPromptMsg); !ok || !strings.Contains(string(prompt), "remember") {
+		t.Errorf("expected the attachment in the prompt, got %#v", prompt)
+	}
+}
+
+func TestToolRounds(t *testing.T) {
+	c := NewConvo(config.Config{Tools: config.Tools{MaxRounds: 1}}, nil).(*Convo)
+	c.SetDimensions(80, 20)
+	c.Update(teamsg.ChatPromptMsg("what time is it?"))
+	events := make(chan types.StreamEvent)
+	c.Update(teamsg.ChatStreamMsg{Events: events})
+	call := types.ToolCall{ID: "call_1", Name: "current_time", Arguments: "{}"}
+	_, cmd := c.Update(teamsg.ChatStreamDeltaMsg{Events: events, Batch: []types.StreamEvent{{Type: types.ToolCallEvent, ToolCall: &call}, {Type: types.DoneEvent}}})
+	if cmd == nil || c.cancel == nil || c.toolRounds != 1 {
+		t.Fatalf("expected the tool to be run, %d rounds", c.toolRounds)
+	}
+	if reply := c.conversation.Messages[1]; len(reply.ToolCalls) != 1 || reply.ToolCalls[0].Name != "current_time" {
+		t.Errorf("expected the call in the conversation, got %+v", reply)
+	}
+
+	c.Update(teamsg.ToolResultsMsg{Run: c.toolRun - 1})
+	if len(c.conversation.Messages) != 2 {
+		t.Error("expected the results of another run to be ignored")
+	}
+	if c.runTools([]types.ToolCall{call}) != nil || !strings.Contains(c.View(), "stopped after 1 rounds of tool calls") {
+		t.Errorf("expected the calls past the limit to be stopped, got\n%s", c.View())
+	}
+}
+
+func TestPromptInterruptsReply(t *testing.T) {
+	c := NewConvo(config.Config{}, nil).(*Convo)
+	c.SetDimensions(80, 20)
+	c.Update(teamsg.ChatPromptMsg("a"))
+	events := make(chan types.StreamEvent)
+	c.Update(teamsg.ChatStreamMsg{Events: events})
+	c.Update(teamsg.ChatStreamDeltaMsg{Events: events, Batch: []types.StreamEvent{{Type: types.TextDelta, Text: "partial-old"}}})
+
+	c.Update(teamsg.ChatPromptMsg("b"))
+	next := make(chan types.StreamEvent)
+	c.Update(teamsg.ChatStreamMsg{Events: next})
+	// left over from the interrupted reply
+	c.Update(teamsg.ChatStreamDeltaMsg{Events: events, Batch: []types.StreamEvent{{Type: types.TextDelta, Text: " more"}}})
+	c.Update(teamsg.ChatStreamDeltaMsg{Events: next, Batch: []types.StreamEvent{{Type: types.TextDelta, Text: "new"}, {Type: types.DoneEvent}}})
+
+	var got []string
+	for _, m := range c.conversation.Messages {
+		got = append(got, fmt.Sprintf("%s %q", m.Role, m.Content))
+	}
+	want := []string{`user "a"`, `assistant "partial-old"`, `user "b"`, `assistant "new"`}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if !strings.Contains(c.View(), "interrupted") {
+		t.Errorf("expected the partial reply to be marked, got\n%s", c.View())
+	}
+}
+
+// BenchmarkStreamDelta measures the cost of a single streamed token, with
+// deltas coalesced on frames.
+func BenchmarkStreamDelta(b *testing.B) {
+	benchmarkStream(b, tokensPerFrame, false)
+}
+
+// BenchmarkStreamDeltaEveryFrame renders a frame after every token, the
+// finished messages are still kept rendered.
+func BenchmarkStreamDeltaEveryFrame(b *testing.B) {
+	benchmarkStream(b, 1, false)
+}
+
+// BenchmarkStreamDeltaUncoalesced renders every message again on every
+// token, which is what the convo used to do, for comparison.
+func BenchmarkStreamDeltaUncoalesced(b *testing.B) {
+	benchmarkStream(b, 1, true)
+}
+
+// benchmarkStream streams tokens in conversations of growing length,
+// rendering a frame every perFrame tokens. With whole set, every message is
+// rendered again on each frame, markdown included, instead of only the
+// reply.
+func benchmarkStream(b *testing.B, perFrame int, whole bool) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("messages=%d", n), func(b *testing.B) {
+			c, events := streamingConvo(n)
+			delta := teamsg.ChatStreamDeltaMsg{Events: events, Batch: []types.StreamEvent{{Type: types.TextDelta, Text: "token "}}}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.Update(delta)
+				if i%perFrame == 0 {
+					if whole {
+						for _, m := range c.messages {
+							m.invalidate()
+						}
+						c.renderHead()
+					}
+					c.Update(frameMsg{})
+				}
+				if i%500 == 0 {
+					// keep the reply at a realistic length
+					c.currentResponse = ""
+				}
+			}
+		})
+	}
+}
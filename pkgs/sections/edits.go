@@ -0,0 +1,283 @@
+package sections
+
+import (
+	"fmt"
+	"strings"
+	"teachat/pkgs/patch"
+	"teachat/pkgs/styles"
+	"teachat/pkgs/teamsg"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Edits previews the edits proposed in a reply, file by file, and applies
+// the hunks selected to the working tree. The last apply can be undone.
+type Edits struct {
+	hidden        bool
+	focused       bool
+	width, height int
+	// root is the directory the paths of the edits are relative to.
+	root  string
+	files []patch.File
+	hunks []editHunk
+	// cursor is the index of the selected hunk, top the first line shown.
+	cursor int
+	top    int
+	backup *patch.Backup
+	status string
+	err    string
+}
+
+// editHunk is a hunk of the preview. Hunks that don't apply can't be
+// selected.
+type editHunk struct {
+	file, hunk int
+	selected   bool
+	applied    bool
+	err        error
+}
+
+func NewEdits(root string) Section {
+	return &Edits{root: root}
+}
+
+func (s *Edits) GetSectionName() SectionName {
+	return EditsSection
+}
+
+func (s *Edits) SetDimensions(width, height int) {
+	s.width = width
+	s.height = height
+}
+
+func (s *Edits) IsHidden() bool {
+	return s.hidden
+}
+
+func (s *Edits) IsFocused() bool {
+	return s.focused
+}
+
+func (s *Edits) Update(msg tea.Msg) (Section, tea.Cmd) {
+	if !s.focused {
+		return s, nil
+	}
+	switch msg := msg.(type) {
+	case teamsg.EditsMsg:
+		s.files = msg
+		s.cursor, s.top = 0, 0
+		s.status, s.err = "", ""
+		s.check()
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "up", "k":
+			s.cursor = max(s.cursor-1, 0)
+		case "down", "j":
+			s.cursor = min(s.cursor+1, max(len(s.hunks)-1, 0))
+		case " ":
+			if s.cursor < len(s.hunks) {
+				h := &s.hunks[s.cursor]
+				h.selected = !h.selected && h.err == nil && !h.applied
+			}
+		case "a":
+			// all the hunks that apply, or none when they all are
+			all := true
+			for _, h := range s.hunks {
+				all = all && (h.selected || h.err != nil || h.applied)
+			}
+			for i := range s.hunks {
+				s.hunks[i].selected = !all && s.hunks[i].err == nil && !s.hunks[i].applied
+			}
+		case "enter":
+			s.apply()
+		case "u":
+			s.undo()
+		}
+	}
+	return s, nil
+}
+
+// check finds the hunks that don't apply to the working tree, the others
+// are selected.
+func (s *Edits) check() {
+	s.hunks = nil
+	for i, f := range s.files {
+		for j, err := range patch.Check(s.root, f) {
+			s.hunks = append(s.hunks, editHunk{file: i, hunk: j, selected: err == nil, err: err})
+		}
+	}
+}
+
+// apply applies the selected hunks, keeping what undoes them.
+func (s *Edits) apply() {
+	files := make([]patch.File, len(s.files))
+	n := 0
+	for i, f := range s.files {
+		files[i] = f
+		files[i].Hunks = nil
+	}
+	for _, h := range s.hunks {
+		if h.selected {
+			files[h.file].Hunks = append(files[h.file].Hunks, s.files[h.file].Hunks[h.hunk])
+			n++
+		}
+	}
+	if n == 0 {
+		s.status, s.err = "", "no hunk selected"
+		return
+	}
+	backup, err := patch.Apply(s.root, files)
+	if err != nil {
+		s.status, s.err = "", err.Error()
+		return
+	}
+	s.backup = backup
+	for i := range s.hunks {
+		if s.hunks[i].selected {
+			s.hunks[i].selected, s.hunks[i].applied = false, true
+		}
+	}
+	s.status, s.err = fmt.Sprintf("applied %d %s to %d %s, u to undo", n, plural(n, "hunk"), backup.Files(), plural(backup.Files(), "file")), ""
+}
+
+// undo puts back the files changed by the last apply.
+func (s *Edits) undo() {
+	if s.backup == nil {
+		s.status, s.err = "", "nothing to undo"
+		return
+	}
+	if err := s.backup.Undo(); err != nil {
+		s.status, s.err = "", err.Error()
+		return
+	}
+	s.backup = nil
+	s.check()
+	s.status, s.err = "undone", ""
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+func (s *Edits) View() string {
+	if s.hidden {
+		return ""
+	}
+	width := max(s.width-4, 10)
+	var lines []string
+	// start is the line of the header of the selected hunk, end the line
+	// after it
+	start, end := 0, 0
+	file := -1
+	for i, h := range s.hunks {
+		f := s.files[h.file]
+		if h.file != file {
+			file = h.file
+			name := f.Path
+			switch {
+			case f.Create:
+				name += " (new file)"
+			case f.Delete:
+				name += " (deleted)"
+			}
+			if len(lines) > 0 {
+				lines = append(lines, "")
+			}
+			lines = append(lines, styles.ToolStyle.Render(truncate(name, width)))
+		}
+		hunk := f.Hunks[h.hunk]
+		mark := "[ ]"
+		switch {
+		case h.applied:
+			mark = "[✓]"
+		case h.err != nil:
+			mark = "[!]"
+		case h.selected:
+			mark = "[x]"
+		}
+		header := mark + " " + hunk.Header()
+		if h.err != nil {
+			header += " · " + conflictReason(h.err)
+		}
+		header = truncate(header, width-2)
+		switch {
+		case i == s.cursor:
+			start = len(lines)
+			lines = append(lines, styles.SelectedStyle.Render("| "+header))
+		case h.err != nil:
+			lines = append(lines, "  "+styles.ErrorStyle.Render(header))
+		default:
+			lines = append(lines, "  "+header)
+		}
+		for _, l := range hunk.Lines {
+			shown := truncate("  "+strings.ReplaceAll(l, "\t", "    "), width)
+			switch l[0] {
+			case '+':
+				shown = styles.AddedStyle.Render(shown)
+			case '-':
+				shown = styles.RemovedStyle.Render(shown)
+			}
+			lines = append(lines, shown)
+		}
+		if i == s.cursor {
+			end = len(lines)
+		}
+	}
+	if len(s.hunks) == 0 {
+		lines = append(lines, styles.NoteStyle.Render("No edits found in the reply."))
+	}
+	footer := []string{""}
+	switch {
+	case s.err != "":
+		footer = append(footer, styles.ErrorStyle.Render(truncate(s.err, width)))
+	case s.status != "":
+		footer = append(footer, styles.NoteStyle.Render(truncate(s.status, width)))
+	}
+	footer = append(footer, styles.NoteStyle.Render(truncate("space select · a all · enter apply · u undo · ctrl+b back", width)))
+	// the selected hunk is scrolled into view, its header first when it is
+	// too long
+	body := max(s.height-len(footer)-4, 1)
+	if end > s.top+body {
+		s.top = end - body
+	}
+	if start < s.top || end-start > body {
+		s.top = start
+	}
+	lines = lines[min(s.top, len(lines)):]
+	lines = lines[:min(body, len(lines))]
+	view := "Edits\n\n" + strings.Join(lines, "\n") + "\n" + strings.Join(footer, "\n")
+	style := styles.InactiveStyle
+	if s.focused {
+		style = styles.ActiveStyle
+	}
+	return style.Render(view)
+}
+
+// conflictReason is why a hunk doesn't apply, without the file and hunk
+// shown next to it.
+func conflictReason(err error) string {
+	if c, ok := err.(*patch.Conflict); ok {
+		return c.Reason
+	}
+	return err.Error()
+}
+
+func (s *Edits) Hide() {
+	s.hidden = true
+}
+
+func (s *Edits) Show() {
+	s.hidden = false
+}
+
+func (s *Edits) Focus() {
+	s.Show()
+	s.focused = true
+}
+
+func (s *Edits) Blur() {
+	s.focused = false
+}
@@ -10,52 +10,69 @@ import (
 )
 
 const content = `
-# azdoext
+# teachat
 
-A terminal UI to help streamline the process of commiting, pushing, creating PRs and following pipelines in Azure DevOps.
+Chat with OpenAI and Ollama models from the terminal. Conversations are saved
+and can be resumed, searched, branched and exported.
 
 The app is divided into pages:
-* git: where you can stage files, commit, push and create PRs
-* pipelines: where you can see all pipelines related to the current repository and follow them
-* pipeline instance: where you can see the logs and tasks of a specific pipeline run
+* models: where you pick the model to chat with
+* chat: the conversation and the prompt
+* tree: the branches of the conversation
+* history search: the saved conversations
+* MCP servers: the status of the servers, their prompts and resources
 * help: where you are right now
 
-## Usage
-### Keybindings
+## Keybindings
+### Everywhere
 - ctrl+c: quit
-- ctrl+b: go back to previous page
-- ctrl+h: show/hide help
-- ctrl+r: restart the process
-- ctrl+s: save on any textarea
-	- if on commit message: push
-		- if no files are staged, stage all files before pushing
-- ctrl+a: stage file on status list
-- tab: switch between available sections
-- enter: select an option on any list (has no effect on file status list)
-- / : search for a string while on pipeline logs
-
-
-## Commit and push
-When the app starts you will see two sections, commit message and the changed files, files staged will be shown in green.\
-Here you can either write a commit msg and hit ctrl+s to save, stage all files and push\
-You can also stage individual files by pressing ctrl+a while the file is selected.
-
-## Open a PR
-After changes are pushed you will presented with a choice, you can either go directly to pipelines or open a PR.\
-If you chose to open a PR, you will be presented with a text area where the first line is PR title and the rest is PR description.\
-To save and open the PR press ctrl+s.\
-With a opened PR you are taken to pipelines section.
-OBS: Currently, only PRs to the default branch are supported.
-
-## Monitor pipelines
-On pipelines page, you will see all pipelines related to you current repository and their last run status.\
-When you press enter you will be presented with a choice, go to the pipeline instance tasks or run new.\
-While on the pipeline instance section you can go to logs, browse and hit '/' to search for a specific string.\
-
-
-
-
-
+- ctrl+b: go back to the previous page
+- ctrl+h: show the help
+- ctrl+f: search the saved conversations
+- ctrl+o: show the MCP servers
+
+### Chat
+- tab: switch between the conversation and the prompt
+- enter: send the prompt, a prompt starting with ! asks for a shell command
+- esc: stop editing a message or the title, or drop the attachments
+- ctrl+r: regenerate the last reply
+- ctrl+left / ctrl+right: show the previous or next version of the selected or last message
+- ctrl+t: show the conversation tree
+- ctrl+e: edit the title and tags
+- ctrl+y: keep the suggested title
+
+### Conversation
+- [ / ]: select the previous or next message, esc to unselect
+- g / G: jump to the first or last message
+- C: fold or unfold the long messages
+- /: search the conversation
+	- n / N: next or previous match
+	- alt+r: toggle regular expressions
+	- alt+i: toggle ignoring case
+	- esc: clear the search
+
+### Selected message
+- e: edit the prompt, the conversation forks
+- y: copy the content
+- Y: copy as Markdown
+- q: quote in the prompt
+- a: preview and apply the edits of the reply
+- d: drop from the context, or put it back
+- p: pin in the context, or unpin
+- c or space: fold or unfold
+
+### Layout
+- alt+l: switch between side by side, stacked and prompt at the bottom
+- alt+arrows: move the divider
+- alt+c: collapse the focused pane, or expand them all
+- alt+z: maximize the focused pane, or restore it
+
+### Dialogs
+- tool approval: o allow once, s for the session, a always, d deny, y allow, n or esc deny
+- shell command: enter run, tab send the output to the model, esc cancel
+- edits: up / down move, space select, a all or none, enter apply, u undo
+- MCP servers: up / down move, enter use the prompt or resource, r restart the server
+- tree: enter switch to the branch
 `
 
 type Help struct {
@@ -93,7 +110,7 @@ func (h *Help) GetSectionName() SectionName {
 }
 
 func (h *Help) SetDimensions(width, height int) {
-
+	h.viewport.Width = width
 	h.viewport.Height = height
 }
 
@@ -116,7 +133,7 @@ func (h *Help) Update(msg tea.Msg) (Section, tea.Cmd) {
 
 func (h *Help) View() string {
 	if h.focused {
-		return h.style.Width(styles.Width).Render(h.viewport.View())
+		return h.style.Width(h.viewport.Width).Render(h.viewport.View())
 	}
 	return ""
 }
@@ -0,0 +1,231 @@
+package sections
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"teachat/pkgs/history"
+	"teachat/pkgs/styles"
+	"teachat/pkgs/teamsg"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// HistorySearch searches the saved conversations. The index is built when
+// the page is opened, results are updated as the query is typed.
+type HistorySearch struct {
+	hidden  bool
+	focused bool
+	store   *history.Store
+	index   *history.Index
+	input   textinput.Model
+	list    list.Model
+	width   int
+	// status tells the number of results, or why there are none.
+	status string
+}
+
+// resultItem is a search result, the delegate shows its title, details and
+// snippet.
+type resultItem struct {
+	history.Result
+}
+
+func (i resultItem) FilterValue() string { return i.Conversation.Title() }
+
+type resultDelegate struct{}
+
+func (d resultDelegate) Height() int                             { return 3 }
+func (d resultDelegate) Spacing() int                            { return 1 }
+func (d resultDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+func (d resultDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	i, ok := listItem.(resultItem)
+	if !ok {
+		return
+	}
+	width := max(m.Width()-6, 10)
+	c := i.Conversation
+	details := []string{c.ID, fmt.Sprintf("%s (%s)", c.Model.Name, c.Model.Platform), c.UpdatedAt.Format("2006-01-02 15:04")}
+	if len(c.Tags) > 0 {
+		details = append(details, "#"+strings.Join(c.Tags, " #"))
+	}
+	snippet, hits := cutSnippet(i.Snippet, i.Hits, width)
+	lines := []string{
+		truncate(c.Title(), width),
+		styles.NoteStyle.Render(truncate(strings.Join(details, " · "), width)),
+		highlight(snippet, hits, -1),
+	}
+	if index == m.Index() {
+		lines[0] = treeSelectedStyle.Render("| " + lines[0])
+		lines[1] = treeSelectedStyle.Render("| ") + lines[1]
+		lines[2] = treeSelectedStyle.Render("| ") + lines[2]
+		fmt.Fprint(w, strings.Join(lines, "\n"))
+		return
+	}
+	for j, line := range lines {
+		lines[j] = treeItemStyle.Render(line)
+	}
+	fmt.Fprint(w, strings.Join(lines, "\n"))
+}
+
+// truncate cuts s to width runes, ending with an ellipsis when cut.
+func truncate(s string, width int) string {
+	if runes := []rune(s); len(runes) > width {
+		return string(runes[:max(width-1, 0)]) + "…"
+	}
+	return s
+}
+
+// cutSnippet truncates a snippet to width runes, keeping the hits that are
+// still entirely shown.
+func cutSnippet(snippet string, hits [][2]int, width int) (string, [][2]int) {
+	cut := truncate(snippet, width)
+	if cut == snippet {
+		return snippet, hits
+	}
+	limit := len(cut) - len("…")
+	var kept [][2]int
+	for _, h := range hits {
+		if h[1] <= limit {
+			kept = append(kept, h)
+		}
+	}
+	return cut, kept
+}
+
+var searchHelp = styles.NoteStyle.Render("  ↑/↓ select • enter open • ctrl+b back")
+
+func NewHistorySearch(store *history.Store) Section {
+	input := textinput.New()
+	input.Prompt = "Search: "
+	input.Placeholder = "words, model:, platform:, tag:, since:YYYY-MM-DD, until:YYYY-MM-DD"
+	l := list.New([]list.Item{}, resultDelegate{}, 0, 0)
+	l.Title = "Saved conversations"
+	l.SetShowStatusBar(false)
+	l.SetFilteringEnabled(false)
+	// letters go to the query, the list help would tell otherwise
+	l.SetShowHelp(false)
+	l.KeyMap.CursorUp.SetKeys("up")
+	l.KeyMap.CursorDown.SetKeys("down")
+	l.KeyMap.NextPage.SetKeys("pgdown")
+	l.KeyMap.PrevPage.SetKeys("pgup")
+	l.KeyMap.GoToStart.SetKeys("home")
+	l.KeyMap.GoToEnd.SetKeys("end")
+	return &HistorySearch{store: store, input: input, list: l}
+}
+
+func (s *HistorySearch) GetSectionName() SectionName {
+	return HistorySearchSection
+}
+
+func (s *HistorySearch) SetDimensions(width, height int) {
+	s.width = width
+	s.input.Width = max(width-len(s.input.Prompt)-20, 10)
+	s.list.SetWidth(width)
+	// the query and an empty line are above the results, the keys below
+	s.list.SetHeight(max(height-3, 0))
+}
+
+func (s *HistorySearch) IsHidden() bool {
+	return s.hidden
+}
+
+func (s *HistorySearch) IsFocused() bool {
+	return s.focused
+}
+
+func (s *HistorySearch) Update(msg tea.Msg) (Section, tea.Cmd) {
+	if !s.focused {
+		return s, nil
+	}
+	switch msg := msg.(type) {
+	case teamsg.OpenHistorySearchMsg:
+		s.index = nil
+		if s.store != nil {
+			idx, err := s.store.Index()
+			if err != nil {
+				s.status = styles.ErrorStyle.Render("indexing conversations: " + err.Error())
+				return s, s.input.Focus()
+			}
+			s.index = idx
+		}
+		return s, tea.Batch(s.input.Focus(), s.search())
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "enter":
+			item, ok := s.list.SelectedItem().(resultItem)
+			if !ok {
+				return s, nil
+			}
+			q, _ := history.ParseQuery(s.input.Value())
+			selected := teamsg.SearchResultSelectedMsg{Conversation: item.Conversation, Message: item.Message, Terms: q.Terms()}
+			return s, func() tea.Msg { return selected }
+		case "up", "down", "pgup", "pgdown", "home", "end":
+			l, cmd := s.list.Update(msg)
+			s.list = l
+			return s, cmd
+		}
+		query := s.input.Value()
+		input, cmd := s.input.Update(msg)
+		s.input = input
+		if s.input.Value() == query {
+			return s, cmd
+		}
+		return s, tea.Batch(cmd, s.search())
+	}
+	return s, nil
+}
+
+// search shows the results of the query.
+func (s *HistorySearch) search() tea.Cmd {
+	if s.index == nil {
+		s.status = "no saved conversations"
+		return s.list.SetItems(nil)
+	}
+	q, err := history.ParseQuery(s.input.Value())
+	if err != nil {
+		s.status = styles.ErrorStyle.Render(err.Error())
+		return nil
+	}
+	results := s.index.Search(q)
+	items := make([]list.Item, len(results))
+	for i, r := range results {
+		items[i] = resultItem{r}
+	}
+	s.status = fmt.Sprintf("%d of %d", len(results), s.index.Len())
+	s.list.Select(0)
+	return s.list.SetItems(items)
+}
+
+func (s *HistorySearch) View() string {
+	if s.hidden {
+		return ""
+	}
+	left := s.input.View()
+	gap := max(s.width-lipgloss.Width(left)-lipgloss.Width(s.status), 1)
+	view := left + strings.Repeat(" ", gap) + s.status + "\n\n" + s.list.View() + "\n" + searchHelp
+	if s.focused {
+		return styles.ActiveStyle.Render(view)
+	}
+	return styles.InactiveStyle.Render(view)
+}
+
+func (s *HistorySearch) Hide() {
+	s.hidden = true
+}
+
+func (s *HistorySearch) Show() {
+	s.hidden = false
+}
+
+func (s *HistorySearch) Focus() {
+	s.Show()
+	s.focused = true
+}
+
+func (s *HistorySearch) Blur() {
+	s.focused = false
+}
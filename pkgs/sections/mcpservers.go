@@ -0,0 +1,300 @@
+package sections
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"teachat/pkgs/mcp"
+	"teachat/pkgs/styles"
+	"teachat/pkgs/teamsg"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// mcpTimeout bounds getting a prompt or reading a resource.
+const mcpTimeout = 30 * time.Second
+
+// MCPServers shows the status of the MCP servers. Their prompts are inserted
+// in the chat prompt and their resources attached to it.
+type MCPServers struct {
+	hidden        bool
+	focused       bool
+	width, height int
+	manager       *mcp.Manager
+	statuses      []mcp.Status
+	// cursor is the index of the selected entry.
+	cursor int
+	// arguments is shown to fill the arguments of the selected prompt.
+	arguments textinput.Model
+	typing    bool
+	err       string
+}
+
+// mcpEntry is a line of the page that can be selected: a server, or one of
+// its prompts or resources.
+type mcpEntry struct {
+	server   int
+	prompt   *mcp.Prompt
+	resource *mcp.Resource
+}
+
+// mcpErrorMsg reports a failed request to a server.
+type mcpErrorMsg struct{ err error }
+
+func NewMCPServers(manager *mcp.Manager) Section {
+	input := textinput.New()
+	input.Placeholder = "name=value ..."
+	return &MCPServers{manager: manager, arguments: input}
+}
+
+func (s *MCPServers) GetSectionName() SectionName {
+	return MCPServersSection
+}
+
+func (s *MCPServers) SetDimensions(width, height int) {
+	s.width = width
+	s.height = height
+	s.arguments.Width = max(width-10, 10)
+}
+
+func (s *MCPServers) IsHidden() bool {
+	return s.hidden
+}
+
+func (s *MCPServers) IsFocused() bool {
+	return s.focused
+}
+
+// entries lists the selectable lines.
+func (s *MCPServers) entries() []mcpEntry {
+	var entries []mcpEntry
+	for i := range s.statuses {
+		entries = append(entries, mcpEntry{server: i})
+		for j := range s.statuses[i].Prompts {
+			entries = append(entries, mcpEntry{server: i, prompt: &s.statuses[i].Prompts[j]})
+		}
+		for j := range s.statuses[i].Resources {
+			entries = append(entries, mcpEntry{server: i, resource: &s.statuses[i].Resources[j]})
+		}
+	}
+	return entries
+}
+
+func (s *MCPServers) selected() (mcpEntry, bool) {
+	entries := s.entries()
+	if s.cursor >= len(entries) {
+		return mcpEntry{}, false
+	}
+	return entries[s.cursor], true
+}
+
+func (s *MCPServers) Update(msg tea.Msg) (Section, tea.Cmd) {
+	switch msg := msg.(type) {
+	case teamsg.MCPServersMsg:
+		// the status is kept while another page is shown
+		s.statuses = msg.Statuses
+		s.cursor = min(s.cursor, max(len(s.entries())-1, 0))
+		return s, nil
+	case mcpErrorMsg:
+		s.err = msg.err.Error()
+		return s, nil
+	}
+	if !s.focused {
+		return s, nil
+	}
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return s, nil
+	}
+	if s.typing {
+		switch key.Type {
+		case tea.KeyEsc:
+			s.typing = false
+			s.arguments.Blur()
+			return s, nil
+		case tea.KeyEnter:
+			s.typing = false
+			s.arguments.Blur()
+			if e, ok := s.selected(); ok && e.prompt != nil {
+				return s, s.getPrompt(e, parseArguments(s.arguments.Value()))
+			}
+			return s, nil
+		}
+		input, cmd := s.arguments.Update(msg)
+		s.arguments = input
+		return s, cmd
+	}
+	switch key.String() {
+	case "up", "k":
+		s.cursor = max(s.cursor-1, 0)
+	case "down", "j":
+		s.cursor = min(s.cursor+1, max(len(s.entries())-1, 0))
+	case "r":
+		if e, ok := s.selected(); ok {
+			s.err = ""
+			s.manager.Restart(s.statuses[e.server].Name)
+		}
+	case "enter":
+		e, ok := s.selected()
+		if !ok {
+			return s, nil
+		}
+		s.err = ""
+		switch {
+		case e.resource != nil:
+			return s, s.readResource(e)
+		case e.prompt != nil && len(e.prompt.Arguments) > 0:
+			s.typing = true
+			s.arguments.Reset()
+			return s, s.arguments.Focus()
+		case e.prompt != nil:
+			return s, s.getPrompt(e, nil)
+		}
+	}
+	return s, nil
+}
+
+// parseArguments reads the name=value pairs typed for a prompt.
+func parseArguments(text string) map[string]string {
+	arguments := make(map[string]string)
+	for _, field := range strings.Fields(text) {
+		if name, value, ok := strings.Cut(field, "="); ok {
+			arguments[name] = value
+		}
+	}
+	return arguments
+}
+
+func (s *MCPServers) getPrompt(e mcpEntry, arguments map[string]string) tea.Cmd {
+	manager, server, name := s.manager, s.statuses[e.server].Name, e.prompt.Name
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), mcpTimeout)
+		defer cancel()
+		text, err := manager.GetPrompt(ctx, server, name, arguments)
+		if err != nil {
+			return mcpErrorMsg{fmt.Errorf("prompt %s: %w", name, err)}
+		}
+		return teamsg.MCPPromptMsg(text)
+	}
+}
+
+func (s *MCPServers) readResource(e mcpEntry) tea.Cmd {
+	manager, server, uri := s.manager, s.statuses[e.server].Name, e.resource.URI
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), mcpTimeout)
+		defer cancel()
+		text, err := manager.ReadResource(ctx, server, uri)
+		if err != nil {
+			return mcpErrorMsg{fmt.Errorf("resource %s: %w", uri, err)}
+		}
+		return teamsg.AttachMsg{Name: uri, Content: text}
+	}
+}
+
+// stateStyles colors the state of the servers.
+var stateStyles = map[mcp.State]lipgloss.Style{
+	mcp.Running:  styles.ToolStyle,
+	mcp.Starting: styles.WarningStyle,
+	mcp.Failed:   styles.ErrorStyle,
+	mcp.Stopped:  styles.NoteStyle,
+}
+
+func (s *MCPServers) View() string {
+	if s.hidden {
+		return ""
+	}
+	width := max(s.width-4, 10)
+	lines := []string{"MCP servers", ""}
+	if len(s.statuses) == 0 {
+		lines = append(lines, styles.NoteStyle.Render("No server configured, add them to mcp_servers in the configuration."))
+	}
+	index := 0
+	line := func(text string) {
+		text = truncate(text, width-2)
+		if index == s.cursor {
+			lines = append(lines, styles.SelectedStyle.Render("| "+text))
+		} else {
+			lines = append(lines, "  "+text)
+		}
+		index++
+	}
+	for _, status := range s.statuses {
+		state := stateStyles[status.State].Render(string(status.State))
+		if status.Restarts > 0 {
+			state += styles.NoteStyle.Render(fmt.Sprintf(" (%d restarts)", status.Restarts))
+		}
+		line(fmt.Sprintf("%s %s · %s", status.Name, state, status.Target))
+		details := []string{}
+		if status.Server != "" {
+			details = append(details, status.Server)
+		}
+		if len(status.Tools) > 0 {
+			names := make([]string, len(status.Tools))
+			for i, t := range status.Tools {
+				names[i] = t.Name
+			}
+			details = append(details, "tools: "+strings.Join(names, ", "))
+		}
+		if len(details) > 0 {
+			lines = append(lines, styles.NoteStyle.Render(truncate("    "+strings.Join(details, " · "), width)))
+		}
+		if status.Err != "" {
+			lines = append(lines, styles.ErrorStyle.Render(truncate("    "+status.Err, width)))
+		}
+		for _, p := range status.Prompts {
+			line("  prompt " + p.Name + describe(p.Description))
+		}
+		for _, r := range status.Resources {
+			line("  resource " + r.URI + describe(r.Name))
+		}
+	}
+	if e, ok := s.selected(); ok {
+		if stderr := s.statuses[e.server].Stderr; len(stderr) > 0 {
+			lines = append(lines, "", "stderr of "+s.statuses[e.server].Name+":")
+			// the last lines that fit, below the keys
+			n := max(s.height-len(lines)-6, 1)
+			for _, l := range stderr[max(len(stderr)-n, 0):] {
+				lines = append(lines, styles.NoteStyle.Render(truncate("  "+l, width)))
+			}
+		}
+	}
+	if s.err != "" {
+		lines = append(lines, "", styles.ErrorStyle.Render(truncate(s.err, width)))
+	}
+	if s.typing {
+		lines = append(lines, "", "Arguments: "+s.arguments.View())
+	}
+	lines = append(lines, "", styles.NoteStyle.Render("enter insert prompt or attach resource · r restart · ctrl+b back"))
+	style := styles.InactiveStyle
+	if s.focused {
+		style = styles.ActiveStyle
+	}
+	return style.Render(strings.Join(lines, "\n"))
+}
+
+func describe(text string) string {
+	if text == "" {
+		return ""
+	}
+	return " · " + text
+}
+
+func (s *MCPServers) Hide() {
+	s.hidden = true
+}
+
+func (s *MCPServers) Show() {
+	s.hidden = false
+}
+
+func (s *MCPServers) Focus() {
+	s.Show()
+	s.focused = true
+}
+
+func (s *MCPServers) Blur() {
+	s.focused = false
+}
@@ -59,13 +59,7 @@ func (s *ModelList) Update(msg tea.Msg) (Section, tea.Cmd) {
 			}
 			return s, s.list.SetItems(items)
 		case teamsg.GetSupportedModelsMsg:
-			models := []types.Model{
-				{Name: types.GPT35, Platform: types.OpenAI},
-				{Name: types.GPT4, Platform: types.OpenAI},
-				{Name: types.GPT4o, Platform: types.OpenAI},
-				{Name: types.Llama3, Platform: types.Ollama},
-			}
-			return s, func() tea.Msg { return teamsg.ModelsMsg(models) }
+			return s, func() tea.Msg { return teamsg.ModelsMsg(types.SupportedModels) }
 		}
 	}
 	return s, nil
@@ -1,8 +1,11 @@
 package sections
 
 import (
+	"fmt"
+	"strings"
 	"teachat/pkgs/styles"
 	"teachat/pkgs/teamsg"
+	"teachat/pkgs/tokens"
 
 	"github.com/charmbracelet/bubbles/textarea"
 	tea "github.com/charmbracelet/bubbletea"
@@ -14,15 +17,34 @@ type Prompt struct {
 	focused  bool
 	textarea textarea.Model
 	style    lipgloss.Style
+	// editing is the index of the message being edited, or -1.
+	editing int
+	// editingTitle is set while the title of the conversation is edited.
+	editingTitle bool
+	// count is the number of tokens of the prompt, shown on the last line
+	// of the section when it is higher than a line.
+	count     teamsg.PromptTokensMsg
+	showCount bool
+	width     int
+	// attachments are sent after the prompt, they are listed on the last
+	// line of the section.
+	attachments []teamsg.AttachMsg
 }
 
+const (
+	promptMarker = "┃ "
+	editMarker   = "✎ "
+	titleMarker  = "# "
+)
+
 func NewPrompt() Section {
 	ta := textarea.New()
 	ta.Placeholder = "Send a message..."
 	ta.Focus()
 
-	ta.Prompt = "┃ "
-	ta.CharLimit = 280
+	ta.Prompt = promptMarker
+	// quoted messages can be long
+	ta.CharLimit = 0
 
 	// Remove cursor line styling
 	ta.FocusedStyle.CursorLine = lipgloss.NewStyle()
@@ -34,6 +56,7 @@ func NewPrompt() Section {
 	return &Prompt{
 		textarea: ta,
 		style:    styles.ActiveStyle.Copy(),
+		editing:  -1,
 	}
 }
 
@@ -42,7 +65,12 @@ func (p *Prompt) GetSectionName() SectionName {
 }
 
 func (p *Prompt) SetDimensions(width, height int) {
+	p.width = width
 	p.textarea.SetWidth(width)
+	p.showCount = height > 1
+	if p.showCount {
+		height--
+	}
 	p.textarea.SetHeight(height)
 }
 
@@ -55,34 +83,177 @@ func (p *Prompt) IsFocused() bool {
 }
 
 func (p *Prompt) Update(msg tea.Msg) (Section, tea.Cmd) {
+	if count, ok := msg.(teamsg.PromptTokensMsg); ok {
+		// the prompt may have changed while it was counted
+		if count.Text == p.content() {
+			p.count = count
+		}
+		return p, nil
+	}
 	if p.focused {
 
 		switch msg := msg.(type) {
 		case tea.KeyMsg:
 			switch msg.Type {
 			case tea.KeyEnter:
-				prompt := p.textarea.Value()
+				if p.editingTitle {
+					title := p.textarea.Value()
+					p.textarea.Reset()
+					p.count = teamsg.PromptTokensMsg{}
+					p.stopEditing()
+					return p, func() tea.Msg { return teamsg.TitleEditedMsg(title) }
+				}
+				if strings.TrimSpace(p.textarea.Value()) == "" && len(p.attachments) == 0 {
+					// nothing to send
+					return p, nil
+				}
+				prompt := p.content()
 				p.textarea.Reset()
+				p.attachments = nil
+				p.count = teamsg.PromptTokensMsg{}
+				if index := p.editing; index >= 0 {
+					p.stopEditing()
+					return p, func() tea.Msg { return teamsg.ChatEditMsg{Index: index, Content: prompt} }
+				}
 
 				return p, func() tea.Msg { return teamsg.ChatPromptMsg(prompt) }
+			case tea.KeyEsc:
+				if p.editing >= 0 || p.editingTitle {
+					p.textarea.Reset()
+					p.stopEditing()
+					return p, p.changed()
+				}
+				if len(p.attachments) > 0 {
+					p.attachments = nil
+					return p, p.changed()
+				}
 			}
+		case teamsg.EditMessageMsg:
+			p.editing = msg.Index
+			p.textarea.Prompt = editMarker
+			p.textarea.SetValue(msg.Content)
+			return p, p.changed()
+		case teamsg.EditTitleMsg:
+			p.editingTitle = true
+			p.textarea.Prompt = titleMarker
+			p.textarea.SetValue(string(msg))
+			return p, p.changed()
+		case teamsg.QuoteMsg:
+			p.textarea.InsertString(string(msg))
+			return p, p.changed()
+		case teamsg.MCPPromptMsg:
+			p.textarea.SetValue(string(msg))
+			return p, p.changed()
+		case teamsg.AttachMsg:
+			p.attach(msg)
+			return p, p.changed()
 		}
 
+		value := p.textarea.Value()
 		vp, cmd := p.textarea.Update(msg)
 		p.textarea = vp
+		if p.textarea.Value() != value {
+			return p, tea.Batch(cmd, p.changed())
+		}
 		return p, cmd
 	}
 	return p, nil
 }
 
-func (p *Prompt) View() string {
-	if !p.hidden {
-		if p.focused {
-			return styles.ActiveStyle.Render(p.textarea.View())
+// attach adds a document to the prompt, replacing the one with the same
+// name.
+func (p *Prompt) attach(a teamsg.AttachMsg) {
+	for i, attached := range p.attachments {
+		if attached.Name == a.Name {
+			p.attachments[i] = a
+			return
+		}
+	}
+	p.attachments = append(p.attachments, a)
+}
+
+// content is the prompt followed by the attached documents.
+func (p *Prompt) content() string {
+	var sb strings.Builder
+	sb.WriteString(p.textarea.Value())
+	for _, a := range p.attachments {
+		fmt.Fprintf(&sb, "\n\n<resource uri=%q>\n%s\n</resource>", a.Name, strings.TrimRight(a.Content, "\n"))
+	}
+	return sb.String()
+}
+
+// changed asks for the tokens of the prompt to be counted. A title is not
+// sent to the model, it isn't counted.
+func (p *Prompt) changed() tea.Cmd {
+	changed := teamsg.PromptChangedMsg{Text: p.content(), Index: p.editing}
+	if p.editingTitle {
+		changed.Text = ""
+	}
+	return func() tea.Msg { return changed }
+}
+
+// countView tells the tokens of the prompt and the size of the context it
+// would be sent with.
+func (p *Prompt) countView() string {
+	if p.count.Text == "" || p.count.Text != p.content() {
+		return ""
+	}
+	unit := "tokens"
+	if p.count.Tokens == 1 {
+		unit = "token"
+	}
+	context := tokens.Format(p.count.Context) + "/" + tokens.Format(p.count.Window)
+	// narrow panes get the shorter forms
+	var view string
+	for _, view = range []string{
+		fmt.Sprintf("%d %s · context %s", p.count.Tokens, unit, context),
+		fmt.Sprintf("%d %s · %s", p.count.Tokens, unit, context),
+		fmt.Sprintf("%d · %s", p.count.Tokens, context),
+	} {
+		if lipgloss.Width(view) <= p.width {
+			break
 		}
-		return styles.InactiveStyle.Render(p.textarea.View())
 	}
-	return ""
+	view = truncate(view, max(p.width, 1))
+	if p.count.Warn {
+		return styles.WarningStyle.Render(view)
+	}
+	return styles.NoteStyle.Render(view)
+}
+
+// footer lists the attachments, followed by the count.
+func (p *Prompt) footer() string {
+	if len(p.attachments) == 0 {
+		return p.countView()
+	}
+	names := make([]string, len(p.attachments))
+	for i, a := range p.attachments {
+		names[i] = a.Name
+	}
+	attached := styles.ToolStyle.Render(truncate("+ "+strings.Join(names, ", "), max(p.width, 1)))
+	if count := p.countView(); count != "" && lipgloss.Width(attached)+lipgloss.Width(count)+3 <= p.width {
+		return attached + " · " + count
+	}
+	return attached
+}
+
+func (p *Prompt) stopEditing() {
+	p.editing = -1
+	p.editingTitle = false
+	p.textarea.Prompt = promptMarker
+}
+
+func (p *Prompt) View() string {
+	if p.hidden {
+		return ""
+	}
+	view := p.textarea.View()
+	height := p.textarea.Height()
+	if p.showCount {
+		view += "\n" + p.footer()
+		height++
+	}
+	return styles.PaneStyle(p.focused, height).Render(view)
 }
 
 func (p *Prompt) Hide() {
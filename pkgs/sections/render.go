@@ -0,0 +1,181 @@
+package sections
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"teachat/pkgs/styles"
+	"teachat/pkgs/types"
+
+	"github.com/charmbracelet/glamour"
+	glamouransi "github.com/charmbracelet/glamour/ansi"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/wordwrap"
+	"github.com/muesli/termenv"
+)
+
+// message is a conversation entry as shown in the convo. The content is kept
+// unrendered so that it can be rendered again for another width.
+type message struct {
+	role    types.Role
+	content string
+	// toolCalls are the tools called in a reply, toolName is the tool that
+	// gave the result in content.
+	toolCalls []types.ToolCall
+	toolName  string
+	// suffix is shown after the content, like the error that ended a reply.
+	suffix string
+	// note is shown next to the label, like the position of the reply among
+	// its alternatives.
+	note string
+	// selected messages are marked for the message actions.
+	selected bool
+	// folded messages only show their first line.
+	folded bool
+	// highlights are the ranges of content matching the search, the one at
+	// currentMatch being the match jumped to. Highlighted messages are shown
+	// unformatted so that the ranges line up with the text.
+	highlights   [][2]int
+	currentMatch int
+	// excluded messages are not sent to the model and are shown unformatted
+	// in the note color.
+	excluded bool
+
+	width    int
+	rendered string
+}
+
+// newMessage shows a message of the conversation. Tool results are folded,
+// they are mostly read by the model.
+func newMessage(m types.Message) *message {
+	return &message{role: m.Role, content: m.Content, toolCalls: m.ToolCalls, toolName: m.Name, folded: m.Role == types.ToolRole}
+}
+
+// render returns the message rendered for width, reusing the previous
+// rendering when the width and content didn't change.
+func (m *message) render(md *markdown, width int) string {
+	if m.rendered != "" && m.width == width {
+		return m.rendered
+	}
+	var label, body string
+	switch m.role {
+	case types.UserRole:
+		label = styles.SenderStyle.Render("You:")
+	case types.SystemRole:
+		label = styles.NoteStyle.Render("System:")
+	case types.ToolRole:
+		label = styles.ToolStyle.Render(fmt.Sprintf("Tool %s:", m.toolName))
+	default:
+		label = styles.AiStyle.Render("AI:")
+	}
+	switch {
+	case len(m.highlights) > 0:
+		body = wordwrap.String(highlight(m.content, m.highlights, m.currentMatch), width)
+	case m.folded:
+		body = m.summary(width)
+	case m.excluded:
+		body = styles.NoteStyle.Render(wordwrap.String(m.content, width))
+	case m.role != types.AssistantRole:
+		body = wordwrap.String(m.content, width)
+	case len(m.toolCalls) > 0:
+		body = styles.ToolStyle.Render(wordwrap.String(m.calls(), width))
+		if strings.TrimSpace(m.content) != "" {
+			body = md.render(m.content, width) + "\n" + body
+		}
+	default:
+		body = md.render(m.content, width)
+	}
+	if m.selected {
+		label = styles.SelectedStyle.Render("▶") + " " + label
+	}
+	if m.note != "" {
+		label += " " + styles.NoteStyle.Render("("+m.note+")")
+	}
+	m.rendered = "\n" + label + "\n" + body
+	if m.suffix != "" {
+		m.rendered += "\n" + wordwrap.String(m.suffix, width)
+	}
+	m.width = width
+	return m.rendered
+}
+
+// calls lists the tools called, with their arguments.
+func (m *message) calls() string {
+	lines := make([]string, len(m.toolCalls))
+	for i, call := range m.toolCalls {
+		lines[i] = fmt.Sprintf("→ %s %s", call.Name, call.Arguments)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// summary is the first line of the content cut to width, followed by the
+// number of lines.
+func (m *message) summary(width int) string {
+	content := strings.TrimSpace(m.content)
+	if len(m.toolCalls) > 0 {
+		content = strings.TrimSpace(content + "\n" + m.calls())
+	}
+	first, _, _ := strings.Cut(content, "\n")
+	count := " (1 line)"
+	if n := strings.Count(content, "\n") + 1; n > 1 {
+		count = fmt.Sprintf(" (%d lines)", n)
+	}
+	if limit := width - lipgloss.Width(count); lipgloss.Width(first) > limit {
+		first = string([]rune(first)[:max(limit-3, 0)]) + "..."
+	}
+	return first + styles.NoteStyle.Render(count)
+}
+
+// lines returns the height of the message rendered for width.
+func (m *message) lines(md *markdown, width int) int {
+	return strings.Count(m.render(md, width), "\n")
+}
+
+// invalidate drops the cached rendering after the content changed.
+func (m *message) invalidate() {
+	m.rendered = ""
+}
+
+// markdown renders assistant replies, the renderer is created again when
+// the width changes.
+type markdown struct {
+	width    int
+	renderer *glamour.TermRenderer
+}
+
+func (md *markdown) render(text string, width int) string {
+	if md.renderer == nil || md.width != width {
+		renderer, err := glamour.NewTermRenderer(
+			glamour.WithStyles(markdownStyle()),
+			glamour.WithWordWrap(width),
+		)
+		if err != nil {
+			slog.Error("creating markdown renderer", "error", err)
+			return wordwrap.String(text, width)
+		}
+		md.renderer = renderer
+		md.width = width
+	}
+	out, err := md.renderer.Render(text)
+	if err != nil {
+		return wordwrap.String(text, width)
+	}
+	return strings.Trim(out, "\n")
+}
+
+// markdownStyle is the standard glamour style matching the terminal, without
+// the document margins since the convo has its own layout.
+func markdownStyle() glamouransi.StyleConfig {
+	style := glamour.DarkStyleConfig
+	switch {
+	case lipgloss.ColorProfile() == termenv.Ascii:
+		style = glamour.NoTTYStyleConfig
+	case !lipgloss.HasDarkBackground():
+		style = glamour.LightStyleConfig
+	}
+	var margin uint
+	style.Document.Margin = &margin
+	style.Document.BlockPrefix = ""
+	style.Document.BlockSuffix = ""
+	return style
+}
@@ -0,0 +1,130 @@
+package sections
+
+import (
+	"strings"
+
+	keybinding "github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// scroller shows a window of lines and scrolls like viewport.Model, but
+// takes its lines in two parts: head, the lines of the finished messages
+// split once and kept between frames, and tail, the lines of the last
+// message. viewport.SetContent splits the whole transcript again on every
+// frame of a streamed reply, the scroller only splits the reply.
+type scroller struct {
+	Width, Height int
+	YOffset       int
+	KeyMap        viewport.KeyMap
+	// MouseWheelDelta is the number of lines scrolled by the mouse wheel.
+	MouseWheelDelta int
+
+	head, tail []string
+}
+
+func newScroller() scroller {
+	return scroller{KeyMap: viewport.DefaultKeyMap(), MouseWheelDelta: 3}
+}
+
+// splitLines splits rendered text in lines, the way viewport.SetContent
+// does.
+func splitLines(s string) []string {
+	return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+}
+
+// SetContent shows s.
+func (s *scroller) SetContent(content string) {
+	s.SetLines(nil, splitLines(content))
+}
+
+// SetLines shows head followed by tail. head is kept, not copied, so it
+// must not be changed afterwards.
+func (s *scroller) SetLines(head, tail []string) {
+	s.head, s.tail = head, tail
+	if s.YOffset > s.TotalLineCount()-1 {
+		s.GotoBottom()
+	}
+}
+
+// TotalLineCount returns the number of lines, shown or not.
+func (s scroller) TotalLineCount() int {
+	return len(s.head) + len(s.tail)
+}
+
+func (s scroller) maxYOffset() int {
+	return max(0, s.TotalLineCount()-s.Height)
+}
+
+// SetYOffset scrolls to line n, keeping the view filled.
+func (s *scroller) SetYOffset(n int) {
+	s.YOffset = min(max(n, 0), s.maxYOffset())
+}
+
+func (s scroller) AtBottom() bool {
+	return s.YOffset >= s.maxYOffset()
+}
+
+func (s *scroller) GotoBottom() {
+	s.SetYOffset(s.maxYOffset())
+}
+
+func (s scroller) visibleLines() []string {
+	top := max(0, s.YOffset)
+	bottom := min(s.YOffset+s.Height, s.TotalLineCount())
+	if bottom <= top {
+		return nil
+	}
+	lines := make([]string, 0, bottom-top)
+	for i := top; i < bottom; i++ {
+		if i < len(s.head) {
+			lines = append(lines, s.head[i])
+		} else {
+			lines = append(lines, s.tail[i-len(s.head)])
+		}
+	}
+	return lines
+}
+
+func (s scroller) Update(msg tea.Msg) (scroller, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case keybinding.Matches(msg, s.KeyMap.PageDown):
+			s.SetYOffset(s.YOffset + s.Height)
+		case keybinding.Matches(msg, s.KeyMap.PageUp):
+			s.SetYOffset(s.YOffset - s.Height)
+		case keybinding.Matches(msg, s.KeyMap.HalfPageDown):
+			s.SetYOffset(s.YOffset + s.Height/2)
+		case keybinding.Matches(msg, s.KeyMap.HalfPageUp):
+			s.SetYOffset(s.YOffset - s.Height/2)
+		case keybinding.Matches(msg, s.KeyMap.Down):
+			s.SetYOffset(s.YOffset + 1)
+		case keybinding.Matches(msg, s.KeyMap.Up):
+			s.SetYOffset(s.YOffset - 1)
+		}
+	case tea.MouseMsg:
+		if msg.Action != tea.MouseActionPress {
+			break
+		}
+		switch msg.Button {
+		case tea.MouseButtonWheelUp:
+			s.SetYOffset(s.YOffset - s.MouseWheelDelta)
+		case tea.MouseButtonWheelDown:
+			s.SetYOffset(s.YOffset + s.MouseWheelDelta)
+		}
+	}
+	return s, nil
+}
+
+// View renders the visible lines, padded or cut to the size of the
+// scroller.
+func (s scroller) View() string {
+	return lipgloss.NewStyle().
+		Width(s.Width).
+		Height(s.Height).
+		MaxHeight(s.Height).
+		MaxWidth(s.Width).
+		Render(strings.Join(s.visibleLines(), "\n"))
+}
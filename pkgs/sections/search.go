@@ -0,0 +1,136 @@
+package sections
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"teachat/pkgs/styles"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// search finds text in the messages of the convo. It matches the content of
+// the messages, not their rendering, so markdown and styling don't get in
+// the way.
+type search struct {
+	input textinput.Model
+	// typing is set while the query is being typed.
+	typing     bool
+	regex      bool
+	ignoreCase bool
+
+	matches []match
+	// current is the index of the match jumped to with n and N.
+	current int
+	// err is set when the query is not a valid regular expression.
+	err error
+}
+
+// match is a range of bytes in the content of a message.
+type match struct {
+	message    int
+	start, end int
+}
+
+func newSearch() search {
+	input := textinput.New()
+	input.Prompt = "/"
+	input.Placeholder = "search"
+	return search{input: input}
+}
+
+func (s *search) query() string {
+	return s.input.Value()
+}
+
+// shown reports whether the search bar is displayed.
+func (s *search) shown() bool {
+	return s.typing || s.query() != ""
+}
+
+func (s *search) compile() (*regexp.Regexp, error) {
+	expr := s.query()
+	if !s.regex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if s.ignoreCase {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// find lists the matches of the query in messages. Empty matches, which a
+// regular expression like a* has everywhere, are left out.
+func (s *search) find(messages []*message) {
+	s.matches = nil
+	s.err = nil
+	if s.query() == "" {
+		return
+	}
+	re, err := s.compile()
+	if err != nil {
+		s.err = err
+		return
+	}
+	for i, m := range messages {
+		for _, loc := range re.FindAllStringIndex(m.content, -1) {
+			if loc[1] > loc[0] {
+				s.matches = append(s.matches, match{message: i, start: loc[0], end: loc[1]})
+			}
+		}
+	}
+	s.current = min(s.current, max(len(s.matches)-1, 0))
+}
+
+// view renders the search bar, the query on the left and the match counter
+// and modes on the right.
+func (s *search) view(width int) string {
+	var status []string
+	switch {
+	case s.err != nil:
+		status = append(status, styles.ErrorStyle.Render("invalid regex"))
+	case s.query() == "":
+	case len(s.matches) == 0:
+		status = append(status, styles.ErrorStyle.Render("no matches"))
+	default:
+		status = append(status, fmt.Sprintf("%d/%d", s.current+1, len(s.matches)))
+	}
+	if s.regex {
+		status = append(status, styles.NoteStyle.Render("regex"))
+	}
+	if s.ignoreCase {
+		status = append(status, styles.NoteStyle.Render("ignore case"))
+	}
+	left := s.input.View()
+	right := strings.Join(status, " ")
+	gap := max(width-lipgloss.Width(left)-lipgloss.Width(right), 1)
+	return left + strings.Repeat(" ", gap) + right
+}
+
+// highlight styles the given ranges of content, the one at current standing
+// out. Ranges are styled line by line so that a match spanning lines doesn't
+// get padded into a block.
+func highlight(content string, ranges [][2]int, current int) string {
+	var b strings.Builder
+	last := 0
+	for i, r := range ranges {
+		if r[0] < last || r[1] > len(content) {
+			// stale range, the content changed since the search
+			continue
+		}
+		b.WriteString(content[last:r[0]])
+		style := styles.MatchStyle
+		if i == current {
+			style = styles.CurrentMatchStyle
+		}
+		lines := strings.Split(content[r[0]:r[1]], "\n")
+		for j, line := range lines {
+			lines[j] = style.Render(line)
+		}
+		b.WriteString(strings.Join(lines, "\n"))
+		last = r[1]
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
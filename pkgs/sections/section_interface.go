@@ -1,6 +1,8 @@
 package sections
 
 import (
+	"teachat/pkgs/teamsg"
+
 	tea "github.com/charmbracelet/bubbletea"
 )
 
@@ -17,6 +19,20 @@ type Section interface {
 	GetSectionName() SectionName
 }
 
+// Background reports whether msg carries the result of work started by a
+// section, like a streamed reply, the output of a command or the results of
+// tools. Nothing else waits on such work, so the message must reach the
+// section even while its page is not shown.
+func Background(msg tea.Msg) bool {
+	switch msg.(type) {
+	case teamsg.ChatStreamMsg, teamsg.ChatStreamDeltaMsg, frameMsg,
+		teamsg.ToolResultsMsg, commandOutputMsg,
+		teamsg.SummaryMsg, teamsg.TitleSuggestedMsg, countsWarmedMsg:
+		return true
+	}
+	return false
+}
+
 type SectionName string
 
 const (
@@ -24,4 +40,15 @@ const (
 	PromptSection    SectionName = "prompt"
 	ConvoSection     SectionName = "convo"
 	ModelListSection SectionName = "modellist"
+	TreeSection      SectionName = "tree"
+	// HistorySearchSection searches the saved conversations.
+	HistorySearchSection SectionName = "historysearch"
+	// ApprovalSection asks the user about a tool call.
+	ApprovalSection SectionName = "approval"
+	// MCPServersSection shows the status of the MCP servers.
+	MCPServersSection SectionName = "mcpservers"
+	// CommandSection confirms a shell command proposed by the model.
+	CommandSection SectionName = "command"
+	// EditsSection previews and applies the edits proposed by the model.
+	EditsSection SectionName = "edits"
 )
@@ -0,0 +1,114 @@
+package sections
+
+import (
+	"context"
+	"strings"
+	"teachat/pkgs/permissions"
+	"teachat/pkgs/shell"
+	"teachat/pkgs/teamsg"
+	"teachat/pkgs/types"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// runningCommand is a shell command confirmed by the user, its output being
+// shown in the last message as it comes.
+type runningCommand struct {
+	command    string
+	sendOutput bool
+	events     <-chan shell.Event
+	output     strings.Builder
+}
+
+// commandOutputMsg carries the output of the running command.
+type commandOutputMsg struct {
+	events <-chan shell.Event
+	batch  []shell.Event
+}
+
+func receiveCommandOutput(events <-chan shell.Event) tea.Cmd {
+	return func() tea.Msg {
+		return commandOutputMsg{events: events, batch: shell.Next(events)}
+	}
+}
+
+// outgoing is a message as sent to the model. Prompts asking for a shell
+// command are sent with the instruction to propose one.
+func outgoing(m types.Message) types.Message {
+	if m.Role == types.UserRole && shell.IsRequest(m.Content) {
+		m.Content = shell.Prompt(m.Content)
+	}
+	return m
+}
+
+// proposeCommand offers the command proposed in the last reply, when it
+// answers a prompt asking for one.
+func (c *Convo) proposeCommand() tea.Cmd {
+	n := len(c.conversation.Messages)
+	if n < 2 || c.conversation.Messages[n-2].Role != types.UserRole || !shell.IsRequest(c.conversation.Messages[n-2].Content) {
+		return nil
+	}
+	proposal, ok := shell.Parse(c.conversation.Messages[n-1].Content)
+	if !ok {
+		return nil
+	}
+	proposed := teamsg.CommandProposedMsg{Command: proposal.Command, Explanation: proposal.Explanation}
+	return func() tea.Msg { return proposed }
+}
+
+// runCommand runs the command confirmed by the user, in the background,
+// recording it in the audit log of the tools.
+func (c *Convo) runCommand(msg teamsg.RunCommandMsg) tea.Cmd {
+	if c.cancel != nil || c.chatClient == nil {
+		return nil
+	}
+	c.policy.Record(
+		permissions.Request{Tool: "shell", Command: msg.Command},
+		permissions.Verdict{Decision: permissions.Allow, Reason: "confirmed by the user"},
+	)
+	var ctx context.Context
+	ctx, c.cancel = context.WithCancel(context.Background())
+	run := &runningCommand{command: msg.Command, sendOutput: msg.SendOutput}
+	run.events = shell.Run(ctx, msg.Command, c.config.ShellTimeout())
+	c.command = run
+	c.push(&message{role: types.UserRole, content: shell.Transcript(msg.Command, "", nil)})
+	return receiveCommandOutput(run.events)
+}
+
+// commandOutput shows the output of the running command. Once it is done,
+// the transcript is added to the conversation and sent to the model, or
+// excluded from the context when it is only for the user.
+func (c *Convo) commandOutput(msg commandOutputMsg) tea.Cmd {
+	run := c.command
+	if run == nil || msg.events != run.events {
+		// left over from a cancelled command
+		return nil
+	}
+	var done *shell.Event
+	for _, ev := range msg.batch {
+		run.output.WriteString(ev.Output)
+		if ev.Done {
+			done = &ev
+		}
+	}
+	last := c.messages[len(c.messages)-1]
+	last.content = shell.Transcript(run.command, run.output.String(), done)
+	last.invalidate()
+	c.setContent()
+	c.viewport.GotoBottom()
+	if done == nil {
+		return receiveCommandOutput(run.events)
+	}
+	c.stop()
+	c.conversation.Append(types.Message{Role: types.UserRole, Content: last.content})
+	index := len(c.conversation.Messages) - 1
+	if !run.sendOutput {
+		c.conversation.PathNode(index).Excluded = true
+		c.refresh(index)
+		c.save()
+		return c.usage()
+	}
+	c.save()
+	c.push(&message{role: types.AssistantRole})
+	return c.send(index)
+}
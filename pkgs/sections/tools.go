@@ -0,0 +1,185 @@
+package sections
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"teachat/pkgs/config"
+	"teachat/pkgs/permissions"
+	"teachat/pkgs/styles"
+	"teachat/pkgs/teamsg"
+	"teachat/pkgs/tools"
+	"teachat/pkgs/types"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// newToolRegistry registers the built-in tools enabled in cfg, their paths
+// being relative to the working directory.
+func newToolRegistry(cfg config.Config) *tools.Registry {
+	var enabled []tools.Tool
+	for _, t := range tools.Builtins(".") {
+		if cfg.ToolEnabled(t.Name) {
+			enabled = append(enabled, t)
+		}
+	}
+	registry, err := tools.NewRegistry(enabled...)
+	if err != nil {
+		slog.Error("registering tools", "error", err)
+		registry, _ = tools.NewRegistry()
+	}
+	return registry
+}
+
+// offerTools gives the tools of the registry to the model, when it calls
+// tools.
+func (c *Convo) offerTools() {
+	if c.chatClient != nil && supportsTools(c.conversation.Model) {
+		c.chatClient.SetTools(c.tools.Specs())
+	}
+}
+
+// setMCPTools replaces the tools of the MCP servers in the registry by
+// the enabled ones of available.
+func (c *Convo) setMCPTools(available []tools.Tool) {
+	for _, name := range c.mcpTools {
+		c.tools.Unregister(name)
+	}
+	c.mcpTools = nil
+	for _, t := range available {
+		if !c.config.ToolEnabled(t.Name) {
+			continue
+		}
+		if err := c.tools.Register(t); err != nil {
+			slog.Warn("registering an MCP tool", "error", err)
+			continue
+		}
+		c.mcpTools = append(c.mcpTools, t.Name)
+	}
+	c.offerTools()
+}
+
+// supportsTools reports whether model, as currently supported, calls tools.
+func supportsTools(model types.Model) bool {
+	if supported, ok := types.FindModel(model.Name); ok {
+		return supported.Tools
+	}
+	return model.Tools
+}
+
+// pendingCall is a tool call of the last reply and the decision about it.
+type pendingCall struct {
+	call    types.ToolCall
+	request permissions.Request
+	verdict permissions.Verdict
+}
+
+// request describes call to the policy.
+func (c *Convo) request(call types.ToolCall) permissions.Request {
+	r := permissions.Request{Tool: call.Name, Arguments: call.Arguments}
+	t, ok := c.tools.Get(call.Name)
+	if !ok {
+		return r
+	}
+	arguments := json.RawMessage(call.Arguments)
+	if !json.Valid(arguments) {
+		arguments = json.RawMessage("{}")
+	}
+	r.ReadOnly = t.ReadOnly
+	if t.Paths != nil {
+		r.Paths = t.Paths(arguments)
+	}
+	if t.Command != nil {
+		r.Command = t.Command(arguments)
+	}
+	return r
+}
+
+// runTools runs the tools called in the last reply, in the background, once
+// the policy or the user allowed them. The results are sent back to the
+// model once all are in, unless the model already called tools too many
+// times in a row.
+func (c *Convo) runTools(calls []types.ToolCall) tea.Cmd {
+	if c.toolRounds >= c.config.ToolRounds() {
+		reply := c.messages[len(c.messages)-1]
+		reply.suffix = styles.ErrorStyle.Render(fmt.Sprintf("stopped after %d rounds of tool calls", c.toolRounds))
+		reply.invalidate()
+		c.setContent()
+		c.toolRounds = 0
+		return nil
+	}
+	c.toolRounds++
+	c.toolRun++
+	c.toolCtx, c.cancel = context.WithCancel(context.Background())
+	c.pending = make([]pendingCall, len(calls))
+	for i, call := range calls {
+		r := c.request(call)
+		c.pending[i] = pendingCall{call: call, request: r, verdict: c.policy.Check(r)}
+	}
+	return c.nextApproval()
+}
+
+// nextApproval asks the user about the first call the policy couldn't
+// decide on, or runs the calls when all are decided.
+func (c *Convo) nextApproval() tea.Cmd {
+	for i, p := range c.pending {
+		if p.verdict.Decision == permissions.Ask {
+			approval := teamsg.ToolApprovalMsg{Run: c.toolRun, Index: i, Call: p.call, Reason: p.verdict.Reason}
+			return func() tea.Msg { return approval }
+		}
+	}
+	return c.execute()
+}
+
+// approve applies the answer of the user about the call at index.
+func (c *Convo) approve(index int, answer permissions.Answer) tea.Cmd {
+	p := &c.pending[index]
+	p.verdict = c.policy.Answer(p.request, answer)
+	next := c.nextApproval()
+	if answer != permissions.AllowAlways {
+		return next
+	}
+	policy, request := c.policy, p.request
+	return tea.Batch(func() tea.Msg {
+		if err := policy.Save(request); err != nil {
+			slog.Error("saving the tool permission", "error", err)
+		}
+		return nil
+	}, next)
+}
+
+// execute runs the allowed calls and records every decision in the audit
+// log. Denied calls are answered with the reason, the model may go on
+// without them.
+func (c *Convo) execute() tea.Cmd {
+	ctx, pending, run, registry, policy := c.toolCtx, c.pending, c.toolRun, c.tools, c.policy
+	c.pending = nil
+	return func() tea.Msg {
+		results := make([]types.Message, len(pending))
+		for i, p := range pending {
+			policy.Record(p.request, p.verdict)
+			if p.verdict.Decision != permissions.Allow {
+				results[i] = types.Message{Role: types.ToolRole, ToolCallID: p.call.ID, Name: p.call.Name, Content: "error: not allowed, " + p.verdict.Reason}
+				continue
+			}
+			slog.Debug("running tool", "name", p.call.Name, "arguments", p.call.Arguments)
+			results[i] = registry.Run(ctx, p.call)
+		}
+		return teamsg.ToolResultsMsg{Run: run, Results: results}
+	}
+}
+
+// addToolResults adds the results of the tool calls to the conversation,
+// folded, and asks the model to go on.
+func (c *Convo) addToolResults(results []types.Message) tea.Cmd {
+	c.stop()
+	messages := make([]*message, 0, len(results)+1)
+	for _, r := range results {
+		c.conversation.Append(r)
+		messages = append(messages, newMessage(r))
+	}
+	c.save()
+	c.push(append(messages, &message{role: types.AssistantRole})...)
+	return c.goOn(c.plan(len(c.conversation.Messages), ""))
+}
@@ -0,0 +1,173 @@
+package sections
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"teachat/pkgs/history"
+	"teachat/pkgs/styles"
+	"teachat/pkgs/teamsg"
+	"teachat/pkgs/types"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Tree shows every branch of a conversation and switches the active one.
+type Tree struct {
+	hidden  bool
+	focused bool
+	list    list.Model
+}
+
+// treeItem is a message of the tree, indented once per fork above it.
+type treeItem struct {
+	id     int
+	depth  int
+	active bool
+	role   types.Role
+	text   string
+}
+
+func (i treeItem) FilterValue() string { return i.text }
+
+var (
+	treeItemStyle     = lipgloss.NewStyle().PaddingLeft(4)
+	treeSelectedStyle = lipgloss.NewStyle().PaddingLeft(2).Foreground(lipgloss.Color("170"))
+)
+
+type treeDelegate struct{}
+
+func (d treeDelegate) Height() int                             { return 1 }
+func (d treeDelegate) Spacing() int                            { return 0 }
+func (d treeDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+func (d treeDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	i, ok := listItem.(treeItem)
+	if !ok {
+		return
+	}
+	marker := "○"
+	if i.active {
+		marker = "●"
+	}
+	who := "AI"
+	if i.role == types.UserRole {
+		who = "You"
+	}
+	line := fmt.Sprintf("%s%s %s: %s", strings.Repeat("  ", i.depth), marker, who, i.text)
+	if width := m.Width() - 6; width > 0 && lipgloss.Width(line) > width {
+		line = string([]rune(line)[:max(width-3, 0)]) + "..."
+	}
+	if index == m.Index() {
+		fmt.Fprint(w, treeSelectedStyle.Render("| "+line))
+		return
+	}
+	fmt.Fprint(w, treeItemStyle.Render(line))
+}
+
+func NewTree() Section {
+	l := list.New([]list.Item{}, treeDelegate{}, 0, 0)
+	l.Title = "Conversation tree"
+	l.SetShowStatusBar(false)
+	l.SetFilteringEnabled(false)
+	return &Tree{list: l}
+}
+
+// treeItems lists the nodes depth first, selecting the leaf of the active
+// branch.
+func treeItems(c history.Conversation) ([]list.Item, int) {
+	onPath := make(map[int]bool)
+	for _, id := range c.Path() {
+		onPath[id] = true
+	}
+	var items []list.Item
+	selected := 0
+	var walk func(parent, depth int)
+	walk = func(parent, depth int) {
+		children := c.Children(parent)
+		if len(children) > 1 {
+			depth++
+		}
+		for _, id := range children {
+			node := c.Node(id)
+			text, _, _ := strings.Cut(strings.TrimSpace(node.Message.Content), "\n")
+			if id == c.Leaf {
+				selected = len(items)
+			}
+			items = append(items, treeItem{id: id, depth: depth, active: onPath[id], role: node.Message.Role, text: text})
+			walk(id, depth)
+		}
+	}
+	walk(0, 0)
+	return items, selected
+}
+
+func (s *Tree) GetSectionName() SectionName {
+	return TreeSection
+}
+
+func (s *Tree) SetDimensions(width, height int) {
+	s.list.SetWidth(width)
+	s.list.SetHeight(height)
+}
+
+func (s *Tree) IsHidden() bool {
+	return s.hidden
+}
+
+func (s *Tree) IsFocused() bool {
+	return s.focused
+}
+
+func (s *Tree) Update(msg tea.Msg) (Section, tea.Cmd) {
+	if !s.focused {
+		return s, nil
+	}
+	switch msg := msg.(type) {
+	case teamsg.ConversationTreeMsg:
+		items, selected := treeItems(history.Conversation(msg))
+		cmd := s.list.SetItems(items)
+		s.list.Select(selected)
+		return s, cmd
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyEnter {
+			item, ok := s.list.SelectedItem().(treeItem)
+			if !ok {
+				return s, nil
+			}
+			return s, func() tea.Msg { return teamsg.BranchSelectedMsg(item.id) }
+		}
+		l, cmd := s.list.Update(msg)
+		s.list = l
+		return s, cmd
+	}
+	return s, nil
+}
+
+func (s *Tree) View() string {
+	if !s.hidden {
+		if s.focused {
+			return styles.ActiveStyle.Render(s.list.View())
+		}
+		return styles.InactiveStyle.Render(s.list.View())
+	}
+	return ""
+}
+
+func (s *Tree) Hide() {
+	s.hidden = true
+}
+
+func (s *Tree) Show() {
+	s.hidden = false
+}
+
+func (s *Tree) Focus() {
+	s.Show()
+	s.focused = true
+}
+
+func (s *Tree) Blur() {
+	s.focused = false
+}
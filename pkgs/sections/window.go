@@ -0,0 +1,199 @@
+package sections
+
+import (
+	"context"
+	"log/slog"
+	"teachat/pkgs/teamsg"
+	"teachat/pkgs/tokens"
+	"teachat/pkgs/types"
+	"teachat/pkgs/window"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// summaryTimeout bounds the background request summarizing the oldest
+// messages.
+const summaryTimeout = time.Minute
+
+// model returns the model of the conversation as currently supported, older
+// conversations don't have its context window.
+func (c *Convo) model() types.Model {
+	if model, ok := types.FindModel(c.conversation.Model.Name); ok {
+		return model
+	}
+	return c.conversation.Model
+}
+
+func (c *Convo) strategy() window.Strategy {
+	return window.Strategy(c.config.ContextStrategy())
+}
+
+// systemTokens estimates the tokens of the system prompt of the
+// conversation.
+func (c *Convo) systemTokens() int {
+	system, _ := c.config.SystemPrompt(c.conversation.Persona)
+	if system == "" {
+		return 0
+	}
+	return tokens.Message(c.estimate(), types.Message{Role: types.SystemRole, Content: system})
+}
+
+// plan fits the messages before end in the context window, leaving room
+// for the system prompt, the prompt and the reply. With the summary
+// strategy, the messages covered by the summary are replaced with it.
+func (c *Convo) plan(end int, prompt string) window.Plan {
+	path := c.conversation.Path()[:end]
+	summarized := -1
+	var entries []window.Entry
+	if s := c.conversation.Summary; s != nil && c.strategy() == window.Summary {
+		for i, id := range path {
+			if id == s.Through {
+				summarized = i
+				entries = append(entries, window.Entry{Message: window.SummaryMessage(s.Text), Pinned: true})
+			}
+		}
+	}
+	for i, id := range path {
+		node := c.conversation.Node(id)
+		if node.Excluded || i <= summarized && !node.Pinned {
+			continue
+		}
+		entries = append(entries, window.Entry{ID: id, Message: outgoing(node.Message), Pinned: node.Pinned})
+	}
+	budget := c.config.ContextWindow(c.model()) - c.config.ContextReserve() - c.systemTokens()
+	if prompt != "" {
+		budget -= tokens.Message(c.estimate(), types.Message{Role: types.UserRole, Content: prompt})
+	}
+	return window.Fit(entries, budget, c.strategy(), c.estimate())
+}
+
+// estimate is the counter used from Update. A server counting the tokens is
+// only asked in the background, by warmCounts, the texts it hasn't counted
+// yet are estimated meanwhile.
+func (c *Convo) estimate() tokens.Counter {
+	if remote, ok := c.counter.(*tokens.Remote); ok {
+		return remote.Cached()
+	}
+	return c.counter
+}
+
+// countsWarmedMsg tells the server counted the texts estimated so far.
+type countsWarmedMsg struct{}
+
+// warmCounts asks the server to count the texts estimated so far.
+func (c *Convo) warmCounts() tea.Cmd {
+	remote, ok := c.counter.(*tokens.Remote)
+	if !ok {
+		return nil
+	}
+	return func() tea.Msg {
+		if remote.Warm() {
+			return countsWarmedMsg{}
+		}
+		return nil
+	}
+}
+
+// reportUsage tells how much of the context window the request of plan takes,
+// and has the counts estimated for it made by the server.
+func (c *Convo) reportUsage(plan window.Plan, prompt string) tea.Cmd {
+	usage := c.contextUsage(plan, prompt)
+	return tea.Batch(func() tea.Msg { return usage }, c.warmCounts())
+}
+
+// contextUsage is the context taken by the request of plan, with a warning
+// when it is close to the limit or beyond.
+func (c *Convo) contextUsage(plan window.Plan, prompt string) teamsg.ContextUsageMsg {
+	size := c.config.ContextWindow(c.model())
+	used := plan.Tokens + c.systemTokens()
+	if prompt != "" {
+		used += tokens.Message(c.estimate(), types.Message{Role: types.UserRole, Content: prompt})
+	}
+	return teamsg.ContextUsageMsg{
+		Tokens:     used,
+		Window:     size,
+		Dropped:    len(plan.Dropped),
+		Summarized: c.conversation.Summary != nil && c.strategy() == window.Summary,
+		Warn:       plan.Overflow || len(plan.Dropped) > 0 || float64(used) >= c.config.ContextWarnAt()*float64(size),
+	}
+}
+
+// promptTokens counts the tokens of the prompt being typed, and the size of
+// the request it would be sent with. The prompt is counted in the
+// background as the counter may ask the server. index is the message being
+// edited, or -1.
+func (c *Convo) promptTokens(prompt string, index int) tea.Cmd {
+	if prompt == "" {
+		return func() tea.Msg { return teamsg.PromptTokensMsg{} }
+	}
+	end := len(c.conversation.Messages)
+	if index >= 0 && index < end {
+		end = index
+	}
+	used := c.plan(end, "").Tokens + c.systemTokens()
+	size := c.config.ContextWindow(c.model())
+	limit := min(c.config.ContextWarnAt()*float64(size), float64(size-c.config.ContextReserve()))
+	counter := c.counter
+	return func() tea.Msg {
+		n := counter.Count(prompt)
+		total := used + tokens.Message(counter, types.Message{Role: types.UserRole, Content: prompt})
+		return teamsg.PromptTokensMsg{Text: prompt, Tokens: n, Context: total, Window: size, Warn: float64(total) >= limit}
+	}
+}
+
+// usage reports the context taken by the conversation as it stands, that is
+// before the next prompt.
+func (c *Convo) usage() tea.Cmd {
+	return c.reportUsage(c.plan(len(c.conversation.Messages), ""), "")
+}
+
+// summarize replaces the messages left out of plan with a summary, in the
+// background, when the strategy asks for it. The summary is used from the
+// next request on.
+func (c *Convo) summarize(plan window.Plan) tea.Cmd {
+	if c.strategy() != window.Summary || len(plan.Dropped) == 0 || c.summarizing {
+		return nil
+	}
+	client, err := c.utilityClient()
+	if err != nil {
+		slog.Warn("summarizing conversation", "error", err)
+		return nil
+	}
+	c.summarizing = true
+	stopped, cancel := context.WithCancel(context.Background())
+	c.stopSummary = cancel
+	var previous string
+	if c.conversation.Summary != nil {
+		previous = c.conversation.Summary.Text
+	}
+	messages := make([]types.Message, len(plan.Dropped))
+	for i, e := range plan.Dropped {
+		messages[i] = e.Message
+	}
+	id := c.conversation.ID
+	through := plan.Dropped[len(plan.Dropped)-1].ID
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(stopped, summaryTimeout)
+		defer cancel()
+		text, err := window.Summarize(ctx, client, previous, messages)
+		if stopped.Err() != nil {
+			// cancelled with the reply or the model, another may be running
+			return nil
+		}
+		if err != nil {
+			slog.Warn("summarizing conversation", "id", id, "error", err)
+			text = ""
+		}
+		return teamsg.SummaryMsg{ConversationID: id, Through: through, Text: text}
+	}
+}
+
+// cancelSummary stops the summary being made, if any.
+func (c *Convo) cancelSummary() {
+	if c.stopSummary != nil {
+		c.stopSummary()
+		c.stopSummary = nil
+	}
+	c.summarizing = false
+}
@@ -0,0 +1,318 @@
+// Package server exposes the configured providers through an OpenAI
+// compatible HTTP API, so that tools which only speak the OpenAI protocol can
+// use any model supported by teachat.
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"sort"
+	"time"
+
+	"teachat/pkgs/config"
+	"teachat/pkgs/llmclients"
+	"teachat/pkgs/llminterface"
+	"teachat/pkgs/types"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// DefaultAddr is used when no address is configured.
+const DefaultAddr = "127.0.0.1:8080"
+
+const shutdownTimeout = 10 * time.Second
+
+type Server struct {
+	config config.Config
+	logger *slog.Logger
+}
+
+// New creates a server routing requests according to cfg. Personas are not
+// applied, the system prompt is whatever the client sends. The aliases are
+// copied, each server keeps its own.
+func New(cfg config.Config, logger *slog.Logger) *Server {
+	cfg.Persona = ""
+	cfg.Serve.Aliases = maps.Clone(cfg.Serve.Aliases)
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Server{config: cfg, logger: logger}
+}
+
+// Handler returns the HTTP handler serving the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/models", s.listModels)
+	mux.HandleFunc("POST /v1/chat/completions", s.chatCompletions)
+	return s.logRequests(mux)
+}
+
+// ListenAndServe serves on addr until ctx is cancelled, then shuts down
+// gracefully, giving in-flight requests some time to complete.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: s.Handler()}
+	errc := make(chan error, 1)
+	go func() {
+		s.logger.Info("listening", "addr", addr)
+		errc <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	s.logger.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return err
+	}
+	return nil
+}
+
+// resolve maps a requested model name to a supported model, looking at the
+// configured aliases first.
+func (s *Server) resolve(name string) (types.Model, bool) {
+	if target, ok := s.config.Serve.Aliases[name]; ok {
+		name = string(target)
+	}
+	return types.FindModel(types.LLMModel(name))
+}
+
+func (s *Server) listModels(w http.ResponseWriter, r *http.Request) {
+	var models []openai.Model
+	for _, m := range types.SupportedModels {
+		models = append(models, openai.Model{ID: string(m.Name), Object: "model", OwnedBy: string(m.Platform)})
+	}
+	aliases := make([]string, 0, len(s.config.Serve.Aliases))
+	for alias := range s.config.Serve.Aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		if m, ok := s.resolve(alias); ok {
+			models = append(models, openai.Model{ID: alias, Object: "model", OwnedBy: string(m.Platform), Root: string(m.Name)})
+		}
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Object string         `json:"object"`
+		Data   []openai.Model `json:"data"`
+	}{Object: "list", Data: models})
+}
+
+func (s *Server) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("invalid request body: %s", err))
+		return
+	}
+	model, ok := s.resolve(req.Model)
+	if !ok {
+		writeError(w, http.StatusNotFound, "model_not_found", fmt.Sprintf("model %q does not exist", req.Model))
+		return
+	}
+	if len(req.Messages) == 0 || req.Messages[len(req.Messages)-1].Role != openai.ChatMessageRoleUser {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "the last message must have the user role")
+		return
+	}
+	s.logger.Info("chat completion", "model", req.Model, "resolved", model.Name, "platform", model.Platform, "stream", req.Stream)
+
+	client, err := llmclients.New(model, s.config, "")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	client.SetParameters(s.parameters(req, model))
+	history := make([]types.Message, len(req.Messages)-1)
+	for i, m := range req.Messages[:len(req.Messages)-1] {
+		history[i] = types.Message{Role: types.Role(m.Role), Content: m.Content}
+	}
+	client.SetMessages(history)
+
+	events, err := client.Stream(r.Context(), req.Messages[len(req.Messages)-1].Content)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "provider_error", err.Error())
+		return
+	}
+
+	c := completion{
+		id:      "chatcmpl-" + randomID(),
+		created: time.Now().Unix(),
+		model:   req.Model,
+		events:  events,
+	}
+	if req.Stream {
+		includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+		s.streamCompletion(w, r, c, includeUsage)
+		return
+	}
+	s.completeCompletion(w, r, c)
+}
+
+// parameters merges the sampling parameters of the request into the
+// configured defaults, with the context window of model.
+func (s *Server) parameters(req openai.ChatCompletionRequest, model types.Model) types.Parameters {
+	params := s.config.Parameters
+	params.ContextWindow = s.config.ContextWindow(model)
+	if req.Temperature != 0 {
+		params.Temperature = &req.Temperature
+	}
+	if req.TopP != 0 {
+		params.TopP = &req.TopP
+	}
+	if req.MaxTokens != 0 {
+		params.MaxTokens = req.MaxTokens
+	}
+	return params
+}
+
+type completion struct {
+	id      string
+	created int64
+	model   string
+	events  <-chan types.StreamEvent
+}
+
+func (s *Server) completeCompletion(w http.ResponseWriter, r *http.Request, c completion) {
+	content, usage, err := llminterface.Collect(r.Context(), c.events)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "provider_error", err.Error())
+		return
+	}
+	if usage == nil {
+		usage = &types.Usage{}
+	}
+	writeJSON(w, http.StatusOK, openai.ChatCompletionResponse{
+		ID:      c.id,
+		Object:  "chat.completion",
+		Created: c.created,
+		Model:   c.model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content},
+			FinishReason: openai.FinishReasonStop,
+		}},
+		Usage: openai.Usage{
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			TotalTokens:      usage.TotalTokens,
+		},
+	})
+}
+
+func (s *Server) streamCompletion(w http.ResponseWriter, r *http.Request, c completion, includeUsage bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "server_error", "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(data any) {
+		bts, _ := json.Marshal(data)
+		fmt.Fprintf(w, "data: %s\n\n", bts)
+		flusher.Flush()
+	}
+	chunk := func(delta openai.ChatCompletionStreamChoiceDelta, finish openai.FinishReason) openai.ChatCompletionStreamResponse {
+		return openai.ChatCompletionStreamResponse{
+			ID:      c.id,
+			Object:  "chat.completion.chunk",
+			Created: c.created,
+			Model:   c.model,
+			Choices: []openai.ChatCompletionStreamChoice{{Delta: delta, FinishReason: finish}},
+		}
+	}
+
+	send(chunk(openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant}, ""))
+	var usage *types.Usage
+	for ev := range c.events {
+		switch ev.Type {
+		case types.TextDelta:
+			send(chunk(openai.ChatCompletionStreamChoiceDelta{Content: ev.Text}, ""))
+		case types.UsageEvent:
+			usage = ev.Usage
+		case types.ErrorEvent:
+			s.logger.Error("streaming completion", "id", c.id, "error", ev.Err)
+			send(openai.ErrorResponse{Error: &openai.APIError{Type: "provider_error", Message: ev.Err.Error()}})
+			return
+		}
+	}
+	if r.Context().Err() != nil {
+		return
+	}
+	send(chunk(openai.ChatCompletionStreamChoiceDelta{}, openai.FinishReasonStop))
+	if includeUsage && usage != nil {
+		send(openai.ChatCompletionStreamResponse{
+			ID:      c.id,
+			Object:  "chat.completion.chunk",
+			Created: c.created,
+			Model:   c.model,
+			Choices: []openai.ChatCompletionStreamChoice{},
+			Usage: &openai.Usage{
+				PromptTokens:     usage.PromptTokens,
+				CompletionTokens: usage.CompletionTokens,
+				TotalTokens:      usage.TotalTokens,
+			},
+		})
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+// statusRecorder captures the response status for request logging while
+// still allowing handlers to flush.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		s.logger.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration", time.Since(start),
+			"remote", r.RemoteAddr,
+		)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, openai.ErrorResponse{Error: &openai.APIError{Type: errType, Message: message}})
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"teachat/pkgs/config"
+	"teachat/pkgs/mock"
+	"teachat/pkgs/types"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func newTestServer(t *testing.T) *openai.Client {
+	t.Helper()
+	mock.Register()
+	cfg := config.Config{Serve: config.Serve{Aliases: map[string]types.LLMModel{"fast": mock.Name}}}
+	ts := httptest.NewServer(New(cfg, nil).Handler())
+	t.Cleanup(ts.Close)
+	clientConfig := openai.DefaultConfig("unused")
+	clientConfig.BaseURL = ts.URL + "/v1"
+	return openai.NewClientWithConfig(clientConfig)
+}
+
+func TestListModels(t *testing.T) {
+	client := newTestServer(t)
+	models, err := client.ListModels(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]string{}
+	for _, m := range models.Models {
+		ids[m.ID] = m.OwnedBy
+	}
+	if ids["mock"] != "mock" || ids["fast"] != "mock" {
+		t.Errorf("expected mock model and fast alias, got %v", ids)
+	}
+}
+
+func TestChatCompletion(t *testing.T) {
+	client := newTestServer(t)
+	resp, err := client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model: "fast",
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+			{Role: openai.ChatMessageRoleUser, Content: "hello there"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Choices[0].Message.Content; got != "You said: hello there" {
+		t.Errorf("unexpected content %q", got)
+	}
+	if resp.Model != "fast" {
+		t.Errorf("expected the requested model name to be echoed, got %q", resp.Model)
+	}
+	if resp.Usage.PromptTokens != 2 || resp.Usage.CompletionTokens != 4 {
+		t.Errorf("unexpected usage %+v", resp.Usage)
+	}
+}
+
+func TestChatCompletionStream(t *testing.T) {
+	client := newTestServer(t)
+	stream, err := client.CreateChatCompletionStream(context.Background(), openai.ChatCompletionRequest{
+		Model:         "mock",
+		Messages:      []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "stream this"}},
+		Stream:        true,
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	var chunks int
+	var usage *openai.Usage
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks++
+		if resp.Usage != nil {
+			usage = resp.Usage
+		}
+		if len(resp.Choices) > 0 {
+			content.WriteString(resp.Choices[0].Delta.Content)
+		}
+	}
+	if content.String() != "You said: stream this" {
+		t.Errorf("unexpected content %q", content.String())
+	}
+	// role chunk + 4 words + finish chunk + usage chunk
+	if chunks != 7 {
+		t.Errorf("expected 7 chunks, got %d", chunks)
+	}
+	if usage == nil || usage.TotalTokens != 6 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+}
+
+func TestChatCompletionErrors(t *testing.T) {
+	mock.Register()
+	ts := httptest.NewServer(New(config.Config{}, nil).Handler())
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"unknown model", `{"model":"nope","messages":[{"role":"user","content":"hi"}]}`, http.StatusNotFound},
+		{"no user message", `{"model":"mock","messages":[{"role":"system","content":"hi"}]}`, http.StatusBadRequest},
+		{"invalid body", `{`, http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Errorf("expected status %d, got %d", tc.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestOllamaContextWindow(t *testing.T) {
+	var numCtx any
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Options map[string]any `json:"options"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		numCtx = req.Options["num_ctx"]
+		io.WriteString(w, `{"model":"llama3","message":{"role":"assistant","content":"hi"},"done":true}`+"\n")
+	}))
+	defer ollama.Close()
+	t.Setenv("OLLAMA_HOST", ollama.URL)
+	cfg := config.Config{Context: config.Context{Windows: map[types.LLMModel]int{types.Llama3: 16384}}}
+	ts := httptest.NewServer(New(cfg, nil).Handler())
+	defer ts.Close()
+	clientConfig := openai.DefaultConfig("unused")
+	clientConfig.BaseURL = ts.URL + "/v1"
+	_, err := openai.NewClientWithConfig(clientConfig).CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:       string(types.Llama3),
+		Messages:    []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}},
+		Temperature: 0.5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numCtx != float64(16384) {
+		t.Errorf("expected the context window to be sent to Ollama, got %v", numCtx)
+	}
+}
+
+func TestAliasesPerRoute(t *testing.T) {
+	mock.Register()
+	aliases := map[string]types.LLMModel{"fast": mock.Name}
+	local := New(config.Config{Serve: config.Serve{Aliases: aliases}}, nil)
+	aliases["fast"] = types.Llama3
+	remote := New(config.Config{Serve: config.Serve{Aliases: aliases}}, nil)
+	mux := http.NewServeMux()
+	mux.Handle("/local/", http.StripPrefix("/local", local.Handler()))
+	mux.Handle("/remote/", http.StripPrefix("/remote", remote.Handler()))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	for route, want := range map[string]types.LLMModel{"local": mock.Name, "remote": types.Llama3} {
+		clientConfig := openai.DefaultConfig("unused")
+		clientConfig.BaseURL = ts.URL + "/" + route + "/v1"
+		models, err := openai.NewClientWithConfig(clientConfig).ListModels(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var root string
+		for _, m := range models.Models {
+			if m.ID == "fast" {
+				root = m.Root
+			}
+		}
+		if root != string(want) {
+			t.Errorf("expected fast to be %s on /%s, got %q", want, route, root)
+		}
+	}
+}
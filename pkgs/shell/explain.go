@@ -0,0 +1,51 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Environment is what a model is told of where a command ran.
+type Environment struct {
+	OS, Arch string
+	Shell    string
+	// GoVersion is the version of the go command, empty when it isn't
+	// installed.
+	GoVersion string
+	Dir       string
+}
+
+// CurrentEnvironment describes the environment of the process.
+func CurrentEnvironment(ctx context.Context) Environment {
+	env := Environment{OS: runtime.GOOS, Arch: runtime.GOARCH, Shell: Path()}
+	env.Dir, _ = os.Getwd()
+	if out, err := exec.CommandContext(ctx, "go", "env", "GOVERSION").Output(); err == nil {
+		env.GoVersion = strings.TrimSpace(string(out))
+	}
+	return env
+}
+
+// Question is asked about a command that failed, or about what the output
+// of one that didn't means.
+func Question(done Event) string {
+	if done.Err == nil && done.ExitCode == 0 {
+		return "The command succeeded, what does this output mean?"
+	}
+	return "Why did this fail and how do I fix it?"
+}
+
+// ExplainPrompt asks about the command in transcript, which ended with
+// done, run in env.
+func ExplainPrompt(transcript string, done Event, env Environment) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "I ran this command in %s, with %s on %s/%s", env.Dir, env.Shell, env.OS, env.Arch)
+	if env.GoVersion != "" {
+		fmt.Fprintf(&sb, " and %s", env.GoVersion)
+	}
+	sb.WriteString(":\n\n```\n" + transcript + "\n```\n\n" + Question(done))
+	return sb.String()
+}
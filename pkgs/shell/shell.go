@@ -0,0 +1,216 @@
+// Package shell asks the models for shell commands and runs them. A prompt
+// starting with Prefix is sent with an instruction asking for a Proposal in
+// JSON, which the user confirms before it runs in their shell.
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Prefix starts the prompts asking for a command.
+const Prefix = "!"
+
+// request separates the instruction from the request in a prompt.
+const request = "\n\nRequest: "
+
+// Proposal is a command proposed by a model.
+type Proposal struct {
+	Command     string `json:"command"`
+	Explanation string `json:"explanation,omitempty"`
+}
+
+// IsRequest reports whether the prompt asks for a command.
+func IsRequest(prompt string) bool {
+	rest, ok := strings.CutPrefix(prompt, Prefix)
+	return ok && strings.TrimSpace(rest) != ""
+}
+
+// Prompt is what is sent to the model for a prompt asking for a command.
+func Prompt(prompt string) string {
+	return fmt.Sprintf(
+		`Reply only with a JSON object proposing a single command for the %s shell on %s that does what is asked, like {"command": "ls -a", "explanation": "lists the files, hidden ones included"}. No markdown, no other text.`,
+		filepath.Base(Path()), runtime.GOOS,
+	) + request + strings.TrimSpace(strings.TrimPrefix(prompt, Prefix))
+}
+
+// Request returns what is asked in a prompt made by Prompt.
+func Request(prompt string) (string, bool) {
+	_, rest, ok := strings.Cut(prompt, request)
+	return rest, ok
+}
+
+// Parse reads the proposal in a reply. Models often wrap it in a code block
+// or a sentence, the first JSON object found is used.
+func Parse(reply string) (Proposal, bool) {
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return Proposal{}, false
+	}
+	var p Proposal
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &p); err != nil {
+		return Proposal{}, false
+	}
+	p.Command = strings.TrimSpace(p.Command)
+	return p, p.Command != ""
+}
+
+// Quote joins args in a command line the shell splits back into them.
+func Quote(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.TrimLeft(arg, safeChars) == "" {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// safeChars are left unquoted by Quote.
+const safeChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,+@%"
+
+// Path is the shell of the user, or sh.
+func Path() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "/bin/sh"
+}
+
+// Event is output of a command, or its end.
+type Event struct {
+	Output string
+	// Done is set on the last event. ExitCode is the status the command
+	// exited with, or -1 when Err tells it didn't run to the end.
+	Done     bool
+	ExitCode int
+	Err      error
+}
+
+// waitDelay is how long the output is read after the command exited or was
+// killed, processes it started may still hold it open.
+const waitDelay = time.Second
+
+// Run runs command in the shell of the user, killing it after timeout, if
+// not 0, or when ctx is done. The standard output and error are interleaved
+// in the events, the last one telling how it ended.
+func Run(ctx context.Context, command string, timeout time.Duration) <-chan Event {
+	events := make(chan Event, 64)
+	go func() {
+		defer close(events)
+		runCtx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout > 0 {
+			runCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		defer cancel()
+		cmd := exec.CommandContext(runCtx, Path(), "-c", command)
+		cmd.WaitDelay = waitDelay
+		// the same writer for both makes them share a pipe, keeping the order
+		w := writer{ctx: ctx, events: events}
+		cmd.Stdout, cmd.Stderr = w, w
+		err := cmd.Run()
+		done := Event{Done: true}
+		var exitErr *exec.ExitError
+		switch {
+		case errors.Is(runCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil:
+			done.ExitCode, done.Err = -1, fmt.Errorf("timed out after %s", timeout)
+		case ctx.Err() != nil:
+			done.ExitCode, done.Err = -1, errors.New("cancelled")
+		case errors.As(err, &exitErr):
+			done.ExitCode = exitErr.ExitCode()
+		case err != nil:
+			done.ExitCode, done.Err = -1, err
+		}
+		select {
+		case events <- done:
+		case <-ctx.Done():
+		}
+	}()
+	return events
+}
+
+type writer struct {
+	ctx    context.Context
+	events chan<- Event
+}
+
+func (w writer) Write(p []byte) (int, error) {
+	select {
+	case w.events <- Event{Output: string(p)}:
+	case <-w.ctx.Done():
+	}
+	return len(p), nil
+}
+
+// Next waits for the next events of a command, returning everything
+// buffered at once.
+func Next(events <-chan Event) []Event {
+	ev, ok := <-events
+	if !ok {
+		return []Event{{Done: true, ExitCode: -1, Err: errors.New("cancelled")}}
+	}
+	batch := []Event{ev}
+	for !ev.Done {
+		select {
+		case ev, ok = <-events:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, ev)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// Tail keeps the last n lines of output.
+func Tail(output string, n int) string {
+	lines := strings.SplitAfter(strings.TrimSuffix(output, "\n"), "\n")
+	if len(lines) <= n {
+		return output
+	}
+	return fmt.Sprintf("[%d lines left out]\n", len(lines)-n) + strings.Join(lines[len(lines)-n:], "") + "\n"
+}
+
+// MaxOutput is the size of the output kept in a transcript, the beginning
+// of longer outputs is left out.
+const MaxOutput = 16 << 10
+
+// Transcript shows a command, its output and how it ended, like a terminal
+// would.
+func Transcript(command, output string, done *Event) string {
+	var sb strings.Builder
+	sb.WriteString("$ " + command + "\n")
+	if len(output) > MaxOutput {
+		fmt.Fprintf(&sb, "[%d bytes left out]\n", len(output)-MaxOutput)
+		cut := len(output) - MaxOutput
+		for cut < len(output) && !utf8.RuneStart(output[cut]) {
+			cut++
+		}
+		output = output[cut:]
+	}
+	sb.WriteString(output)
+	if output != "" && !strings.HasSuffix(output, "\n") {
+		sb.WriteString("\n")
+	}
+	switch {
+	case done == nil:
+	case done.Err != nil:
+		fmt.Fprintf(&sb, "[%s]", done.Err)
+	default:
+		fmt.Fprintf(&sb, "[exit status %d]", done.ExitCode)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
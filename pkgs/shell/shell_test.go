@@ -0,0 +1,113 @@
+package shell
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrompt(t *testing.T) {
+	if !IsRequest("!list the files") || IsRequest("! ") || IsRequest("list the files") {
+		t.Error("expected only prompts starting with ! to ask for a command")
+	}
+	request, ok := Request(Prompt("! list the files"))
+	if !ok || request != "list the files" {
+		t.Errorf("expected the request back, got %q %v", request, ok)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, reply := range []string{
+		`{"command": "ls -a", "explanation": "lists the files"}`,
+		"```json\n{\"command\": \"ls -a\", \"explanation\": \"lists the files\"}\n```",
+		"Here it is: {\"command\": \" ls -a \", \"explanation\": \"lists the files\"}",
+	} {
+		p, ok := Parse(reply)
+		if !ok || p.Command != "ls -a" || p.Explanation != "lists the files" {
+			t.Errorf("%q: got %+v %v", reply, p, ok)
+		}
+	}
+	for _, reply := range []string{"ls -a", `{"explanation": "nothing"}`, `{"command": }`} {
+		if p, ok := Parse(reply); ok {
+			t.Errorf("%q: expected no proposal, got %+v", reply, p)
+		}
+	}
+}
+
+// collect runs command and returns its output and last event.
+func collect(t *testing.T, ctx context.Context, command string, timeout time.Duration) (string, Event) {
+	t.Helper()
+	var output strings.Builder
+	events := Run(ctx, command, timeout)
+	for {
+		for _, ev := range Next(events) {
+			output.WriteString(ev.Output)
+			if ev.Done {
+				return output.String(), ev
+			}
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	output, done := collect(t, context.Background(), "echo out; echo err >&2; exit 3", time.Minute)
+	if output != "out\nerr\n" || done.ExitCode != 3 || done.Err != nil {
+		t.Errorf("got %q %+v", output, done)
+	}
+	if got := Transcript("false", output, &done); got != "$ false\nout\nerr\n[exit status 3]" {
+		t.Errorf("unexpected transcript %q", got)
+	}
+
+	_, done = collect(t, context.Background(), "sleep 10", 50*time.Millisecond)
+	if done.ExitCode != -1 || done.Err == nil || !strings.Contains(done.Err.Error(), "timed out") {
+		t.Errorf("expected a timeout, got %+v", done)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, done = collect(t, ctx, "sleep 10", time.Minute); done.Err == nil {
+		t.Errorf("expected the command to be cancelled, got %+v", done)
+	}
+}
+
+func TestTranscriptKeepsTheEnd(t *testing.T) {
+	output := strings.Repeat("é", MaxOutput)
+	got := Transcript("yes", output, nil)
+	if !strings.HasPrefix(got, "$ yes\n[") || !strings.HasSuffix(got, "é") || len(got) > MaxOutput+100 {
+		t.Errorf("unexpected transcript of %d bytes starting with %q", len(got), got[:30])
+	}
+}
+
+func TestQuote(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	args := []string{"printf", "%s|", "go test", "it's", "", "$HOME"}
+	command := Quote(args)
+	if !strings.HasPrefix(command, "printf '%s|' 'go test' 'it'\\''s'") {
+		t.Errorf("unexpected quoting %q", command)
+	}
+	// no timeout
+	output, done := collect(t, context.Background(), command, 0)
+	if output != "go test|it's||$HOME|" || done.ExitCode != 0 {
+		t.Errorf("expected the arguments back, got %q, %+v", output, done)
+	}
+}
+
+func TestExplainPrompt(t *testing.T) {
+	output := Tail("one\ntwo\nthree\n", 2)
+	if output != "[1 lines left out]\ntwo\nthree\n" {
+		t.Errorf("unexpected tail %q", output)
+	}
+	env := Environment{OS: "linux", Arch: "amd64", Shell: "/bin/sh", GoVersion: "go1.22.0", Dir: "/src"}
+	done := Event{Done: true, ExitCode: 2}
+	prompt := ExplainPrompt(Transcript("make test", output, &done), done, env)
+	for _, want := range []string{"in /src, with /bin/sh on linux/amd64 and go1.22.0", "$ make test\n[1 lines left out]\ntwo\nthree\n[exit status 2]\n```", "Why did this fail"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("expected %q in\n%s", want, prompt)
+		}
+	}
+	if !strings.Contains(ExplainPrompt("$ true", Event{Done: true}, env), "succeeded") {
+		t.Error("expected a successful command to be asked about otherwise")
+	}
+}
@@ -3,11 +3,22 @@ package styles
 import "github.com/charmbracelet/lipgloss"
 
 var (
-	SenderStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("5"))
-	AiStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
-	ActiveStyle = lipgloss.NewStyle().
-			Border(lipgloss.NormalBorder(), true, false, true, false).
-			BorderForeground(lipgloss.Color("#00ff00"))
+	SenderStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("5"))
+	AiStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+	ErrorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	WarningStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+	NoteStyle     = lipgloss.NewStyle().Faint(true)
+	ToolStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+	SelectedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("170"))
+	// AddedStyle and RemovedStyle color the lines of a diff.
+	AddedStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	RemovedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	// MatchStyle and CurrentMatchStyle highlight search results.
+	MatchStyle        = lipgloss.NewStyle().Reverse(true)
+	CurrentMatchStyle = lipgloss.NewStyle().Background(lipgloss.Color("170")).Foreground(lipgloss.Color("0"))
+	ActiveStyle       = lipgloss.NewStyle().
+				Border(lipgloss.NormalBorder(), true, false, true, false).
+				BorderForeground(lipgloss.Color("#00ff00"))
 
 	InactiveStyle = lipgloss.NewStyle().
 			Border(lipgloss.NormalBorder(), true, false, true, false).
@@ -36,6 +47,15 @@ var (
 	}
 )
 
+// PaneStyle is the border style of a pane showing height lines. Unlike
+// ActiveStyle and InactiveStyle, it doesn't assume the pane fills the window.
+func PaneStyle(focused bool, height int) lipgloss.Style {
+	if focused {
+		return ActiveStyle.Copy().Height(height)
+	}
+	return InactiveStyle.Copy().Height(height)
+}
+
 func SetDimensions(width, height int) {
 	Height = height
 	Width = width
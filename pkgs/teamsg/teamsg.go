@@ -1,13 +1,178 @@
 package teamsg
 
 import (
+	"teachat/pkgs/history"
+	"teachat/pkgs/mcp"
+	"teachat/pkgs/patch"
+	"teachat/pkgs/permissions"
+	"teachat/pkgs/tools"
 	"teachat/pkgs/types"
 )
 
 type ChatPromptMsg string
-type ChatStreamMsg types.StreamReader
+type ChatStreamMsg types.ChatStream
 type ChatStreamDeltaMsg types.ChatStream
-type ChatStreamCloseMsg types.ChatStream
 type ModelSelectedMsg types.Model
 type GetSupportedModelsMsg bool
 type ModelsMsg []types.Model
+type ConversationLoadedMsg history.Conversation
+
+// QueuedPromptsMsg sends the prompts one after the other, each one once the
+// reply to the previous one is done.
+type QueuedPromptsMsg []string
+
+// EditMessageMsg asks the prompt to edit the message at Index of the
+// conversation.
+type EditMessageMsg struct {
+	Index   int
+	Content string
+}
+
+// ChatEditMsg replaces the message at Index with Content on a new branch
+// and sends it.
+type ChatEditMsg struct {
+	Index   int
+	Content string
+}
+
+// ConversationTreeMsg opens the tree view of the conversation.
+type ConversationTreeMsg history.Conversation
+
+// BranchSelectedMsg makes the branch going through the node with this ID the
+// active one.
+type BranchSelectedMsg int
+
+// QuoteMsg inserts quoted text in the prompt.
+type QuoteMsg string
+
+// OpenHistorySearchMsg indexes the saved conversations when the search page
+// is opened.
+type OpenHistorySearchMsg struct{}
+
+// SearchResultSelectedMsg opens a saved conversation found by the search,
+// Message being the message matching best or -1, and Terms the searched
+// words.
+type SearchResultSelectedMsg struct {
+	Conversation history.Conversation
+	Message      int
+	Terms        []string
+}
+
+// ShowMessageMsg scrolls the convo to the message at Index, highlighting
+// Terms.
+type ShowMessageMsg struct {
+	Index int
+	Terms []string
+}
+
+// TitleSuggestedMsg names the conversation with ConversationID, as suggested
+// by the utility model.
+type TitleSuggestedMsg struct {
+	ConversationID string
+	Title          string
+	Tags           []string
+}
+
+// ContextUsageMsg tells how much of the context window of the model the
+// conversation takes.
+type ContextUsageMsg struct {
+	Tokens int
+	Window int
+	// Dropped is the number of messages left out of the context, Summarized
+	// is set when they are replaced by a summary.
+	Dropped    int
+	Summarized bool
+	Warn       bool
+}
+
+// PromptChangedMsg is sent as the prompt is typed. Index is the message
+// being edited, or -1.
+type PromptChangedMsg struct {
+	Text  string
+	Index int
+}
+
+// PromptTokensMsg counts the tokens of the prompt Text, Context being the
+// size of the request it would be sent with and Window the context window
+// of the model.
+type PromptTokensMsg struct {
+	Text    string
+	Tokens  int
+	Context int
+	Window  int
+	Warn    bool
+}
+
+// ToolResultsMsg carries the results of the tool calls made by the model,
+// Run telling which calls they answer.
+type ToolResultsMsg struct {
+	Run     int
+	Results []types.Message
+}
+
+// MCPServersMsg is the status of the MCP servers after a change, with the
+// tools of the running ones.
+type MCPServersMsg struct {
+	Statuses []mcp.Status
+	Tools    []tools.Tool
+}
+
+// AttachMsg attaches the document Content, named Name, to the prompt.
+type AttachMsg struct {
+	Name    string
+	Content string
+}
+
+// MCPPromptMsg replaces the prompt with the text of an MCP prompt.
+type MCPPromptMsg string
+
+// ToolApprovalMsg asks the user whether the call at Index of the tool calls
+// of Run may run, Reason telling why the user is asked.
+type ToolApprovalMsg struct {
+	Run    int
+	Index  int
+	Call   types.ToolCall
+	Reason string
+}
+
+// ToolApprovedMsg is the answer of the user to a ToolApprovalMsg.
+type ToolApprovedMsg struct {
+	Run    int
+	Index  int
+	Answer permissions.Answer
+}
+
+// SummaryMsg is the summary of the messages of the conversation with
+// ConversationID up to the node Through.
+type SummaryMsg struct {
+	ConversationID string
+	Through        int
+	Text           string
+}
+
+// EditTitleMsg asks the prompt to edit the title and tags of the
+// conversation, written as by titles.Format.
+type EditTitleMsg string
+
+// TitleEditedMsg is the title and tags written in the prompt.
+type TitleEditedMsg string
+
+// CommandProposedMsg is a shell command proposed by the model, for the user
+// to confirm.
+type CommandProposedMsg struct {
+	Command     string
+	Explanation string
+}
+
+// RunCommandMsg runs the command confirmed by the user, sending its output
+// to the model when SendOutput is set.
+type RunCommandMsg struct {
+	Command    string
+	SendOutput bool
+}
+
+// CommandCancelledMsg is sent when the user doesn't run a proposed command.
+type CommandCancelledMsg struct{}
+
+// EditsMsg opens the preview of the edits proposed in a reply.
+type EditsMsg []patch.File
@@ -0,0 +1,131 @@
+// Package titles names conversations by asking a model for a short title and
+// a few tags.
+package titles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"teachat/pkgs/llminterface"
+	"teachat/pkgs/types"
+)
+
+// Suggestion is the title and tags proposed for a conversation.
+type Suggestion struct {
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+}
+
+const (
+	// MaxTags is the number of tags kept from a suggestion.
+	MaxTags = 4
+	// maxTitle is the length, in runes, a title is cut to.
+	maxTitle = 60
+	// maxExcerpt is the length, in runes, of each message sent to the model.
+	maxExcerpt = 1000
+)
+
+const systemPrompt = `You name chat conversations. Reply with a JSON object and nothing else,
+like {"title": "Configure a NATS cluster", "tags": ["nats", "config"]}.
+The title has at most 8 words and no final period. Tags are 1 to 4 short
+lowercase keywords about the topic.`
+
+// Suggest asks client for a title and tags describing messages. The client
+// is used for this request only, its system prompt and history are replaced.
+func Suggest(ctx context.Context, client llminterface.Client, messages []types.Message) (Suggestion, error) {
+	client.SetSystemPrompt(systemPrompt)
+	client.SetMessages(nil)
+	events, err := client.Stream(ctx, prompt(messages))
+	if err != nil {
+		return Suggestion{}, err
+	}
+	reply, _, err := llminterface.Collect(ctx, events)
+	if err != nil {
+		return Suggestion{}, err
+	}
+	return Parse(reply)
+}
+
+// prompt quotes the messages to name, long messages are cut.
+func prompt(messages []types.Message) string {
+	var sb strings.Builder
+	sb.WriteString("Name this conversation:\n")
+	for _, m := range messages {
+		content := strings.TrimSpace(m.Content)
+		if runes := []rune(content); len(runes) > maxExcerpt {
+			content = string(runes[:maxExcerpt]) + "..."
+		}
+		fmt.Fprintf(&sb, "\n%s: %s\n", m.Role, content)
+	}
+	return sb.String()
+}
+
+// Parse reads the suggestion in a reply, tolerating text or code fences
+// around the JSON object. The title is cleaned up and the tags normalized.
+func Parse(reply string) (Suggestion, error) {
+	var s Suggestion
+	start := strings.Index(reply, "{")
+	end := strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return s, fmt.Errorf("no JSON object in the reply: %q", reply)
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &s); err != nil {
+		return s, fmt.Errorf("parsing the suggestion: %w", err)
+	}
+	s.Title = strings.Trim(strings.Join(strings.Fields(s.Title), " "), ` ."'`)
+	if s.Title == "" {
+		return s, errors.New("the suggestion has no title")
+	}
+	if runes := []rune(s.Title); len(runes) > maxTitle {
+		s.Title = string(runes[:maxTitle-3]) + "..."
+	}
+	s.Tags = normalizeTags(s.Tags)
+	return s, nil
+}
+
+// normalizeTags lowercases tags, joins their words with dashes and drops
+// duplicates.
+func normalizeTags(tags []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(strings.ToLower(strings.TrimLeft(tag, "#"))), "-")
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+		if len(out) == MaxTags {
+			break
+		}
+	}
+	return out
+}
+
+// Format writes a title and tags as edited by the user, like
+// "Configure a NATS cluster #nats #config".
+func Format(title string, tags []string) string {
+	parts := []string{title}
+	for _, tag := range tags {
+		parts = append(parts, "#"+tag)
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseEdited reads a title and tags written as by Format.
+func ParseEdited(text string) Suggestion {
+	var s Suggestion
+	var words []string
+	for _, word := range strings.Fields(text) {
+		if strings.HasPrefix(word, "#") && len(word) > 1 {
+			s.Tags = append(s.Tags, word)
+			continue
+		}
+		words = append(words, word)
+	}
+	s.Title = strings.Join(words, " ")
+	s.Tags = normalizeTags(s.Tags)
+	return s
+}
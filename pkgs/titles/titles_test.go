@@ -0,0 +1,58 @@
+package titles
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"teachat/pkgs/mock"
+	"teachat/pkgs/types"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		reply string
+		want  Suggestion
+	}{
+		{`{"title": "Configure a NATS cluster", "tags": ["nats", "config"]}`, Suggestion{"Configure a NATS cluster", []string{"nats", "config"}}},
+		{"Sure!\n```json\n{\"title\": \"Go  generics.\", \"tags\": [\"Go\", \"#go\", \"Type Parameters\"]}\n```", Suggestion{"Go generics", []string{"go", "type-parameters"}}},
+	} {
+		got, err := Parse(tc.reply)
+		if err != nil {
+			t.Fatalf("parsing %q: %v", tc.reply, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parsing %q: expected %+v, got %+v", tc.reply, tc.want, got)
+		}
+	}
+	for _, reply := range []string{"NATS cluster", `{"tags": ["nats"]}`} {
+		if _, err := Parse(reply); err == nil {
+			t.Errorf("expected an error parsing %q", reply)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	client := &mock.Client{Reply: `{"title": "Pancakes", "tags": ["cooking"]}`}
+	got, err := Suggest(context.Background(), client, []types.Message{
+		{Role: types.UserRole, Content: "A recipe for pancakes"},
+		{Role: types.AssistantRole, Content: "Mix flour, eggs and milk."},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "Pancakes" || len(got.Tags) != 1 {
+		t.Errorf("unexpected suggestion %+v", got)
+	}
+	if sent := client.Messages()[0].Content; !strings.Contains(sent, "user: A recipe for pancakes") {
+		t.Errorf("expected the conversation in the prompt, got %q", sent)
+	}
+}
+
+func TestEdited(t *testing.T) {
+	s := ParseEdited(Format("Configure a NATS cluster", []string{"nats", "infra"}) + " #Ops")
+	if s.Title != "Configure a NATS cluster" || !reflect.DeepEqual(s.Tags, []string{"nats", "infra", "ops"}) {
+		t.Errorf("unexpected edit %+v", s)
+	}
+}
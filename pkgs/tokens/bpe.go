@@ -0,0 +1,66 @@
+package tokens
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+func init() {
+	// the encodings are embedded, counting doesn't download them
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// DefaultEncoding is used for the OpenAI models tiktoken doesn't know yet.
+const DefaultEncoding = tiktoken.MODEL_CL100K_BASE
+
+// BPE counts tokens with the byte pair encoding of OpenAI models, as
+// tiktoken does.
+type BPE struct {
+	encoding *tiktoken.Tiktoken
+}
+
+var (
+	encodingsMu sync.Mutex
+	// encodings are loaded once, their ranks take a few megabytes.
+	encodings = map[string]*tiktoken.Tiktoken{}
+)
+
+// NewBPE loads an encoding, like cl100k_base or o200k_base.
+func NewBPE(encoding string) (*BPE, error) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	if enc, ok := encodings[encoding]; ok {
+		return &BPE{enc}, nil
+	}
+	enc, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+	encodings[encoding] = enc
+	return &BPE{enc}, nil
+}
+
+// EncodingFor returns the name of the encoding of an OpenAI model.
+func EncodingFor(model string) string {
+	if enc, ok := tiktoken.MODEL_TO_ENCODING[model]; ok {
+		return enc
+	}
+	for prefix, enc := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(model, prefix) {
+			return enc
+		}
+	}
+	return DefaultEncoding
+}
+
+// Count encodes text as ordinary text, special tokens like <|endoftext|>
+// being counted as the characters they are made of.
+func (b *BPE) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	return len(b.encoding.EncodeOrdinary(text))
+}
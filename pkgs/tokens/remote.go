@@ -0,0 +1,120 @@
+package tokens
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Tokenizer is implemented by the clients whose server tokenizes text with
+// the tokenizer of the model.
+type Tokenizer interface {
+	Tokenize(ctx context.Context, text string) ([]int, error)
+}
+
+const (
+	// remoteTimeout bounds a tokenize request, counting happens as the
+	// prompt is typed.
+	remoteTimeout = 2 * time.Second
+	// remoteCache is the number of counts kept, the messages of the
+	// conversation are counted again with every request.
+	remoteCache = 1024
+)
+
+// Remote counts tokens with the tokenizer of a server. Once the server
+// fails, because it is down or doesn't tokenize, the fallback counts
+// instead.
+type Remote struct {
+	tokenizer Tokenizer
+	fallback  Counter
+
+	mu     sync.Mutex
+	failed bool
+	counts map[string]int
+	// missing holds the texts estimated by Cached, to be counted by Warm.
+	missing map[string]bool
+}
+
+func NewRemote(tokenizer Tokenizer, fallback Counter) *Remote {
+	return &Remote{tokenizer: tokenizer, fallback: fallback, counts: make(map[string]int), missing: make(map[string]bool)}
+}
+
+// Cached returns a counter that never asks the server: it gives the counts
+// already made and the fallback for the texts not counted yet, which are
+// left for Warm. It is meant for the UI, where a slow server must not block.
+func (r *Remote) Cached() Counter {
+	return cached{r}
+}
+
+type cached struct {
+	r *Remote
+}
+
+func (c cached) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	r := c.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n, ok := r.counts[text]; ok {
+		return n
+	}
+	if !r.failed {
+		r.missing[text] = true
+	}
+	return r.fallback.Count(text)
+}
+
+// Warm counts with the server the texts estimated by Cached since the last
+// call. It blocks, and reports whether any count changed.
+func (r *Remote) Warm() bool {
+	r.mu.Lock()
+	texts := make([]string, 0, len(r.missing))
+	for text := range r.missing {
+		texts = append(texts, text)
+	}
+	clear(r.missing)
+	r.mu.Unlock()
+	for _, text := range texts {
+		r.Count(text)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(texts) > 0 && !r.failed
+}
+
+func (r *Remote) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	r.mu.Lock()
+	n, ok := r.counts[text]
+	failed := r.failed
+	r.mu.Unlock()
+	if ok {
+		return n
+	}
+	if failed {
+		return r.fallback.Count(text)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+	tokens, err := r.tokenizer.Tokenize(ctx, text)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		if !r.failed {
+			slog.Debug("tokenizing with the server, estimating tokens instead", "error", err)
+		}
+		r.failed = true
+		return r.fallback.Count(text)
+	}
+	if len(r.counts) >= remoteCache {
+		clear(r.counts)
+	}
+	r.counts[text] = len(tokens)
+	return len(tokens)
+}
@@ -0,0 +1,81 @@
+// Package tokens estimates how many tokens a model sees in a text.
+package tokens
+
+import (
+	"fmt"
+	"log/slog"
+	"teachat/pkgs/types"
+	"unicode/utf8"
+)
+
+// Counter counts the tokens of a text for a model.
+type Counter interface {
+	Count(text string) int
+}
+
+// Heuristic approximates the tokenizers of current models, which average
+// around four characters of English per token. It errs on the high side
+// for code and other languages.
+type Heuristic struct{}
+
+func (Heuristic) Count(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// For returns the counter matching the tokenizer of model: the BPE of
+// OpenAI models, the server of Ollama models when client tokenizes, and
+// the heuristic otherwise.
+func For(model types.Model, client any) Counter {
+	switch model.Platform {
+	case types.OpenAI:
+		bpe, err := NewBPE(EncodingFor(string(model.Name)))
+		if err != nil {
+			slog.Warn("loading the encoding, estimating tokens instead", "model", model.Name, "error", err)
+			return Heuristic{}
+		}
+		return bpe
+	case types.Ollama:
+		if tokenizer, ok := client.(Tokenizer); ok {
+			return NewRemote(tokenizer, Heuristic{})
+		}
+	}
+	return Heuristic{}
+}
+
+const (
+	// perMessage is the overhead of the role and separators of a message in
+	// the chat templates.
+	perMessage = 4
+	// perReply primes the reply of the assistant.
+	perReply = 3
+)
+
+// Messages counts the tokens of a chat request made of messages.
+func Messages(c Counter, messages []types.Message) int {
+	n := perReply
+	for _, m := range messages {
+		n += Message(c, m)
+	}
+	return n
+}
+
+// Message counts the tokens of a single message with its overhead, and the
+// tools it calls.
+func Message(c Counter, m types.Message) int {
+	n := perMessage + c.Count(m.Content)
+	for _, call := range m.ToolCalls {
+		n += c.Count(call.Name) + c.Count(call.Arguments)
+	}
+	return n
+}
+
+// Format writes token counts in thousands above 1000, like 8.2k.
+func Format(n int) string {
+	switch {
+	case n < 1000:
+		return fmt.Sprint(n)
+	case n < 10000:
+		return fmt.Sprintf("%.1fk", float64(n)/1000)
+	}
+	return fmt.Sprintf("%dk", (n+500)/1000)
+}
@@ -0,0 +1,119 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"teachat/pkgs/types"
+)
+
+func TestBPE(t *testing.T) {
+	for _, tc := range []struct {
+		encoding string
+		text     string
+		want     int
+	}{
+		{"cl100k_base", "hello world", 2},
+		{"cl100k_base", "tiktoken is great!", 6},
+		{"cl100k_base", "<|endoftext|>", 7},
+		{"o200k_base", "hello world", 2},
+		{"o200k_base", "", 0},
+	} {
+		bpe, err := NewBPE(tc.encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := bpe.Count(tc.text); got != tc.want {
+			t.Errorf("%s %q: expected %d tokens, got %d", tc.encoding, tc.text, tc.want, got)
+		}
+	}
+}
+
+func TestEncodingFor(t *testing.T) {
+	for model, want := range map[string]string{
+		"gpt-4o":            "o200k_base",
+		"gpt-4o-2024-05-13": "o200k_base",
+		"gpt-4":             "cl100k_base",
+		"gpt-3.5-turbo":     "cl100k_base",
+		"some-future-model": DefaultEncoding,
+	} {
+		if got := EncodingFor(model); got != want {
+			t.Errorf("%s: expected %s, got %s", model, want, got)
+		}
+	}
+}
+
+// tokenizer splits text into bytes, or fails once told to.
+type tokenizer struct {
+	calls int
+	err   error
+}
+
+func (tk *tokenizer) Tokenize(_ context.Context, text string) ([]int, error) {
+	tk.calls++
+	if tk.err != nil {
+		return nil, tk.err
+	}
+	return make([]int, len(text)), nil
+}
+
+func TestRemote(t *testing.T) {
+	tk := &tokenizer{}
+	r := NewRemote(tk, Heuristic{})
+	if n := r.Count("hello"); n != 5 {
+		t.Errorf("expected the server count, got %d", n)
+	}
+	r.Count("hello")
+	if tk.calls != 1 {
+		t.Errorf("expected the count to be cached, got %d calls", tk.calls)
+	}
+
+	tk.err = errors.New("404 Not Found")
+	if n := r.Count("hello there"); n != 3 {
+		t.Errorf("expected the fallback count, got %d", n)
+	}
+	tk.err = nil
+	r.Count("again")
+	if tk.calls != 2 {
+		t.Errorf("expected the server not to be asked once it failed, got %d calls", tk.calls)
+	}
+}
+
+func TestRemoteCached(t *testing.T) {
+	tk := &tokenizer{}
+	r := NewRemote(tk, Heuristic{})
+	cached := r.Cached()
+	if n := cached.Count("hello there"); n != 3 || tk.calls != 0 {
+		t.Errorf("expected the fallback count without asking the server, got %d after %d calls", n, tk.calls)
+	}
+	if !r.Warm() || tk.calls != 1 {
+		t.Errorf("expected the missing count to be made, got %d calls", tk.calls)
+	}
+	if n := cached.Count("hello there"); n != 11 {
+		t.Errorf("expected the server count once warm, got %d", n)
+	}
+	if r.Warm() {
+		t.Error("expected nothing left to count")
+	}
+}
+
+func TestFor(t *testing.T) {
+	if _, ok := For(types.Model{Name: types.GPT4o, Platform: types.OpenAI}, nil).(*BPE); !ok {
+		t.Error("expected OpenAI models to be counted with their encoding")
+	}
+	if _, ok := For(types.Model{Name: types.Llama3, Platform: types.Ollama}, &tokenizer{}).(*Remote); !ok {
+		t.Error("expected Ollama models to be counted by the server")
+	}
+	if _, ok := For(types.Model{Name: types.Llama3, Platform: types.Ollama}, nil).(Heuristic); !ok {
+		t.Error("expected the heuristic without a tokenizer")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for n, want := range map[int]string{999: "999", 4096: "4.1k", 128000: "128k"} {
+		if got := Format(n); got != want {
+			t.Errorf("%d: expected %s, got %s", n, want, got)
+		}
+	}
+}
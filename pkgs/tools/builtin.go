@@ -0,0 +1,258 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// maxGrepMatches bounds the lines returned by grep.
+	maxGrepMatches = 100
+	// maxGrepFile is the size above which files are not searched.
+	maxGrepFile = 1 << 20
+	// binarySniff is the number of bytes looked at to tell binary files.
+	binarySniff = 8000
+)
+
+// now is replaced in tests.
+var now = time.Now
+
+// Builtins returns the local tools: read_file, list_dir, grep and
+// current_time. Relative paths are resolved from dir.
+func Builtins(dir string) []Tool {
+	b := builtins{dir: dir}
+	return []Tool{
+		{
+			Name:        "read_file",
+			Description: "Read a text file. Lines can be selected with offset, the first line being 1, and limit.",
+			Parameters: json.RawMessage(`{"type": "object", "properties": {
+				"path": {"type": "string", "description": "Path of the file"},
+				"offset": {"type": "integer", "description": "First line to read, starting at 1"},
+				"limit": {"type": "integer", "description": "Number of lines to read"}
+			}, "required": ["path"]}`),
+			Handler:  b.readFile,
+			ReadOnly: true,
+			Paths:    b.paths,
+		},
+		{
+			Name:        "list_dir",
+			Description: "List the entries of a directory, directories end with a slash and files are followed by their size.",
+			Parameters: json.RawMessage(`{"type": "object", "properties": {
+				"path": {"type": "string", "description": "Path of the directory, defaults to the working directory"}
+			}}`),
+			Handler:  b.listDir,
+			ReadOnly: true,
+			Paths:    b.paths,
+		},
+		{
+			Name:        "grep",
+			Description: fmt.Sprintf("Search the lines matching a regular expression in a file, or in the files of a directory and its subdirectories. At most %d lines are returned, as path:line:text.", maxGrepMatches),
+			Parameters: json.RawMessage(`{"type": "object", "properties": {
+				"pattern": {"type": "string", "description": "Regular expression, in RE2 syntax"},
+				"path": {"type": "string", "description": "File or directory to search, defaults to the working directory"},
+				"ignore_case": {"type": "boolean"}
+			}, "required": ["pattern"]}`),
+			Handler:  b.grep,
+			ReadOnly: true,
+			Paths:    b.paths,
+		},
+		{
+			Name:        "current_time",
+			Description: "Get the current date and time.",
+			Parameters: json.RawMessage(`{"type": "object", "properties": {
+				"timezone": {"type": "string", "description": "IANA time zone, like Europe/Paris, defaults to the local one"}
+			}}`),
+			Handler:  currentTime,
+			ReadOnly: true,
+		},
+	}
+}
+
+type builtins struct {
+	dir string
+}
+
+// path resolves a path given by the model.
+func (b builtins) path(p string) string {
+	if p == "" {
+		p = "."
+	}
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(b.dir, p)
+}
+
+// paths returns the path argument of a call, resolved.
+func (b builtins) paths(arguments json.RawMessage) []string {
+	var args struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil
+	}
+	return []string{b.path(args.Path)}
+}
+
+func (b builtins) readFile(_ context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Path   string `json:"path"`
+		Offset int    `json:"offset"`
+		Limit  int    `json:"limit"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", err
+	}
+	if args.Path == "" {
+		return "", errors.New("path is required")
+	}
+	data, err := os.ReadFile(b.path(args.Path))
+	if err != nil {
+		return "", err
+	}
+	if binary(data) {
+		return "", fmt.Errorf("%s is a binary file", args.Path)
+	}
+	if args.Offset <= 1 && args.Limit <= 0 {
+		return string(data), nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	start := min(max(args.Offset-1, 0), len(lines))
+	end := len(lines)
+	if args.Limit > 0 {
+		end = min(start+args.Limit, end)
+	}
+	return strings.Join(lines[start:end], ""), nil
+}
+
+func (b builtins) listDir(_ context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(b.path(args.Path))
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, e := range entries {
+		if e.IsDir() {
+			fmt.Fprintf(&sb, "%s/\n", e.Name())
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s %d\n", e.Name(), info.Size())
+	}
+	if sb.Len() == 0 {
+		return "(empty directory)", nil
+	}
+	return sb.String(), nil
+}
+
+func (b builtins) grep(ctx context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Pattern    string `json:"pattern"`
+		Path       string `json:"path"`
+		IgnoreCase bool   `json:"ignore_case"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", err
+	}
+	expr := args.Pattern
+	if args.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return "", err
+	}
+	root := b.path(args.Path)
+	var matches []string
+	errFull := errors.New("enough matches")
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// unreadable entries are skipped
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxGrepFile {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || binary(data) {
+			return nil
+		}
+		name := path
+		if rel, err := filepath.Rel(b.dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxGrepFile)
+		for line := 1; scanner.Scan(); line++ {
+			if re.Match(scanner.Bytes()) {
+				matches = append(matches, fmt.Sprintf("%s:%d:%s", filepath.ToSlash(name), line, scanner.Text()))
+				if len(matches) == maxGrepMatches {
+					return errFull
+				}
+			}
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errFull):
+		matches = append(matches, fmt.Sprintf("[stopped after %d matches]", maxGrepMatches))
+	case err != nil:
+		return "", err
+	case len(matches) == 0:
+		return "no matches", nil
+	}
+	return strings.Join(matches, "\n"), nil
+}
+
+func currentTime(_ context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", err
+	}
+	t := now()
+	if args.Timezone != "" {
+		loc, err := time.LoadLocation(args.Timezone)
+		if err != nil {
+			return "", fmt.Errorf("unknown time zone %q", args.Timezone)
+		}
+		t = t.In(loc)
+	}
+	return t.Format("Monday, " + time.RFC3339), nil
+}
+
+// binary reports whether data looks like the content of a binary file, by
+// the presence of a NUL byte in its beginning.
+func binary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), binarySniff)], 0) >= 0
+}
@@ -0,0 +1,158 @@
+// Package tools runs the tools offered to the models. A tool is described to
+// the model by its name and the JSON schema of its arguments, and run by a Go
+// handler when the model calls it.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"teachat/pkgs/types"
+	"unicode/utf8"
+)
+
+// Handler runs a tool with the arguments given by the model and returns
+// its result, as text.
+type Handler func(ctx context.Context, arguments json.RawMessage) (string, error)
+
+// Tool is a tool the models may call.
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the arguments.
+	Parameters json.RawMessage
+	Handler    Handler
+	// ReadOnly tools don't change anything, they run without asking by
+	// default.
+	ReadOnly bool
+	// Paths returns the files and directories accessed by a call, checked
+	// against the allowed paths.
+	Paths func(arguments json.RawMessage) []string
+	// Command returns the command line run by a call, checked against the
+	// allowed commands.
+	Command func(arguments json.RawMessage) string
+}
+
+// MaxOutput is the size above which results are cut, to keep them within
+// the context window.
+const MaxOutput = 32 << 10
+
+// Registry holds the tools offered to the models, in the order they were
+// registered. It is safe for concurrent use, tools may come and go while
+// others run.
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]Tool
+	names []string
+}
+
+// NewRegistry registers tools, see Register.
+func NewRegistry(tools ...Tool) (*Registry, error) {
+	r := &Registry{tools: make(map[string]Tool)}
+	for _, t := range tools {
+		if err := r.Register(t); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds a tool. Names are unique and the schema has to be valid
+// JSON.
+func (r *Registry) Register(t Tool) error {
+	switch {
+	case t.Name == "":
+		return fmt.Errorf("tool without a name")
+	case t.Handler == nil:
+		return fmt.Errorf("tool %q has no handler", t.Name)
+	case !json.Valid(t.Parameters):
+		return fmt.Errorf("tool %q: invalid parameters schema", t.Name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tools[t.Name]; ok {
+		return fmt.Errorf("tool %q is already registered", t.Name)
+	}
+	r.tools[t.Name] = t
+	r.names = append(r.names, t.Name)
+	return nil
+}
+
+// Unregister removes the tool with the given name, if any.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tools[name]; !ok {
+		return
+	}
+	delete(r.tools, name)
+	r.names = slices.DeleteFunc(r.names, func(n string) bool { return n == name })
+}
+
+// Get returns the tool with the given name.
+func (r *Registry) Get(name string) (Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+// Len returns the number of tools.
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.names)
+}
+
+// Specs describes the tools to the clients.
+func (r *Registry) Specs() []types.Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	specs := make([]types.Tool, len(r.names))
+	for i, name := range r.names {
+		t := r.tools[name]
+		specs[i] = types.Tool{Name: t.Name, Description: t.Description, Parameters: t.Parameters}
+	}
+	return specs
+}
+
+// Run runs the tool called and returns the message answering the call.
+// Failures are told to the model in the message, it may try again.
+func (r *Registry) Run(ctx context.Context, call types.ToolCall) types.Message {
+	result := types.Message{Role: types.ToolRole, ToolCallID: call.ID, Name: call.Name}
+	t, ok := r.Get(call.Name)
+	if !ok {
+		result.Content = fmt.Sprintf("error: unknown tool %q", call.Name)
+		return result
+	}
+	arguments := json.RawMessage(call.Arguments)
+	if call.Arguments == "" {
+		arguments = json.RawMessage("{}")
+	}
+	if !json.Valid(arguments) {
+		result.Content = "error: the arguments are not valid JSON"
+		return result
+	}
+	output, err := t.Handler(ctx, arguments)
+	if err != nil {
+		result.Content = "error: " + err.Error()
+		return result
+	}
+	result.Content = Truncate(output, MaxOutput)
+	return result
+}
+
+// Truncate cuts s to at most n bytes, on a rune boundary, telling how much
+// was left out.
+func Truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + fmt.Sprintf("\n[truncated, %d more bytes]", len(s)-cut)
+}
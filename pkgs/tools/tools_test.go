@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	// the time zones are looked up in tests without the system database
+	_ "time/tzdata"
+
+	"teachat/pkgs/types"
+)
+
+func builtinRegistry(t *testing.T, dir string) *Registry {
+	t.Helper()
+	r, err := NewRegistry(Builtins(dir)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func run(r *Registry, name, arguments string) string {
+	return r.Run(context.Background(), types.ToolCall{ID: "call_1", Name: name, Arguments: arguments}).Content
+}
+
+func TestRegistry(t *testing.T) {
+	echo := Tool{Name: "echo", Parameters: json.RawMessage(`{}`), Handler: func(_ context.Context, args json.RawMessage) (string, error) {
+		return string(args), nil
+	}}
+	r, err := NewRegistry(echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(echo); err == nil {
+		t.Error("expected an error registering a tool twice")
+	}
+	if err := r.Register(Tool{Name: "broken", Parameters: json.RawMessage(`{`), Handler: echo.Handler}); err == nil {
+		t.Error("expected an error for an invalid schema")
+	}
+	if specs := r.Specs(); len(specs) != 1 || specs[0].Name != "echo" {
+		t.Errorf("expected the spec of echo, got %+v", specs)
+	}
+
+	result := r.Run(context.Background(), types.ToolCall{ID: "call_1", Name: "echo", Arguments: `{"a": 1}`})
+	if result.Role != types.ToolRole || result.ToolCallID != "call_1" || result.Name != "echo" || result.Content != `{"a": 1}` {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if got := run(r, "echo", ""); got != "{}" {
+		t.Errorf("expected empty arguments to be an empty object, got %q", got)
+	}
+	if got := run(r, "echo", "{"); !strings.HasPrefix(got, "error:") {
+		t.Errorf("expected invalid arguments to be reported, got %q", got)
+	}
+	if got := run(r, "missing", "{}"); got != `error: unknown tool "missing"` {
+		t.Errorf("expected an unknown tool to be reported, got %q", got)
+	}
+	r.Unregister("echo")
+	if _, ok := r.Get("echo"); ok || r.Len() != 0 {
+		t.Error("expected echo to be unregistered")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := Truncate("héllo", 2); got != "h\n[truncated, 5 more bytes]" {
+		t.Errorf("expected the cut on a rune boundary, got %q", got)
+	}
+	if got := Truncate("hello", 5); got != "hello" {
+		t.Errorf("expected short text to be kept, got %q", got)
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("notes.txt", "one\ntwo\nthree\n")
+	write("src/main.go", "package main\n\nfunc main() {}\n")
+	write(".git/config", "func hidden\n")
+	write("image.bin", "\x00\x01func")
+	r := builtinRegistry(t, dir)
+
+	for _, tc := range []struct {
+		tool, arguments, want string
+	}{
+		{"read_file", `{"path": "notes.txt"}`, "one\ntwo\nthree\n"},
+		{"read_file", `{"path": "notes.txt", "offset": 2, "limit": 1}`, "two\n"},
+		{"read_file", `{"path": "image.bin"}`, "error: image.bin is a binary file"},
+		{"read_file", `{}`, "error: path is required"},
+		{"list_dir", `{}`, ".git/\nimage.bin 6\nnotes.txt 14\nsrc/\n"},
+		{"list_dir", `{"path": "src"}`, "main.go 29\n"},
+		{"grep", `{"pattern": "func"}`, "src/main.go:3:func main() {}"},
+		{"grep", `{"pattern": "TWO", "path": "notes.txt", "ignore_case": true}`, "notes.txt:2:two"},
+		{"grep", `{"pattern": "four"}`, "no matches"},
+	} {
+		if got := run(r, tc.tool, tc.arguments); got != tc.want {
+			t.Errorf("%s %s: expected %q, got %q", tc.tool, tc.arguments, tc.want, got)
+		}
+	}
+}
+
+func TestCurrentTime(t *testing.T) {
+	now = func() time.Time { return time.Date(2024, 5, 10, 12, 30, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+	r := builtinRegistry(t, ".")
+	if got := run(r, "current_time", `{}`); got != "Friday, 2024-05-10T12:30:00Z" {
+		t.Errorf("unexpected time %q", got)
+	}
+	if got := run(r, "current_time", `{"timezone": "Asia/Tokyo"}`); got != "Friday, 2024-05-10T21:30:00+09:00" {
+		t.Errorf("unexpected time %q", got)
+	}
+	if got := run(r, "current_time", `{"timezone": "Mars/Olympus"}`); !strings.HasPrefix(got, "error: unknown time zone") {
+		t.Errorf("expected an unknown time zone to be reported, got %q", got)
+	}
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 
@@ -10,27 +11,109 @@ import (
 )
 
 type Model struct {
-	Name     LLMModel
-	Platform LLMPlatform
+	Name     LLMModel    `json:"name"`
+	Platform LLMPlatform `json:"platform"`
+	// ContextWindow is the number of tokens the model accepts, prompt and
+	// reply included, or 0 when unknown.
+	ContextWindow int `json:"context_window,omitempty"`
+	// Tools is set for the models able to call tools.
+	Tools bool `json:"tools,omitempty"`
 }
 
 // implement list.Item interface
 func (m Model) FilterValue() string { return "" }
 
-type StreamReader interface {
-	Bytes() []byte
-	Scan() bool
-	Close()
+// EventType tells which field of a StreamEvent is set.
+type EventType int
+
+const (
+	// TextDelta carries the next piece of the reply in Text.
+	TextDelta EventType = iota
+	// UsageEvent carries the token accounting in Usage.
+	UsageEvent
+	// ToolCallEvent carries a tool invocation requested by the model.
+	ToolCallEvent
+	// DoneEvent is the last event of a successful reply.
+	DoneEvent
+	// ErrorEvent is the last event of a failed reply, the cause is in Err.
+	ErrorEvent
+)
+
+// StreamEvent is an item of the reply stream returned by a client.
+type StreamEvent struct {
+	Type     EventType
+	Text     string
+	Usage    *Usage
+	ToolCall *ToolCall
+	Err      error
+}
+
+// Terminal reports whether no more events follow ev.
+func (ev StreamEvent) Terminal() bool {
+	return ev.Type == DoneEvent || ev.Type == ErrorEvent
 }
 
-type ChatResponse struct {
-	Done bool
-	Text string
+// ToolCall is a request from the model to run a tool with JSON arguments.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
 }
 
+// Tool describes a tool to the model, Parameters being the JSON schema of
+// its arguments.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// ChatStream is a reply being received, Batch holds the events received
+// since the last update.
 type ChatStream struct {
-	Response *ChatResponse
-	Stream   StreamReader
+	Events <-chan StreamEvent
+	Batch  []StreamEvent
+}
+
+// Message is a provider independent chat message. Replies of the assistant
+// may call tools, the results being sent back in tool messages naming the
+// call they answer.
+type Message struct {
+	Role       Role       `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	// Name is the tool that produced the content of a tool message.
+	Name string `json:"name,omitempty"`
+}
+
+type Role string
+
+const (
+	SystemRole    Role = "system"
+	UserRole      Role = "user"
+	AssistantRole Role = "assistant"
+	ToolRole      Role = "tool"
+)
+
+// Usage is the token accounting reported by the provider once a response is
+// complete.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Parameters are the sampling parameters sent along with a prompt. Nil
+// fields are left to the provider defaults.
+type Parameters struct {
+	Temperature *float32 `json:"temperature,omitempty"`
+	TopP        *float32 `json:"top_p,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	// ContextWindow is the context size to run the model with, for the
+	// providers where it is a setting. It comes from the model, not from
+	// the configuration.
+	ContextWindow int `json:"-"`
 }
 
 var (
@@ -68,6 +151,24 @@ const (
 	Llama3 LLMModel = "llama3"
 )
 
+// SupportedModels lists the models that can be selected in teachat.
+var SupportedModels = []Model{
+	{Name: GPT35, Platform: OpenAI, ContextWindow: 16385, Tools: true},
+	{Name: GPT4, Platform: OpenAI, ContextWindow: 8192, Tools: true},
+	{Name: GPT4o, Platform: OpenAI, ContextWindow: 128000, Tools: true},
+	{Name: Llama3, Platform: Ollama, ContextWindow: 8192},
+}
+
+// FindModel looks up a supported model by name.
+func FindModel(name LLMModel) (Model, bool) {
+	for _, m := range SupportedModels {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Model{}, false
+}
+
 type LLMPlatform string
 
 const (
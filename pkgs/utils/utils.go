@@ -1,18 +1,41 @@
 package utils
 
 import (
-	tea "github.com/charmbracelet/bubbletea"
+	"os"
+	"path/filepath"
 )
 
 func Ptr[T any](input T) *T {
 	return &input
 }
 
-func LogToFile(path, prefix, content string) {
-	f, err := tea.LogToFile(path, prefix)
+// XDGDir returns the teachat directory under the XDG base directory named by
+// env (e.g. XDG_DATA_HOME), falling back to fallback relative to the home
+// directory when the variable is not set.
+func XDGDir(env, fallback string) (string, error) {
+	if dir := os.Getenv(env); dir != "" {
+		return filepath.Join(dir, "teachat"), nil
+	}
+	home, err := os.UserHomeDir()
 	if err != nil {
-		panic(err)
+		return "", err
+	}
+	return filepath.Join(home, fallback, "teachat"), nil
+}
+
+// Resolve makes path absolute, following the symbolic links so that a link
+// can't lead outside a directory checked with the result. A missing file is
+// resolved from its directory.
+func Resolve(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	if dir := filepath.Dir(abs); dir != abs {
+		return filepath.Join(Resolve(dir), filepath.Base(abs))
 	}
-	defer f.Close()
-	f.WriteString(prefix + "|" + content + "\n")
+	return abs
 }
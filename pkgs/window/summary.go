@@ -0,0 +1,43 @@
+package window
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"teachat/pkgs/llminterface"
+	"teachat/pkgs/types"
+)
+
+const summaryPrompt = `You summarize the beginning of a chat conversation so that it can go on
+without it. Keep the facts, decisions, names, code identifiers and open
+questions, drop the chit-chat. Write at most 200 words, as plain text.`
+
+// Summarize asks client for a summary of messages, extending the previous
+// summary of the turns before them. The client is used for this request
+// only, its system prompt and history are replaced.
+func Summarize(ctx context.Context, client llminterface.Client, previous string, messages []types.Message) (string, error) {
+	var sb strings.Builder
+	if previous != "" {
+		fmt.Fprintf(&sb, "Summary so far:\n%s\n\n", previous)
+	}
+	sb.WriteString("Conversation to summarize:\n")
+	for _, m := range messages {
+		fmt.Fprintf(&sb, "\n%s: %s\n", m.Role, strings.TrimSpace(m.Content))
+	}
+	client.SetSystemPrompt(summaryPrompt)
+	client.SetMessages(nil)
+	events, err := client.Stream(ctx, sb.String())
+	if err != nil {
+		return "", err
+	}
+	summary, _, err := llminterface.Collect(ctx, events)
+	if err != nil {
+		return "", err
+	}
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return "", errors.New("the model returned an empty summary")
+	}
+	return summary, nil
+}
@@ -0,0 +1,133 @@
+// Package window fits a conversation into the context window of a model,
+// leaving out or summarizing the oldest messages.
+package window
+
+import (
+	"fmt"
+	"teachat/pkgs/tokens"
+	"teachat/pkgs/types"
+)
+
+// Strategy tells which messages are left out when the conversation doesn't
+// fit.
+type Strategy string
+
+const (
+	// DropOldest leaves out the oldest turns.
+	DropOldest Strategy = "drop-oldest"
+	// KeepPinned leaves out the oldest turns but the pinned messages.
+	KeepPinned Strategy = "keep-pinned"
+	// Summary replaces the oldest turns with a summary written by the model,
+	// pinned messages are kept.
+	Summary Strategy = "summary"
+)
+
+// Strategies lists the valid strategies.
+var Strategies = []Strategy{DropOldest, KeepPinned, Summary}
+
+// Entry is a message of the conversation, ID being its node in the tree.
+type Entry struct {
+	ID      int
+	Message types.Message
+	Pinned  bool
+}
+
+// Plan is what is sent to the model for a turn.
+type Plan struct {
+	Messages []types.Message
+	// Tokens is the estimate for Messages.
+	Tokens int
+	// Dropped are the entries left out, oldest first.
+	Dropped []Entry
+	// Overflow is set when the kept messages still don't fit.
+	Overflow bool
+}
+
+// Fit keeps the most recent entries fitting in budget tokens. Turns are left
+// out whole, a prompt with its reply, from the oldest, skipping the pinned
+// ones unless the strategy is DropOldest.
+func Fit(entries []Entry, budget int, strategy Strategy, counter tokens.Counter) Plan {
+	costs := make([]int, len(entries))
+	total := tokens.Messages(counter, nil)
+	for i, e := range entries {
+		costs[i] = tokens.Message(counter, e.Message)
+		total += costs[i]
+	}
+	dropped := make([]bool, len(entries))
+	for i := 0; i < len(entries) && total > budget; i++ {
+		if entries[i].Pinned && strategy != DropOldest {
+			continue
+		}
+		dropped[i] = true
+		total -= costs[i]
+		if entries[i].Message.Role != types.UserRole {
+			continue
+		}
+		// the reply goes with its prompt, along with the tool calls and
+		// results leading to it
+		for next := i + 1; next < len(entries) && entries[next].Message.Role != types.UserRole; next++ {
+			if entries[next].Pinned && strategy != DropOldest {
+				break
+			}
+			dropped[next] = true
+			total -= costs[next]
+			i = next
+		}
+	}
+	var plan Plan
+	for i, e := range entries {
+		if dropped[i] {
+			plan.Dropped = append(plan.Dropped, e)
+			continue
+		}
+		plan.Messages = append(plan.Messages, e.Message)
+	}
+	plan.Messages = pairToolCalls(plan.Messages)
+	plan.Tokens = tokens.Messages(counter, plan.Messages)
+	plan.Overflow = total > budget
+	return plan
+}
+
+// pairToolCalls leaves out the tool calls without results and the results
+// without calls, which providers refuse. They are left by the messages
+// dropped or excluded, and by the calls cancelled.
+func pairToolCalls(messages []types.Message) []types.Message {
+	calls := make(map[string]bool)
+	results := make(map[string]bool)
+	for _, m := range messages {
+		for _, call := range m.ToolCalls {
+			calls[call.ID] = true
+		}
+		if m.Role == types.ToolRole {
+			results[m.ToolCallID] = true
+		}
+	}
+	paired := make([]types.Message, 0, len(messages))
+	for _, m := range messages {
+		if m.Role == types.ToolRole && !calls[m.ToolCallID] {
+			continue
+		}
+		if len(m.ToolCalls) > 0 {
+			var answered []types.ToolCall
+			for _, call := range m.ToolCalls {
+				if results[call.ID] {
+					answered = append(answered, call)
+				}
+			}
+			m.ToolCalls = answered
+			if len(answered) == 0 && m.Content == "" {
+				continue
+			}
+		}
+		paired = append(paired, m)
+	}
+	return paired
+}
+
+// SummaryMessage is the message standing for the summarized turns.
+func SummaryMessage(summary string) types.Message {
+	return types.Message{
+		Role:    types.SystemRole,
+		Content: fmt.Sprintf("Summary of the earlier conversation:\n%s", summary),
+	}
+}
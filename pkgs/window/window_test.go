@@ -0,0 +1,112 @@
+package window
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"teachat/pkgs/mock"
+	"teachat/pkgs/tokens"
+	"teachat/pkgs/types"
+)
+
+// words counts a token per word, to keep the budgets readable.
+type words struct{}
+
+func (words) Count(text string) int { return len(strings.Fields(text)) }
+
+func turns(pinned ...int) []Entry {
+	var entries []Entry
+	for i, text := range []string{"q1", "a1", "q2", "a2", "q3", "a3"} {
+		role := types.UserRole
+		if i%2 == 1 {
+			role = types.AssistantRole
+		}
+		entries = append(entries, Entry{ID: i + 1, Message: types.Message{Role: role, Content: text}})
+	}
+	for _, i := range pinned {
+		entries[i].Pinned = true
+	}
+	return entries
+}
+
+func contents(messages []types.Message) string {
+	var out []string
+	for _, m := range messages {
+		out = append(out, m.Content)
+	}
+	return strings.Join(out, " ")
+}
+
+func TestFit(t *testing.T) {
+	// every message costs 5 tokens and a request 3 more
+	for _, tc := range []struct {
+		name     string
+		strategy Strategy
+		pinned   []int
+		budget   int
+		want     string
+		overflow bool
+	}{
+		{"fits", DropOldest, nil, 33, "q1 a1 q2 a2 q3 a3", false},
+		{"drops whole turns", DropOldest, nil, 25, "q2 a2 q3 a3", false},
+		{"drops pinned messages", DropOldest, []int{0}, 23, "q2 a2 q3 a3", false},
+		{"keeps pinned messages", KeepPinned, []int{0}, 23, "q1 q3 a3", false},
+		{"keeps pinned replies", Summary, []int{1}, 23, "a1 q3 a3", false},
+		{"overflows", KeepPinned, []int{0, 1, 2, 3}, 20, "q1 a1 q2 a2", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			plan := Fit(turns(tc.pinned...), tc.budget, tc.strategy, words{})
+			if got := contents(plan.Messages); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			if plan.Overflow != tc.overflow {
+				t.Errorf("expected overflow %v", tc.overflow)
+			}
+			if plan.Tokens != tokens.Messages(words{}, plan.Messages) {
+				t.Errorf("unexpected token count %d", plan.Tokens)
+			}
+		})
+	}
+}
+
+func TestFitToolCalls(t *testing.T) {
+	call := types.ToolCall{ID: "call_1", Name: "read_file", Arguments: "{}"}
+	entries := []Entry{
+		{ID: 1, Message: types.Message{Role: types.UserRole, Content: "q1"}},
+		{ID: 2, Message: types.Message{Role: types.AssistantRole, ToolCalls: []types.ToolCall{call}}},
+		{ID: 3, Message: types.Message{Role: types.ToolRole, ToolCallID: "call_1", Content: "r1"}},
+		{ID: 4, Message: types.Message{Role: types.AssistantRole, Content: "a1"}},
+		{ID: 5, Message: types.Message{Role: types.UserRole, Content: "q2"}},
+		{ID: 6, Message: types.Message{Role: types.AssistantRole, Content: "a2"}},
+	}
+	plan := Fit(entries, 20, DropOldest, words{})
+	if got := contents(plan.Messages); got != "q2 a2" || len(plan.Dropped) != 4 {
+		t.Errorf("expected the tool calls to be dropped with their turn, got %q", got)
+	}
+
+	// a result left alone, like when its call is excluded, is not sent
+	plan = Fit(append([]Entry{}, entries[2:]...), 100, DropOldest, words{})
+	if got := contents(plan.Messages); got != "a1 q2 a2" {
+		t.Errorf("expected the result without its call to be left out, got %q", got)
+	}
+	// and neither is a call without result, like when it was cancelled
+	plan = Fit(append([]Entry{}, entries[:2]...), 100, DropOldest, words{})
+	if got := contents(plan.Messages); got != "q1" {
+		t.Errorf("expected the call without its result to be left out, got %q", got)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	client := &mock.Client{Reply: "They talked about NATS."}
+	summary, err := Summarize(context.Background(), client, "Earlier summary.", []types.Message{{Role: types.UserRole, Content: "q1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary != "They talked about NATS." {
+		t.Errorf("unexpected summary %q", summary)
+	}
+	if sent := client.Messages()[0].Content; !strings.Contains(sent, "Earlier summary.") || !strings.Contains(sent, "user: q1") {
+		t.Errorf("expected the previous summary and the messages in the prompt, got %q", sent)
+	}
+}